@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SpanAttributeProcessorは、エクスポートする前にスパンの属性を書き換える処理です。
+// 複数の処理を順に適用でき、前の処理の結果が次の処理に渡されます。
+type SpanAttributeProcessor interface {
+	// Processは、attrsを書き換えた結果を返します。attrs自体を変更してはいけません。
+	Process(attrs []attribute.KeyValue) []attribute.KeyValue
+}
+
+// renameAttributeは、属性のキーをfromからtoに変更します。
+// 既にtoの属性がある場合は、変更後の値で上書きします。
+type renameAttribute struct {
+	from attribute.Key
+	to   attribute.Key
+}
+
+func (p renameAttribute) Process(attrs []attribute.KeyValue) []attribute.KeyValue {
+	var (
+		renamed attribute.KeyValue
+		found   bool
+	)
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		switch kv.Key {
+		case p.from:
+			renamed, found = attribute.KeyValue{Key: p.to, Value: kv.Value}, true
+		case p.to:
+			// 元のtoの属性は、変更後の値で上書きされる場合のみ除きます。
+		default:
+			out = append(out, kv)
+		}
+	}
+	if !found {
+		return attrs
+	}
+	return append(out, renamed)
+}
+
+// dropAttributeは、指定したキーの属性を取り除きます。
+type dropAttribute struct {
+	key attribute.Key
+}
+
+func (p dropAttribute) Process(attrs []attribute.KeyValue) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if kv.Key != p.key {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// truncationMarkerは、切り詰めた文字列の末尾に付ける印です。
+const truncationMarker = "…"
+
+// truncateAttributesは、maxLen文字（rune単位）を超える文字列の属性の値を、
+// 末尾のtruncationMarkerを含めてmaxLen文字に収まるよう切り詰めます。
+// 切り詰めた場合は、truncated属性を付加します。
+type truncateAttributes struct {
+	maxLen int
+}
+
+func (p truncateAttributes) Process(attrs []attribute.KeyValue) []attribute.KeyValue {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		v, ok := p.truncateValue(kv.Value)
+		if !ok {
+			if out != nil {
+				out = append(out, kv)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]attribute.KeyValue, 0, len(attrs)+1), attrs[:i]...)
+		}
+		out = append(out, attribute.KeyValue{Key: kv.Key, Value: v})
+	}
+	if out == nil {
+		return attrs
+	}
+	return append(out, attribute.Bool("truncated", true))
+}
+
+// truncateValueは、vを切り詰めた値と、切り詰めたかどうかを返します。
+func (p truncateAttributes) truncateValue(v attribute.Value) (attribute.Value, bool) {
+	switch v.Type() {
+	case attribute.STRING:
+		if s, ok := p.truncateString(v.AsString()); ok {
+			return attribute.StringValue(s), true
+		}
+	case attribute.STRINGSLICE:
+		ss := v.AsStringSlice()
+		truncated := false
+		for i, s := range ss {
+			if t, ok := p.truncateString(s); ok {
+				ss[i], truncated = t, true
+			}
+		}
+		if truncated {
+			return attribute.StringSliceValue(ss), true
+		}
+	}
+	return v, false
+}
+
+func (p truncateAttributes) truncateString(s string) (string, bool) {
+	if utf8.RuneCountInString(s) <= p.maxLen {
+		return s, false
+	}
+	return truncate(s, p.maxLen-utf8.RuneCountInString(truncationMarker)) + truncationMarker, true
+}
+
+// parseAttributeProcessorsは、"rename:from=to"または"drop:key"形式の指定を、
+// 同じ順序で適用するSpanAttributeProcessorのリストに変換します。
+func parseAttributeProcessors(specs []string) ([]SpanAttributeProcessor, error) {
+	var processors []SpanAttributeProcessor
+	for _, spec := range specs {
+		op, arg, ok := strings.Cut(spec, ":")
+		if !ok || arg == "" {
+			return nil, fmt.Errorf("invalid attribute processor %q", spec)
+		}
+		switch op {
+		case "rename":
+			from, to, ok := strings.Cut(arg, "=")
+			if !ok || from == "" || to == "" {
+				return nil, fmt.Errorf("invalid rename %q, expected rename:from=to", spec)
+			}
+			processors = append(processors, renameAttribute{from: attribute.Key(from), to: attribute.Key(to)})
+		case "drop":
+			processors = append(processors, dropAttribute{key: attribute.Key(arg)})
+		default:
+			return nil, fmt.Errorf("unsupported attribute processor %q", op)
+		}
+	}
+	return processors, nil
+}
+
+// attributeProcessingExporterは、SpanAttributeProcessorを順に適用した属性でスパンをエクスポートするSpanExporterです。
+// OnEndで渡されるスパンは読み取り専用のため、属性の書き換えはエクスポートの直前に行います。
+type attributeProcessingExporter struct {
+	trace.SpanExporter
+	processors []SpanAttributeProcessor
+}
+
+func (e *attributeProcessingExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	processed := make([]trace.ReadOnlySpan, len(spans))
+	for i, s := range spans {
+		attrs := s.Attributes()
+		for _, p := range e.processors {
+			attrs = p.Process(attrs)
+		}
+		processed[i] = processedSpan{ReadOnlySpan: s, attrs: attrs}
+	}
+	return e.SpanExporter.ExportSpans(ctx, processed)
+}
+
+// processedSpanは、属性を書き換えたReadOnlySpanです。
+type processedSpan struct {
+	trace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s processedSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
+
+// attributeKeyPatternは、属性のキーの命名規則（ドット区切りのスネークケース）です。
+var attributeKeyPattern = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)*$`)
+
+// namingConventionは、命名規則に従わない属性のキーを検出するSpanAttributeProcessorです。
+// renameがtrueの場合はスネークケースに変換し、falseの場合はキーごとに一度だけ警告をログに出力します。
+type namingConvention struct {
+	rename bool
+	// warnedは、警告済みのキーを保持します。
+	warned sync.Map
+}
+
+func (p *namingConvention) Process(attrs []attribute.KeyValue) []attribute.KeyValue {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		if attributeKeyPattern.MatchString(string(kv.Key)) {
+			if out != nil {
+				out = append(out, kv)
+			}
+			continue
+		}
+		if !p.rename {
+			if _, loaded := p.warned.LoadOrStore(kv.Key, struct{}{}); !loaded {
+				log.Printf("WARNING: span attribute key %q does not follow the dotted snake_case naming convention", kv.Key)
+			}
+			continue
+		}
+		if out == nil {
+			// attrs自体は変更できないため、最初に変換が必要になった時点でコピーします。
+			out = append(make([]attribute.KeyValue, 0, len(attrs)), attrs[:i]...)
+		}
+		out = append(out, attribute.KeyValue{Key: attribute.Key(toSnakeCase(string(kv.Key))), Value: kv.Value})
+	}
+	if out == nil {
+		return attrs
+	}
+	return out
+}
+
+// toSnakeCaseは、キャメルケースやハイフン区切りのキーを、ドット区切りを保ったままスネークケースに変換します。
+func toSnakeCase(key string) string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, r := range key {
+		switch {
+		case unicode.IsUpper(r):
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case r == '-' || r == ' ':
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
+}
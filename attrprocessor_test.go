@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAttributeProcessorChain(t *testing.T) {
+	processors, err := parseAttributeProcessors([]string{"rename:player=player.name", "drop:debug.token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := tracetest.NewInMemoryExporter()
+	exporter := &attributeProcessingExporter{SpanExporter: inner, processors: processors}
+
+	spans := tracetest.SpanStubs{{
+		Name: "roll",
+		Attributes: []attribute.KeyValue{
+			attribute.String("player", "alice"),
+			attribute.String("debug.token", "secret"),
+			attribute.Int("dice.sides", 6),
+		},
+	}}.Snapshots()
+	if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+
+	got := attribute.NewSet(inner.GetSpans()[0].Attributes...)
+	want := attribute.NewSet(
+		attribute.String("player.name", "alice"),
+		attribute.Int("dice.sides", 6),
+	)
+	if !got.Equals(&want) {
+		t.Errorf("attributes = %v, want %v", got.ToSlice(), want.ToSlice())
+	}
+}
+
+func TestParseAttributeProcessorsRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"rename:player", "drop:", "upper:player"} {
+		if _, err := parseAttributeProcessors([]string{spec}); err == nil {
+			t.Errorf("parseAttributeProcessors(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestNamingConvention(t *testing.T) {
+	attrs := []attribute.KeyValue{
+		attribute.String("player.name", "alice"),
+		attribute.Int("diceCount", 2),
+	}
+
+	t.Run("warn", func(t *testing.T) {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+		p := &namingConvention{}
+		got := p.Process(attrs)
+		p.Process(attrs)
+		if !slices.Equal(got, attrs) {
+			t.Errorf("attributes = %v, want them unchanged", got)
+		}
+		if n := strings.Count(buf.String(), `"diceCount" does not follow`); n != 1 {
+			t.Errorf("log = %q, want one warning for diceCount", buf.String())
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		got := (&namingConvention{rename: true}).Process(attrs)
+		want := []attribute.KeyValue{
+			attribute.String("player.name", "alice"),
+			attribute.Int("dice_count", 2),
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("attributes = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestTruncateAttributes(t *testing.T) {
+	p := truncateAttributes{maxLen: 8}
+
+	short := []attribute.KeyValue{attribute.String("player", "alice")}
+	if got := p.Process(short); !slices.Equal(got, short) {
+		t.Errorf("attributes = %v, want short values unchanged", got)
+	}
+
+	got := attribute.NewSet(p.Process([]attribute.KeyValue{
+		attribute.String("player", "alice"),
+		attribute.String("comment", "ほげほげほげほげほげ"),
+		attribute.StringSlice("tags", []string{"ok", "0123456789"}),
+	})...)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"player":    attribute.StringValue("alice"),
+		"comment":   attribute.StringValue("ほげほげほげほ" + truncationMarker),
+		"tags":      attribute.StringSliceValue([]string{"ok", "0123456" + truncationMarker}),
+		"truncated": attribute.BoolValue(true),
+	} {
+		if v, ok := got.Value(key); !ok || v != want {
+			t.Errorf("%s = %s, want %s", key, v.Emit(), want.Emit())
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// backpressureProcessorは、キューが満杯の場合にスパンを破棄せず、
+// 空きができるまで最大timeoutだけスパンを終了したゴルーチンを待機させるSpanProcessorです。
+// nextには、trace.WithBlockingを指定したバッチプロセッサーを渡してください。
+// timeoutを過ぎても空きができない場合は、リクエストの処理を止めないようスパンを破棄します。
+//
+// Shutdownは、待機中のスパンをnextに渡し終えるまで待ってからnextを停止します。
+// ForceFlushも同様に、呼び出した時点で待機中のスパンをnextに渡してからnextをフラッシュします。
+type backpressureProcessor struct {
+	next    trace.SpanProcessor
+	timeout time.Duration
+
+	// queueは、nextに渡すスパンを1つずつ受け渡します。
+	// バッファーを持たないため、nextが詰まっている間は送信側が待機します。
+	// 待機している送信は順に受け取られるため、ForceFlushの目印はそれより前に待機していたスパンの後に届きます。
+	queue chan backpressureItem
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	// muは、stoppedとinflightを保護します。
+	mu sync.Mutex
+	// stoppedは、Shutdownが呼び出されたかどうかです。以降に終了したスパンは破棄します。
+	stopped bool
+	// inflightは、OnEndでqueueへの受け渡しを待っているスパンの数です。
+	inflight int
+	// idleは、Shutdownの後にinflightが0になった際に閉じます。
+	idle chan struct{}
+
+	dropped atomic.Int64
+}
+
+// backpressureItemは、queueで受け渡すスパン、またはForceFlushの目印です。
+type backpressureItem struct {
+	span trace.ReadOnlySpan
+	// flushedは、ForceFlushの目印の場合に、それより前のスパンをnextに渡し終えた時点で閉じます。
+	flushed chan struct{}
+}
+
+var _ trace.SpanProcessor = (*backpressureProcessor)(nil)
+
+// newBackpressureProcessorは、nextの前で最大timeoutだけ待機するbackpressureProcessorを返します。
+func newBackpressureProcessor(next trace.SpanProcessor, timeout time.Duration) *backpressureProcessor {
+	p := &backpressureProcessor{
+		next:    next,
+		timeout: timeout,
+		queue:   make(chan backpressureItem),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		idle:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *backpressureProcessor) run() {
+	defer close(p.done)
+	for {
+		select {
+		case <-p.stop:
+			return
+		case item := <-p.queue:
+			if item.flushed != nil {
+				close(item.flushed)
+				continue
+			}
+			p.next.OnEnd(item.span)
+		}
+	}
+}
+
+func (p *backpressureProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *backpressureProcessor) OnEnd(s trace.ReadOnlySpan) {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		p.dropped.Add(1)
+		return
+	}
+	p.inflight++
+	p.mu.Unlock()
+	defer p.leave()
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case p.queue <- backpressureItem{span: s}:
+	case <-timer.C:
+		p.dropped.Add(1)
+	}
+}
+
+// leaveは、OnEndの受け渡しが終わったことを記録し、停止中に最後の受け渡しが終わった場合はidleを閉じます。
+func (p *backpressureProcessor) leave() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inflight--
+	if p.stopped && p.inflight == 0 {
+		close(p.idle)
+	}
+}
+
+// waitingは、OnEndでqueueへの受け渡しを待っているスパンの数を返します。
+func (p *backpressureProcessor) waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inflight
+}
+
+func (p *backpressureProcessor) Shutdown(ctx context.Context) error {
+	p.once.Do(func() {
+		p.mu.Lock()
+		p.stopped = true
+		if p.inflight == 0 {
+			close(p.idle)
+		}
+		p.mu.Unlock()
+		// 待機中のスパンをすべてnextに渡すか破棄してから、受け渡しを止めます。
+		go func() {
+			<-p.idle
+			close(p.stop)
+		}()
+	})
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if n := p.dropped.Load(); n > 0 {
+		log.Printf("WARNING: dropped %d spans after waiting %v for space in the export queue", n, p.timeout)
+	}
+	return p.next.Shutdown(ctx)
+}
+
+func (p *backpressureProcessor) ForceFlush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case p.queue <- backpressureItem{flushed: flushed}:
+	case <-p.done:
+		// 停止した後は、待機中のスパンはありません。
+		close(flushed)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.next.ForceFlush(ctx)
+}
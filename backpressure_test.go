@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// gatedProcessorは、gateが閉じられるまでOnEndをブロックするSpanProcessorです。
+// キューが満杯のバッチプロセッサーを模擬します。
+type gatedProcessor struct {
+	gate chan struct{}
+
+	mu    sync.Mutex
+	names []string
+}
+
+func (p *gatedProcessor) OnStart(context.Context, trace.ReadWriteSpan) {}
+
+func (p *gatedProcessor) OnEnd(s trace.ReadOnlySpan) {
+	<-p.gate
+	p.mu.Lock()
+	p.names = append(p.names, s.Name())
+	p.mu.Unlock()
+}
+
+func (p *gatedProcessor) Shutdown(context.Context) error   { return nil }
+func (p *gatedProcessor) ForceFlush(context.Context) error { return nil }
+
+// gatedSpanExporterは、gateが閉じられるまでエクスポートをブロックし、エクスポートしたスパンの名前を記録するSpanExporterです。
+// コレクターが応答せず、バッチプロセッサーのキューが埋まっていく状況を模擬します。
+// シャットダウンの後も、記録した名前を保持します。
+type gatedSpanExporter struct {
+	gate chan struct{}
+
+	mu    sync.Mutex
+	names []string
+}
+
+func (e *gatedSpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	select {
+	case <-e.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range spans {
+		e.names = append(e.names, s.Name())
+	}
+	return nil
+}
+
+func (e *gatedSpanExporter) Shutdown(context.Context) error { return nil }
+
+func (e *gatedSpanExporter) exported() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.names)
+}
+
+// fillBackpressureQueueは、エクスポートが止まっている実際のバッチプロセッサー（キューの長さ1）の前に置いた
+// backpressureProcessorでn個のスパンを終了させ、少なくとも1つがOnEndで待機した状態になるまで待ちます。
+func fillBackpressureQueue(t testing.TB, n int) (*backpressureProcessor, *gatedSpanExporter) {
+	t.Helper()
+	exporter := &gatedSpanExporter{gate: make(chan struct{})}
+	bsp := trace.NewBatchSpanProcessor(exporter,
+		trace.WithMaxQueueSize(1), trace.WithMaxExportBatchSize(1), trace.WithBlocking())
+	p := newBackpressureProcessor(bsp, 10*time.Second)
+	// バッチプロセッサーは、サンプリングされたスパンのみをキューに入れます。
+	spans := make(tracetest.SpanStubs, n)
+	for i := range spans {
+		spans[i].Name = fmt.Sprintf("span-%d", i)
+		spans[i].SpanContext = oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID:    oteltrace.TraceID{1},
+			SpanID:     oteltrace.SpanID{byte(i + 1)},
+			TraceFlags: oteltrace.FlagsSampled,
+		})
+	}
+
+	var returned atomic.Int64
+	for _, s := range spans.Snapshots() {
+		go func() {
+			p.OnEnd(s)
+			returned.Add(1)
+		}()
+	}
+	// 受け渡しを待っているスパンと受け渡しを終えたスパンの合計がnになれば、すべてのOnEndが呼び出されています。
+	deadline := time.Now().Add(5 * time.Second)
+	for w := p.waiting(); w == 0 || int64(w)+returned.Load() != int64(n); w = p.waiting() {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiting = %d, returned = %d, want %d spans with at least one waiting", w, returned.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return p, exporter
+}
+
+func TestBackpressureProcessorShutdownHandsOffWaitingSpans(t *testing.T) {
+	const n = 5
+	p, exporter := fillBackpressureQueue(t, n)
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- p.Shutdown(context.Background()) }()
+	close(exporter.gate)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	if got := exporter.exported(); got != n {
+		t.Errorf("exported %d spans, want all %d including those waiting at shutdown", got, n)
+	}
+	if d := p.dropped.Load(); d != 0 {
+		t.Errorf("dropped %d spans, want none", d)
+	}
+
+	// シャットダウンの後に終了したスパンは、破棄した数に含めます。
+	p.OnEnd(tracetest.SpanStubs{{Name: "late"}}.Snapshots()[0])
+	if d := p.dropped.Load(); d != 1 {
+		t.Errorf("dropped %d spans after shutdown, want 1", d)
+	}
+}
+
+func TestBackpressureProcessorForceFlushHandsOffWaitingSpans(t *testing.T) {
+	const n = 5
+	p, exporter := fillBackpressureQueue(t, n)
+	t.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+
+	close(exporter.gate)
+	if err := p.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := exporter.exported(); got != n {
+		t.Errorf("exported %d spans after ForceFlush, want all %d including those waiting in OnEnd", got, n)
+	}
+}
+
+func TestBackpressureProcessorBlocksInsteadOfDropping(t *testing.T) {
+	next := &gatedProcessor{gate: make(chan struct{})}
+	p := newBackpressureProcessor(next, 5*time.Second)
+	t.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+	spans := tracetest.SpanStubs{{Name: "first"}, {Name: "second"}}.Snapshots()
+
+	// 1つ目のスパンは、詰まっているnextに渡されたまま止まります。
+	p.OnEnd(spans[0])
+
+	// 2つ目のスパンを終了したゴルーチンは、nextに空きができるまで待機します。
+	const delay = 50 * time.Millisecond
+	time.AfterFunc(delay, func() { close(next.gate) })
+	start := time.Now()
+	p.OnEnd(spans[1])
+	if waited := time.Since(start); waited < delay {
+		t.Errorf("OnEnd returned after %v, want it to block for about %v", waited, delay)
+	}
+	if n := p.dropped.Load(); n != 0 {
+		t.Errorf("dropped %d spans, want none", n)
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	if len(next.names) != 2 {
+		t.Errorf("next received %v, want both spans", next.names)
+	}
+}
+
+func TestBackpressureProcessorDropsAfterTimeout(t *testing.T) {
+	next := &gatedProcessor{gate: make(chan struct{})}
+	p := newBackpressureProcessor(next, 20*time.Millisecond)
+	spans := tracetest.SpanStubs{{Name: "first"}, {Name: "second"}}.Snapshots()
+
+	p.OnEnd(spans[0])
+	p.OnEnd(spans[1])
+	if n := p.dropped.Load(); n != 1 {
+		t.Errorf("dropped %d spans, want 1 after the timeout", n)
+	}
+	close(next.gate)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
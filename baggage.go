@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// W3C Baggageの仕様で、伝搬先が少なくとも受け入れる必要のあるメンバー数とバイト数です。
+const (
+	defaultBaggageMaxMembers = 64
+	defaultBaggageMaxBytes   = 8192
+)
+
+// baggageLimitMiddlewareは、上流から伝搬されたバゲージを最大maxMembers個、
+// 合計maxBytesバイトに収まるよう切り詰めます。
+// 切り詰めた場合は、サーバースパンにbaggage.trimmedイベントを記録します。
+// 切り詰めたバゲージは、下流への伝搬にもそのまま使われます。
+func baggageLimitMiddleware(next http.Handler, maxMembers, maxBytes int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		b := baggage.FromContext(ctx)
+		if trimmed, dropped := trimBaggage(b, maxMembers, maxBytes); dropped > 0 {
+			trace.SpanFromContext(ctx).AddEvent("baggage.trimmed", trace.WithAttributes(
+				attribute.Int("baggage.members.original", b.Len()),
+				attribute.Int("baggage.members.dropped", dropped),
+				attribute.Int("baggage.bytes.original", len(b.String())),
+				attribute.Int("baggage.bytes.trimmed", len(trimmed.String())),
+			))
+			r = r.WithContext(baggage.ContextWithBaggage(ctx, trimmed))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trimBaggageは、bのメンバーをキーの順に、maxMembers個かつ合計maxBytesバイト
+// （区切りのカンマを含む）に収まるまで残し、残したバゲージと破棄したメンバー数を返します。
+// Baggageはメンバーの順序を保持しないため、結果が一定になるようキーの順に並べています。
+func trimBaggage(b baggage.Baggage, maxMembers, maxBytes int) (baggage.Baggage, int) {
+	members := b.Members()
+	if len(members) <= maxMembers && len(b.String()) <= maxBytes {
+		return b, 0
+	}
+	slices.SortFunc(members, func(a, b baggage.Member) int {
+		return strings.Compare(a.Key(), b.Key())
+	})
+
+	var (
+		kept []baggage.Member
+		size int
+	)
+	for _, m := range members {
+		if len(kept) == maxMembers {
+			break
+		}
+		n := len(m.String())
+		if len(kept) > 0 {
+			n++ // 区切りのカンマ
+		}
+		if size+n > maxBytes {
+			// 後続のより小さいメンバーは収まる可能性があるため、続けて確認します。
+			continue
+		}
+		kept = append(kept, m)
+		size += n
+	}
+	// 元のバゲージで有効だったメンバーのみのため、エラーにはなりません。
+	trimmed, _ := baggage.New(kept...)
+	return trimmed, len(members) - len(kept)
+}
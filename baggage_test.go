@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"dice/spantest"
+)
+
+func TestBaggageLimitMiddleware(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	tests := []struct {
+		name        string
+		maxMembers  int
+		maxBytes    int
+		wantMembers int
+	}{
+		{name: "within limits", maxMembers: 8, maxBytes: 1024, wantMembers: 5},
+		{name: "too many members", maxMembers: 3, maxBytes: 1024, wantMembers: 3},
+		// 各メンバーは"kN=vN"の5バイトで、区切りのカンマを含めて2つまで収まります。
+		{name: "too many bytes", maxMembers: 8, maxBytes: 11, wantMembers: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got baggage.Baggage
+			h := baggageLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = baggage.FromContext(r.Context())
+			}), tt.maxMembers, tt.maxBytes)
+
+			req := httptest.NewRequest(http.MethodGet, "/rolldice", nil)
+			req.Header.Set("baggage", "k1=v1,k2=v2,k3=v3,k4=v4,k5=v5")
+			spans, _ := serveTraced(t, h, req)
+
+			if got.Len() != tt.wantMembers {
+				t.Errorf("baggage = %q, want %d members", got.String(), tt.wantMembers)
+			}
+			if len(got.String()) > tt.maxBytes {
+				t.Errorf("baggage is %d bytes, want at most %d", len(got.String()), tt.maxBytes)
+			}
+
+			server := spantest.AssertSpanExists(t, spans, "server")
+			trimmed := findEvent(server, "baggage.trimmed")
+			if tt.wantMembers == 5 {
+				if trimmed != nil {
+					t.Error("baggage.trimmed recorded for baggage within limits")
+				}
+				return
+			}
+			if trimmed == nil {
+				t.Fatal("baggage.trimmed event not recorded")
+			}
+			for _, kv := range trimmed.Attributes {
+				if kv.Key == "baggage.members.dropped" && kv.Value != attribute.IntValue(5-tt.wantMembers) {
+					t.Errorf("baggage.members.dropped = %s, want %d", kv.Value.Emit(), 5-tt.wantMembers)
+				}
+			}
+		})
+	}
+}
+
+// findEventは、spanのnameという名前のイベントを返します。ない場合はnilを返します。
+func findEvent(span tracetest.SpanStub, name string) *trace.Event {
+	for i, e := range span.Events {
+		if e.Name == name {
+			return &span.Events[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxBatchBodyBytesは、/rolldice/{player}/batchで読み取るボディのサイズの上限です。
+const maxBatchBodyBytes = 64 << 10
+
+// rolldiceBatchは、POSTのボディに1行ずつ書かれたNdM形式の指定をまとめて振ります。
+// 結果は指定と同じ順に、1行に1つずつ"3 5 2 = 10"の形式で返します。空行は無視します。
+//
+// 不正な要求を検知できるよう、読み取ったボディのサイズをサイコロの総数で割った値を
+// dice.request.bytes_per_rollとして記録します。
+func (h *diceHandler) rolldiceBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "roll.batch")
+	defer span.End()
+	batchStart := time.Now()
+
+	locale := detectLocale(r)
+	span.SetAttributes(attribute.String("http.locale", locale.String()))
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	leave, ok := h.enterDrain(ctx, w, locale)
+	if !ok {
+		return
+	}
+	defer leave()
+
+	player, err := sanitizePlayer(r.PathValue("player"), h.playerMaxLength)
+	if err != nil {
+		h.fail(ctx, w, locale, http.StatusBadRequest, "invalid_player")
+		return
+	}
+	if player != "" {
+		span.SetAttributes(attribute.String("player.name", player))
+		AddSpanAttr(ctx, attribute.String("player.name", player))
+		ctx = WithLogField(ctx, "player.name", player)
+	}
+
+	// Content-Lengthは省略や偽装ができるため、実際に読み取ったバイト数を使います。
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.fail(ctx, w, locale, http.StatusRequestEntityTooLarge, "batch_too_large")
+		}
+		// それ以外の場合は、ボディの受信中にクライアントが切断しました。
+		return
+	}
+
+	type spec struct{ count, sides int }
+	var specs []spec
+	total := 0
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		notation := strings.TrimSpace(sc.Text())
+		if notation == "" {
+			continue
+		}
+		count, sides, err := parseDice(notation)
+		if err != nil {
+			h.fail(ctx, w, locale, http.StatusBadRequest, "invalid_dice")
+			return
+		}
+		specs = append(specs, spec{count: count, sides: sides})
+		total += count
+	}
+	if total > h.maxDice {
+		h.fail(ctx, w, locale, http.StatusBadRequest, "too_many_dice")
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("dice.batch.size", len(specs)),
+		attribute.Int("dice.count", total),
+	)
+	h.recordBytesPerRoll(ctx, int64(len(body)), total)
+
+	span.SetAttributes(attribute.String("dice.rng", h.rng))
+	var resp strings.Builder
+	for i, s := range specs {
+		// 指定ごとに出目を追えるよう、/rolldice/{player}と同じrollスパンを子スパンとして記録します。
+		rollCtx, rollSpan := h.tracer.Start(ctx, "roll", trace.WithAttributes(
+			attribute.Int("dice.batch.index", i),
+			attribute.Int("dice.count", s.count),
+			attribute.Int("dice.sides", s.sides)))
+		rolls, sum := h.roll(rollCtx, rollSpan, s.count, s.sides)
+		rollSpan.SetAttributes(
+			attribute.IntSlice("dice.rolls", rolls),
+			attribute.Int("dice.sum", sum))
+		rollSpan.End()
+		strs := make([]string, len(rolls))
+		for i, roll := range rolls {
+			strs[i] = strconv.Itoa(roll)
+		}
+		resp.WriteString(strings.Join(strs, " ") + " = " + strconv.Itoa(sum) + "\n")
+	}
+	h.logger.InfoContext(ctx, "Rolling a batch of dice", "specs", len(specs), "dice", total)
+	AddServerTiming(ctx, "roll", time.Since(batchStart))
+	if _, err := io.WriteString(w, resp.String()); err != nil {
+		log.Printf("Write failed: %v\n", err)
+	}
+}
+
+// recordBytesPerRollは、リクエストのボディのサイズをサイコロの数で割った値を記録します。
+// 空のバッチなどでサイコロの数が0の場合は、0で割らないよう記録しません。
+func (h *diceHandler) recordBytesPerRoll(ctx context.Context, bodySize int64, count int) {
+	if count <= 0 {
+		return
+	}
+	h.bytesPerRoll.Record(ctx, float64(bodySize)/float64(count))
+}
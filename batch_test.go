@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"dice/spantest"
+)
+
+func TestRolldiceBatch(t *testing.T) {
+	cfg := newTestConfig(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestDiceHandler(t, cfg, tp, nil)
+	h.intn = func(int) int { return 2 }
+
+	req := httptest.NewRequest(http.MethodPost, "/rolldice/alice/batch", strings.NewReader("3d6\n\n1d20\n"))
+	req.SetPathValue("player", "alice")
+	rec := httptest.NewRecorder()
+	h.rolldiceBatch(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%q)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got, want := rec.Body.String(), "3 3 3 = 9\n3 = 3\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	spans := exporter.GetSpans()
+	batch := spantest.AssertSpanExists(t, spans, "roll.batch")
+	spantest.AssertAttribute(t, batch, "dice.batch.size", attribute.IntValue(2))
+	spantest.AssertAttribute(t, batch, "dice.count", attribute.IntValue(4))
+	var rolls int
+	for _, s := range spans {
+		if s.Name == "roll" {
+			rolls++
+			if s.Parent.SpanID() != batch.SpanContext.SpanID() {
+				t.Errorf("roll span parent = %s, want the batch span", s.Parent.SpanID())
+			}
+		}
+	}
+	if rolls != 2 {
+		t.Errorf("roll spans = %d, want one per specification", rolls)
+	}
+}
+
+func TestRolldiceBatchRejectsInvalidRequests(t *testing.T) {
+	t.Setenv("MAX_DICE", "5")
+	cfg := newTestConfig(t)
+	h := newTestDiceHandler(t, cfg, sdktrace.NewTracerProvider(), nil)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{name: "get", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "invalid notation", method: http.MethodPost, body: "3d6\nthree", want: http.StatusBadRequest},
+		{name: "too many dice in total", method: http.MethodPost, body: "3d6\n3d6", want: http.StatusBadRequest},
+		{name: "body too large", method: http.MethodPost, body: strings.Repeat("1d6\n", maxBatchBodyBytes/4+1), want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/rolldice/alice/batch", strings.NewReader(tt.body))
+			req.SetPathValue("player", "alice")
+			rec := httptest.NewRecorder()
+			h.rolldiceBatch(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%q)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBytesPerRollRecorded(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// wantはdice.request.bytes_per_rollに記録される値です。負の場合は記録されないことを表します。
+		want float64
+	}{
+		// 8バイトのボディで4個のサイコロを振ります。
+		{name: "batch", body: "3d6\n1d4\n", want: 2},
+		// サイコロが0個の場合は、0で割らずに記録を省略します。
+		{name: "empty batch", body: "\n\n", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			mp, reader := newTestMeterProvider(t, cfg)
+			h := newTestDiceHandler(t, cfg, sdktrace.NewTracerProvider(), mp)
+
+			// Content-Lengthに頼らず、読み取ったバイト数で計算されることを確かめます。
+			req := httptest.NewRequest(http.MethodPost, "/rolldice/alice/batch", strings.NewReader(tt.body))
+			req.ContentLength = -1
+			req.SetPathValue("player", "alice")
+			rec := httptest.NewRecorder()
+			h.rolldiceBatch(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (%q)", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			var points []metricdata.HistogramDataPoint[float64]
+			for _, sm := range collect(t, reader).ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name == "dice.request.bytes_per_roll" {
+						points = m.Data.(metricdata.Histogram[float64]).DataPoints
+					}
+				}
+			}
+			if tt.want < 0 {
+				if len(points) != 0 {
+					t.Errorf("data points = %v, want none for zero rolls", points)
+				}
+				return
+			}
+			if len(points) != 1 {
+				t.Fatalf("data points = %d, want 1", len(points))
+			}
+			if dp := points[0]; dp.Count != 1 || dp.Sum != tt.want {
+				t.Errorf("count = %d, sum = %v, want 1 record of %v", dp.Count, dp.Sum, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// bodyHashMiddlewareは、リクエストのボディのSHA-256をサーバースパンのhttp.request.body.sha256属性に記録します。
+// ボディはハンドラーが読み取るのに合わせて逐次ハッシュを計算するため、全体をバッファリングしません。
+// ハンドラーが読み残した部分は、終了後にmaxBytesまで読み進めてハッシュに含めます。
+// ボディがmaxBytesを超える場合や、Expect: 100-continueのリクエストでレスポンスの送信後に読み残しを読み取れない場合は、
+// ハッシュを記録しません。
+// タイムアウトしたハンドラーは戻った後も別のゴルーチンでボディを読み取る場合があるため、
+// 読み進める前にボディを切り離し、以降のハンドラーからの読み取りはエラーにします。
+func bodyHashMiddleware(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody || r.ContentLength > maxBytes {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := &hashingReader{ReadCloser: r.Body, hash: sha256.New(), limit: maxBytes}
+		r.Body = body
+		next.ServeHTTP(w, r)
+
+		sum, ok := body.finish()
+		if !ok {
+			return
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("http.request.body.sha256", hex.EncodeToString(sum)))
+	})
+}
+
+// hashingReaderは、読み取ったデータをlimitバイトまでハッシュに書き込むio.ReadCloserです。
+// limitを超えた後も、読み取り自体はそのまま続けられます。
+// 読み取りはmuで直列化するため、ハンドラーのゴルーチンとミドルウェアから同時に呼び出せます。
+type hashingReader struct {
+	io.ReadCloser
+	hash  hash.Hash
+	limit int64
+
+	mu       sync.Mutex
+	n        int64
+	detached bool
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.detached {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	return r.read(p)
+}
+
+// readは、ボディを読み取ってハッシュに書き込みます。r.muを保持して呼び出してください。
+func (r *hashingReader) read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.n <= r.limit {
+		r.hash.Write(p[:min(int64(n), r.limit-r.n)])
+	}
+	r.n += int64(n)
+	return n, err
+}
+
+// finishは、ボディをハンドラーから切り離し、読み残しを読み進めてハッシュを返します。
+// 読み残しはlimitを超えたと分かる1バイト先までのみ読み取ります。
+// ボディがlimitを超えた場合や読み取りに失敗した場合は、ok=falseを返します。
+func (r *hashingReader) finish() (sum []byte, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.detached = true
+	buf := make([]byte, 32*1024)
+	for r.n <= r.limit {
+		_, err := r.read(buf[:min(int64(len(buf)), r.limit-r.n+1)])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+	}
+	if r.n > r.limit {
+		return nil, false
+	}
+	return r.hash.Sum(nil), true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"dice/spantest"
+)
+
+func TestBodyHashMiddleware(t *testing.T) {
+	// "dice roll"のSHA-256です。
+	const wantHash = "dd717bfd1b755002b3b26f3b1e34447e9e33732541b98d2fb1c5070e1ef41129"
+
+	t.Run("known body", func(t *testing.T) {
+		// ハンドラーが一部しか読み取らなくても、ボディ全体のハッシュを記録します。
+		h := bodyHashMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.CopyN(w, r.Body, 4)
+		}), 64)
+		spans, rec := serveTraced(t, h, httptest.NewRequest(http.MethodPost, "/rolldice", strings.NewReader("dice roll")))
+		if rec.Body.String() != "dice" {
+			t.Errorf("handler read %q, want the start of the body", rec.Body.String())
+		}
+		server := spantest.AssertSpanExists(t, spans, "server")
+		spantest.AssertAttribute(t, server, "http.request.body.sha256", attribute.StringValue(wantHash))
+	})
+
+	t.Run("over the limit", func(t *testing.T) {
+		h := bodyHashMiddleware(okHandler, 4)
+		req := httptest.NewRequest(http.MethodPost, "/rolldice", strings.NewReader("dice roll"))
+		req.ContentLength = -1
+		spans, _ := serveTraced(t, h, req)
+		if hasAttribute(spantest.AssertSpanExists(t, spans, "server"), "http.request.body.sha256") {
+			t.Error("hash recorded for a body over the limit")
+		}
+	})
+
+	t.Run("timed out handler", func(t *testing.T) {
+		// タイムアウトしたハンドラーが後から読み取っても、ミドルウェアの読み取りと競合しません。
+		readErr := make(chan error, 1)
+		release := make(chan struct{})
+		h := bodyHashMiddleware(timeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			_, err := io.ReadAll(r.Body)
+			readErr <- err
+		}), 10*time.Millisecond), 64)
+		spans, rec := serveTraced(t, h, httptest.NewRequest(http.MethodPost, "/rolldice", strings.NewReader("dice roll")))
+		close(release)
+		if err := <-readErr; !errors.Is(err, http.ErrBodyReadAfterClose) {
+			t.Errorf("read after timeout = %v, want %v", err, http.ErrBodyReadAfterClose)
+		}
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+		}
+		server := spantest.AssertSpanExists(t, spans, "server")
+		spantest.AssertAttribute(t, server, "http.request.body.sha256", attribute.StringValue(wantHash))
+	})
+}
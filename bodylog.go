@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// errorBodyLogMiddlewareは、5xxのレスポンスを返したリクエストのボディをログに記録します。
+// Content-LengthがmaxBytes以下のリクエストのみを対象とし、redactFieldsに含まれるフィールドの値はマスクします。
+// ボディはバッファリングしたものに差し替えるため、ハンドラーは通常どおりボディを読み取れます。
+func errorBodyLogMiddleware(next http.Handler, logger *slog.Logger, maxBytes int64, redactFields []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil && r.ContentLength > 0 && r.ContentLength <= maxBytes {
+			b, err := io.ReadAll(io.LimitReader(r.Body, maxBytes))
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			body = b
+			r.Body = io.NopCloser(bytes.NewReader(b))
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if sw.status >= http.StatusInternalServerError && body != nil {
+			logger.ErrorContext(r.Context(), "Request failed",
+				"http.response.status_code", sw.status,
+				"http.request.body", redactBody(r.Header.Get("Content-Type"), body, redactFields))
+		}
+	})
+}
+
+// redactBodyは、JSONまたはフォーム形式のボディに含まれるfieldsの値をマスクした文字列を返します。
+// 解析できないボディやそれ以外の形式のボディは、機密情報を含む可能性があるため内容を記録せず、
+// 形式とサイズのみを返します。
+func redactBody(contentType string, body []byte, fields []string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return omittedBody(mediaType, body)
+		}
+		b, err := json.Marshal(redactJSON(v, fields))
+		if err != nil {
+			return omittedBody(mediaType, body)
+		}
+		return string(b)
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return omittedBody(mediaType, body)
+		}
+		for k := range values {
+			if isRedactedField(k, fields) {
+				values[k] = []string{redacted}
+			}
+		}
+		return values.Encode()
+	default:
+		return omittedBody(mediaType, body)
+	}
+}
+
+// omittedBodyは、内容を記録しないボディの代わりにログへ出力する文字列を返します。
+func omittedBody(mediaType string, body []byte) string {
+	if mediaType == "" {
+		mediaType = "unknown content type"
+	}
+	return fmt.Sprintf("[%d bytes of %s omitted]", len(body), mediaType)
+}
+
+func redactJSON(v any, fields []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if isRedactedField(k, fields) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(e, fields)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = redactJSON(e, fields)
+		}
+	}
+	return v
+}
+
+func isRedactedField(name string, fields []string) bool {
+	return slices.ContainsFunc(fields, func(f string) bool {
+		return strings.EqualFold(f, name)
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorBodyLogMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantLogged  string
+		notLogged   []string
+	}{
+		{
+			name:        "small body on error",
+			status:      http.StatusInternalServerError,
+			contentType: "application/json",
+			body:        `{"dice":"3d6","password":"hunter2"}`,
+			wantLogged:  `{\"dice\":\"3d6\",\"password\":\"REDACTED\"}`,
+			notLogged:   []string{"hunter2"},
+		},
+		{
+			name:        "large body on error",
+			status:      http.StatusInternalServerError,
+			contentType: "application/json",
+			body:        `{"dice":"3d6","padding":"` + strings.Repeat("x", 64) + `"}`,
+			notLogged:   []string{"Request failed"},
+		},
+		{
+			name:        "small body on success",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"dice":"3d6"}`,
+			notLogged:   []string{"Request failed"},
+		},
+		{
+			name:        "unparseable body",
+			status:      http.StatusInternalServerError,
+			contentType: "application/json",
+			body:        `{"password":"hunter2"`,
+			wantLogged:  "[21 bytes of application/json omitted]",
+			notLogged:   []string{"hunter2"},
+		},
+		{
+			name:        "unknown content type",
+			status:      http.StatusInternalServerError,
+			contentType: "text/plain",
+			body:        "password=hunter2",
+			wantLogged:  "[16 bytes of text/plain omitted]",
+			notLogged:   []string{"hunter2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+			var read string
+			h := errorBodyLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				read = string(b)
+				w.WriteHeader(tt.status)
+			}), logger, 48, []string{"password"})
+
+			req := httptest.NewRequest(http.MethodPost, "/rolldice", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if read != tt.body {
+				t.Errorf("handler read %q, want %q", read, tt.body)
+			}
+			out := buf.String()
+			if tt.wantLogged != "" && !strings.Contains(out, tt.wantLogged) {
+				t.Errorf("log = %q, want it to contain %q", out, tt.wantLogged)
+			}
+			for _, s := range tt.notLogged {
+				if strings.Contains(out, s) {
+					t.Errorf("log = %q, want it not to contain %q", out, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// circuitStateは、circuitBreakerExporterの状態です。
+type circuitState int
+
+const (
+	// circuitClosedは、通常どおりエクスポートする状態です。
+	circuitClosed circuitState = iota
+	// circuitOpenは、エクスポートを試みずにスパンを破棄する状態です。
+	circuitOpen
+	// circuitHalfOpenは、コレクターが復旧したかを1回のエクスポートで確かめている状態です。
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreakerExporterは、エクスポートがthreshold回続けて失敗した場合に、
+// cooldownの間エクスポートを試みずにスパンを破棄するSpanExporterです。
+// コレクターが停止し続けている間に、タイムアウトを待つエクスポートでリソースを消費し続けないようにします。
+// cooldownを過ぎると1回だけエクスポートを試み、成功すれば元に戻り、失敗すれば再びcooldownの間破棄します。
+type circuitBreakerExporter struct {
+	trace.SpanExporter
+	threshold int
+	cooldown  time.Duration
+	dropped   metric.Int64Counter
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// newCircuitBreakerExporterは、nextをcircuitBreakerExporterで包みます。
+// 破棄したスパンの数は、meterのotel.exporter.circuit_breaker.droppedに記録します。
+func newCircuitBreakerExporter(next trace.SpanExporter, threshold int, cooldown time.Duration, meter metric.Meter, logger *slog.Logger) (*circuitBreakerExporter, error) {
+	dropped, err := meter.Int64Counter("otel.exporter.circuit_breaker.dropped",
+		metric.WithDescription("The number of spans dropped while the export circuit breaker was open"),
+		metric.WithUnit("{span}"))
+	if err != nil {
+		return nil, err
+	}
+	return &circuitBreakerExporter{
+		SpanExporter: next,
+		threshold:    threshold,
+		cooldown:     cooldown,
+		dropped:      dropped,
+		logger:       logger,
+	}, nil
+}
+
+func (e *circuitBreakerExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	if !e.allow() {
+		e.dropped.Add(ctx, int64(len(spans)))
+		return nil
+	}
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.record(ctx, err)
+	return err
+}
+
+// allowは、エクスポートを試みてよいかどうかを返します。
+// cooldownを過ぎた開いた状態では、半開きの状態に移り、1回だけ許可します。
+func (e *circuitBreakerExporter) allow() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch e.state {
+	case circuitOpen:
+		if time.Since(e.openedAt) < e.cooldown {
+			return false
+		}
+		e.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// 確認中のエクスポートの結果が出るまでは破棄します。
+		return false
+	default:
+		return true
+	}
+}
+
+// recordは、エクスポートの結果に応じて状態を更新します。
+func (e *circuitBreakerExporter) record(ctx context.Context, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prev := e.state
+	if err == nil {
+		e.state, e.failures = circuitClosed, 0
+	} else {
+		e.failures++
+		if e.state == circuitHalfOpen || e.failures >= e.threshold {
+			e.state, e.openedAt = circuitOpen, time.Now()
+		}
+	}
+	if e.state != prev {
+		// 復旧はINFO、エクスポートを止める場合はWARNで記録します。
+		level := slog.LevelWarn
+		if e.state == circuitClosed {
+			level = slog.LevelInfo
+		}
+		e.logger.Log(ctx, level, "Span export circuit breaker changed state",
+			"from", prev.String(), "to", e.state.String(), "consecutive_failures", e.failures)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// switchableSpanExporterは、failがtrueの間エクスポートに失敗し、呼び出された回数を数えるSpanExporterです。
+type switchableSpanExporter struct {
+	mu    sync.Mutex
+	fail  bool
+	calls int
+}
+
+func (e *switchableSpanExporter) ExportSpans(context.Context, []trace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls++
+	if e.fail {
+		return errors.New("collector unavailable")
+	}
+	return nil
+}
+
+func (e *switchableSpanExporter) Shutdown(context.Context) error { return nil }
+
+// setFailは、以降のエクスポートが失敗するかどうかを切り替え、それまでの呼び出し回数を返します。
+func (e *switchableSpanExporter) setFail(fail bool) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fail = fail
+	return e.calls
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	ctx := context.Background()
+	inner := &switchableSpanExporter{fail: true}
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	breaker, err := newCircuitBreakerExporter(inner, 3, cooldown, mp.Meter(name), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := tracetest.SpanStubs{{Name: "roll"}, {Name: "roll"}}.Snapshots()
+
+	// 3回続けて失敗すると開き、以降はエクスポートを試みずに破棄します。
+	for range 3 {
+		if err := breaker.ExportSpans(ctx, spans); err == nil {
+			t.Fatal("ExportSpans() succeeded, want the collector error")
+		}
+	}
+	if err := breaker.ExportSpans(ctx, spans); err != nil {
+		t.Fatalf("ExportSpans() while open = %v, want nil", err)
+	}
+	if calls := inner.setFail(false); calls != 3 {
+		t.Errorf("exporter called %d times, want 3 before the breaker opened", calls)
+	}
+	dropped := findMetric(t, collect(t, reader), "otel.exporter.circuit_breaker.dropped").Data.(metricdata.Sum[int64])
+	if got := dropped.DataPoints[0].Value; got != 2 {
+		t.Errorf("dropped = %d, want 2", got)
+	}
+
+	// cooldownを過ぎると1回試み、成功すれば通常どおりエクスポートします。
+	time.Sleep(cooldown)
+	for range 2 {
+		if err := breaker.ExportSpans(ctx, spans); err != nil {
+			t.Fatalf("ExportSpans() after recovery = %v, want nil", err)
+		}
+	}
+	if calls := inner.setFail(false); calls != 5 {
+		t.Errorf("exporter called %d times, want 5 after the breaker closed", calls)
+	}
+}
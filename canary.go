@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// canaryProcessorは、すべてのスパンにcanary=true属性を記録するSpanProcessorです。
+// カナリアとしてデプロイしたインスタンスで有効にし、バックエンドでカナリアのトラフィックを絞り込めるようにします。
+type canaryProcessor struct{}
+
+var _ trace.SpanProcessor = canaryProcessor{}
+
+func (canaryProcessor) OnStart(_ context.Context, s trace.ReadWriteSpan) {
+	s.SetAttributes(attribute.Bool("canary", true))
+}
+
+func (canaryProcessor) OnEnd(trace.ReadOnlySpan) {}
+
+func (canaryProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (canaryProcessor) ForceFlush(context.Context) error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanaryAttribute(t *testing.T) {
+	for _, tt := range []struct {
+		canary string
+		want   bool
+	}{
+		{canary: "true", want: true},
+		{canary: "", want: false},
+	} {
+		t.Run("CANARY="+tt.canary, func(t *testing.T) {
+			t.Setenv("CANARY", tt.canary)
+			cfg := newTestConfig(t)
+			cfg.TracesOTLPFile = filepath.Join(t.TempDir(), "traces.jsonl")
+
+			ctx := context.Background()
+			res, err := newResource(ctx, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tp, err := newTracerProvider(ctx, cfg, res, nil, newSampler(cfg), slog.New(slog.NewTextHandler(io.Discard, nil)), &exportStats{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, span := tp.Tracer(name).Start(ctx, "roll")
+			span.End()
+			if err := tp.Shutdown(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := readOTLPFile(t, cfg.TracesOTLPFile)
+			if len(spans) != 1 {
+				t.Fatalf("spans = %+v, want the roll span", spans)
+			}
+			var got bool
+			for _, a := range spans[0].Attributes {
+				got = got || a.Key == "canary"
+			}
+			if got != tt.want {
+				t.Errorf("canary attribute present = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// configは、環境変数から読み込んだサービスの設定です。
+type config struct {
+	// ServiceNameは、リソースに設定するサービス名です。
+	// OTEL_SERVICE_NAMEが設定されていない場合は空です。
+	ServiceName string
+	// ServiceNameCheckは、リソースにservice.nameがない場合の扱いです。
+	// "off"の場合は確認せず、サービス名が設定されていなければdefaultServiceNameを使います。
+	// "drop"の場合はスパンを破棄し、"fail"の場合はさらに起動も失敗させます。
+	ServiceNameCheck string
+	// ServiceInstanceIDは、リソースに設定するservice.instance.idです。
+	// 空の場合は、プロセスごとに生成したUUIDを使用します。
+	ServiceInstanceID string
+	// ResourceFileは、リソースに追加する属性を記述したJSONファイルのパスです。空の場合は無効です。
+	// ファイルの属性はOTEL_RESOURCE_ATTRIBUTESより優先されますが、設定したサービス名とインスタンスIDは上書きしません。
+	ResourceFile string
+	// RuntimeResourceは、リソースにGoのバージョン（process.runtime.version）とOSの種類（os.type）を含めるかどうかです。
+	RuntimeResource bool
+	// SchemaURLは、リソースのスキーマURLです。デフォルトは使用しているセマンティック規約のものです。
+	SchemaURL string
+
+	// TelemetryModeは、テレメトリーの動作モードです（"prod"または"dev"）。
+	// "dev"では、コレクターのないローカル開発向けにスパンを記録しません。
+	TelemetryMode string
+
+	// TracesExporterは、トレースのエクスポート先です（"stdout"または"otlp"）。
+	TracesExporter string
+	// MetricsExporterは、定期的にプッシュするメトリクスのエクスポート先です（"stdout"または"otlp"）。
+	MetricsExporter string
+	// LogsExporterは、ログのエクスポート先です（"stdout"または"otlp"）。
+	LogsExporter string
+	// StdoutMaxWriteFailuresは、標準出力のエクスポーターが出力を破棄するようになるまでに許容する、連続した書き込みの失敗の回数です。
+	StdoutMaxWriteFailures int
+	// OTLPProtocolは、OTLPエクスポーターのプロトコルです（"grpc"、"http/protobuf"または"http/json"）。
+	// このサービスのエクスポーターはgRPCのみに対応しています。
+	OTLPProtocol string
+	// OTLPEndpointは、OTLPエクスポーターの送信先（host:port）です。
+	OTLPEndpoint string
+	// OTLPHeadersは、OTLPエクスポーターが送信時に付与するヘッダーです。
+	// 認証情報を含むことがあるため、外部に出力する際は必ずマスクしてください。
+	OTLPHeaders map[string]string
+	// OTLPSecondaryEndpointは、スパンを同時に送信する2つ目のOTLPの送信先（host:port）です。空の場合は無効です。
+	// ベンダーの移行中に、両方のコレクターへ同じスパンを送るために使います。
+	OTLPSecondaryEndpoint string
+	// OTLPSecondaryHeadersは、2つ目の送信先へ送信する際に付与するヘッダーです。
+	OTLPSecondaryHeaders map[string]string
+
+	// SpoolDirは、OTLPでの送信に失敗したスパンのバッチを退避するディレクトリです。空の場合は退避しません。
+	SpoolDir string
+	// SpoolMaxBatchesは、退避しておくバッチの最大数です。
+	SpoolMaxBatches int
+	// TracesOTLPFileは、送信されるスパンをOTLP/JSON形式で追記するファイルのパスです。空の場合は書き込みません。
+	// 通常のエクスポート先に加えて書き込むため、CIなどで送信内容を確認できます。
+	TracesOTLPFile string
+
+	// OTLPCompressionは、OTLPエクスポーターが送信時に使用する圧縮方式です（"none"または"gzip"）。
+	// CPUの負荷が増えるため、デフォルトは圧縮しません。
+	OTLPCompression string
+	// GRPCMaxSendMsgSizeは、OTLPエクスポーターがgRPCで送信するメッセージの最大バイト数です。
+	GRPCMaxSendMsgSize int
+	// CircuitBreakerThresholdは、スパンのエクスポートを止めるまでの連続した失敗の回数です。0の場合は無効です。
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldownは、エクスポートを止めてから再びエクスポートを試みるまでの時間です。
+	CircuitBreakerCooldown time.Duration
+	// MaxConcurrentExportsは、同時に実行するスパンのエクスポートの最大数です。0の場合は無制限です。
+	MaxConcurrentExports int
+	// ExportQueueTimeoutは、同時に実行するエクスポートが上限に達した際に空きを待機する最大時間です。
+	// 0の場合は待機せずにバッチを破棄します。
+	ExportQueueTimeout time.Duration
+	// RetryInitialIntervalは、OTLPのエクスポートが失敗した際に最初に再送するまでの待機時間です。
+	RetryInitialInterval time.Duration
+	// RetryMaxIntervalは、再送までの待機時間の上限です。
+	RetryMaxInterval time.Duration
+	// RetryMaxElapsedTimeは、最初の送信から再送を諦めるまでの時間です。
+	RetryMaxElapsedTime time.Duration
+
+	// SamplerRatioは、ルートスパンをサンプリングする割合（0〜1）です。
+	SamplerRatio float64
+	// SamplingRulesは、プレイヤー名ごとにルートスパンをサンプリングする割合のルールです。
+	// 一致するルールがない場合はSamplerRatioを使用します。
+	SamplingRules []samplingRule
+	// SamplingConfigURLは、サンプリングの割合をJSONで返す設定サービスのURLです。
+	// 設定した場合はSamplingConfigPollIntervalごとに取得し、SamplerRatioを上書きします。空の場合は無効です。
+	SamplingConfigURL string
+	// SamplingConfigPollIntervalは、サンプリングの設定を取得する間隔です。
+	SamplingConfigPollInterval time.Duration
+	// DefaultTraceStateKeyとDefaultTraceStateValueは、すべてのスパンのtracestateに設定するエントリーです。
+	// 上流から同じキーのエントリーが伝搬された場合は、そちらを優先します。空の場合は無効です。
+	DefaultTraceStateKey   string
+	DefaultTraceStateValue string
+	// VendorTraceStateは、上流からベンダーのエントリーが伝搬されなかったロールで、tracestateに設定するベンダーのエントリーの値です。
+	// 空の場合は設定しません。
+	VendorTraceState string
+	// SamplingAttributesは、ルートスパンにサンプリングの判断結果を属性として記録するかどうかです。
+	// SamplingRulesのいずれかに一致した場合は、一致したルールも記録します。
+	SamplingAttributes bool
+	// Canaryは、このインスタンスがカナリアとしてデプロイされており、すべてのスパンにcanary属性を記録するかどうかです。
+	Canary bool
+	// LogLevelは、出力するログの最小レベルです。
+	LogLevel slog.Level
+	// LogSeverityMapは、slogのレベルからOTelの重大度番号への対応です。nilの場合はブリッジの既定の対応を使用します。
+	LogSeverityMap map[slog.Level]otellog.Severity
+	// LogSampleRatioは、WARN未満のログを残す割合（0〜1）です。WARN以上のログはすべて残します。
+	LogSampleRatio float64
+	// LogQueueSizeは、ログを溜めておくキューの上限です。0の場合はSDKのバッチ処理を使用します。
+	LogQueueSize int
+	// LogQueuePolicyは、ログのキューが満杯の場合の方針です（"drop_oldest"または"drop_newest"）。
+	LogQueuePolicy string
+	// ExportSizeLoggingは、スパンのエクスポートごとに件数と推定サイズをDEBUGログに記録するかどうかです。
+	ExportSizeLogging bool
+	// SpanQueuePolicyは、スパンのキューが満杯の場合の方針です（"drop"または"block"）。
+	SpanQueuePolicy string
+	// SpanQueueBlockTimeoutは、"block"の場合にキューの空きを待機する最大時間です。
+	SpanQueueBlockTimeout time.Duration
+	// BatchTimeoutは、スパンをまとめてエクスポートする間隔です。
+	BatchTimeout time.Duration
+	// MetricIntervalは、メトリクスをエクスポートする間隔です。
+	MetricInterval time.Duration
+	// ExemplarFilterは、エグザンプラーを記録する値の選び方です（"trace_based"、"always_on"または"always_off"）。
+	ExemplarFilter string
+	// ExemplarReservoirSizeは、データポイントごとに保持するエグザンプラーの最大数です。
+	// 0の場合は、集計の種類に応じたSDKの既定の数を使用します。
+	ExemplarReservoirSize int
+	// MetricsAddrは、Prometheus用の/metricsを公開するアドレスです。空の場合は公開しません。
+	MetricsAddr string
+	// MetricResourceAttributesは、各データポイントの属性としても記録するリソースの属性のキーです。
+	MetricResourceAttributes []attribute.Key
+	// MetricDeltaInstrumentsは、デルタのテンポラリティでエクスポートする計装の名前のパターン（path.Matchの形式）です。
+	// 一致しない計装は累積でエクスポートします。
+	MetricDeltaInstruments []string
+
+	// GCPauseThresholdは、メトリクスに記録するGCの停止時間のしきい値です。0の場合は記録しません。
+	GCPauseThreshold time.Duration
+
+	// MaxSpanDurationは、スパンを強制的に終了させるまでの最大時間です。0の場合は無効です。
+	MaxSpanDuration time.Duration
+
+	// CollectorProbeは、起動時のコレクターへの疎通確認のモードです。
+	// "off"の場合は確認せず、"strict"の場合は到達できなければ起動を中止し、"lenient"の場合は警告のみ記録します。
+	CollectorProbe string
+	// CollectorProbeAttemptsは、疎通確認を試みる最大回数です。
+	CollectorProbeAttempts int
+	// CollectorProbeInitialBackoffは、疎通確認に失敗した際に最初に再試行するまでの待機時間です。
+	CollectorProbeInitialBackoff time.Duration
+	// CollectorProbeMaxBackoffは、疎通確認を再試行するまでの待機時間の上限です。
+	CollectorProbeMaxBackoff time.Duration
+	// StartupTelemetryCheckは、起動時にスパンを1つエクスポートし、失敗した場合に起動を中止するかどうかです。
+	StartupTelemetryCheck bool
+
+	// TLSCertFileとTLSKeyFileは、HTTPSで待ち受ける際の証明書と秘密鍵のファイルです。空の場合はHTTPで待ち受けます。
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSMinVersionは、HTTPSで受け付けるTLSの最小バージョンです。
+	TLSMinVersion uint16
+	// RequestTimeoutは、ハンドラーの処理時間の上限です。超えた場合は503を返します。0の場合は無制限です。
+	RequestTimeout time.Duration
+	// ServerTimingは、レスポンスにServer-Timingヘッダーを付与するかどうかです。
+	ServerTiming bool
+
+	// UserAgentAttributeは、サーバースパンにUser-Agentヘッダーを記録するかどうかです。
+	UserAgentAttribute bool
+	// UserAgentMaxLengthは、記録するUser-Agentの最大文字数です。
+	UserAgentMaxLength int
+
+	// RequiredHeaderは、すべてのリクエストに必須のヘッダーの名前です。
+	RequiredHeader string
+	// EnforceRequiredHeaderは、RequiredHeaderのないリクエストを401で拒否するかどうかです。
+	EnforceRequiredHeader bool
+
+	// QueryParamAttributesは、スパンの属性として記録するクエリパラメーターの名前です。
+	QueryParamAttributes []string
+	// QueryParamMaxLengthは、記録するクエリパラメーターの値の最大文字数です。
+	QueryParamMaxLength int
+	// RequestHeaderAttributesは、スパンの属性として記録するリクエストヘッダーの名前です。
+	RequestHeaderAttributes []string
+
+	// ErrorBodyLogMaxBytesは、5xxのレスポンスを返したリクエストのボディをログに記録する際の最大サイズです。
+	// 0の場合は記録しません。
+	ErrorBodyLogMaxBytes int64
+	// BodyHashMaxBytesは、SHA-256をスパンの属性として記録するリクエストのボディの最大サイズです。0の場合は無効です。
+	BodyHashMaxBytes int64
+	// ErrorBodyRedactFieldsは、ボディを記録する際に値をマスクするフィールドの名前です。
+	ErrorBodyRedactFields []string
+
+	// PlayerMaxLengthは、属性として記録するプレイヤー名の最大文字数です。
+	PlayerMaxLength int
+	// AnonymousPlayerは、/rolldice/のようにプレイヤー名のないリクエストで使うプレイヤー名です。
+	// 空の場合は、匿名のプレイヤーとして扱います。
+	AnonymousPlayer string
+	// AnonymousPlayerRedirectがtrueの場合、プレイヤー名のないリクエストを
+	// AnonymousPlayerの名前付きのルートにリダイレクトします。
+	AnonymousPlayerRedirect bool
+	// MaxDiceは、?dice=NdMで1回に振れるサイコロの最大数です。
+	MaxDice int
+	// RNGは、出目を決める乱数源です（"crypto"または"math"）。
+	RNG string
+
+	// IdempotencyTTLは、Idempotency-Keyごとの結果を保持する時間です。0の場合は無効です。
+	IdempotencyTTL time.Duration
+
+	// ConcurrencyLimitは、同時に処理するサイコロのロールの上限です。0の場合は無制限です。
+	ConcurrencyLimit int
+	// ConcurrencyWaitは、上限に達した場合に503を返さず、空きを待機するかどうかです。
+	ConcurrencyWait bool
+	// ConcurrencyWaitTimeoutは、空きを待機する最大時間です。
+	ConcurrencyWaitTimeout time.Duration
+
+	// BaggageMaxMembersとBaggageMaxBytesは、上流から受け入れるバゲージのメンバー数と合計バイト数の上限です。
+	// 超えた分は破棄します。
+	BaggageMaxMembers int
+	BaggageMaxBytes   int
+
+	// DebugEndpointsは、/debug/以下のエンドポイントを公開するかどうかです。
+	DebugEndpoints bool
+	// AdminEndpointsは、/admin/以下の運用向けのエンドポイントを公開するかどうかです。
+	AdminEndpoints bool
+	// FlakyEndpointは、一定の割合で失敗する/rolldice/flakyを公開するかどうかです。アラートの検証に使用します。
+	// 有効にした場合、"flaky"という名前のプレイヤーのロールも/rolldice/flakyで処理されます。
+	FlakyEndpoint bool
+	// FlakySeedは、/rolldice/flakyで失敗させるかを決める乱数のシードです。0の場合は起動ごとに異なります。
+	FlakySeed int64
+
+	// SpanAttributeProcessorsは、エクスポートする前にスパンの属性へ順に適用する処理です。
+	SpanAttributeProcessors []SpanAttributeProcessor
+	// SemconvCompatは、HTTPのセマンティック規約の属性の記録方法です。
+	// "stable"の場合は安定版の名前のみ、"dup"の場合は移行前の名前でも記録します。
+	SemconvCompat string
+	// AttributeNamingは、命名規則に従わない属性のキーの扱いです（"off"、"warn"または"rename"）。
+	AttributeNaming string
+	// AttributeValueMaxLengthは、エクスポートするスパンの文字列の属性の最大文字数です。0の場合は切り詰めません。
+	AttributeValueMaxLength int
+
+	// SpanDropKeyとSpanDropValueは、エクスポートせずに破棄するスパンの属性（またはバゲージ）です。
+	// SpanDropKeyが空の場合、フィルタリングは無効です。
+	SpanDropKey   string
+	SpanDropValue string
+}
+
+// loadConfigは、環境変数から設定を読み込みます。
+// CONFIG_FILEが設定されている場合、そのファイルに書かれた値が環境変数より優先されます。
+func loadConfig() (config, error) {
+	var (
+		cfg config
+		p   envParser
+	)
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		p.file = file
+	}
+	cfg.ServiceName = p.string("OTEL_SERVICE_NAME", "")
+	// 本番環境で既定のサービス名のままテレメトリーを送信しないよう、明示的な指定を必須にできます。
+	if cfg.ServiceName == "" && p.bool("REQUIRE_SERVICE_NAME", false) {
+		p.fail("OTEL_SERVICE_NAME", errors.New("must be set when REQUIRE_SERVICE_NAME is true"))
+	}
+	cfg.ServiceNameCheck = p.string("SERVICE_NAME_CHECK", "off")
+	switch cfg.ServiceNameCheck {
+	case "off", "drop", "fail":
+	default:
+		p.fail("SERVICE_NAME_CHECK", fmt.Errorf("unsupported mode %q", cfg.ServiceNameCheck))
+	}
+	cfg.ServiceInstanceID = p.string("OTEL_SERVICE_INSTANCE_ID", "")
+	cfg.ResourceFile = p.string("RESOURCE_FILE", "")
+	cfg.RuntimeResource = p.bool("RESOURCE_RUNTIME_ATTRIBUTES", false)
+	cfg.SchemaURL = p.string("RESOURCE_SCHEMA_URL", semconv.SchemaURL)
+	cfg.TelemetryMode = p.string("TELEMETRY_MODE", "prod")
+	switch cfg.TelemetryMode {
+	case "prod", "dev":
+	default:
+		p.fail("TELEMETRY_MODE", fmt.Errorf("unsupported mode %q", cfg.TelemetryMode))
+	}
+	cfg.TracesExporter = p.string("OTEL_TRACES_EXPORTER", "stdout")
+	switch cfg.TracesExporter {
+	case "stdout", "otlp":
+	default:
+		p.fail("OTEL_TRACES_EXPORTER", fmt.Errorf("unsupported exporter %q", cfg.TracesExporter))
+	}
+	cfg.MetricsExporter = p.string("OTEL_METRICS_EXPORTER", "stdout")
+	switch cfg.MetricsExporter {
+	case "stdout", "otlp":
+	default:
+		p.fail("OTEL_METRICS_EXPORTER", fmt.Errorf("unsupported exporter %q", cfg.MetricsExporter))
+	}
+	cfg.LogsExporter = p.string("OTEL_LOGS_EXPORTER", "stdout")
+	switch cfg.LogsExporter {
+	case "stdout", "otlp":
+	default:
+		p.fail("OTEL_LOGS_EXPORTER", fmt.Errorf("unsupported exporter %q", cfg.LogsExporter))
+	}
+	cfg.StdoutMaxWriteFailures = p.int("STDOUT_EXPORTER_MAX_WRITE_FAILURES", 3)
+	if cfg.StdoutMaxWriteFailures <= 0 {
+		p.fail("STDOUT_EXPORTER_MAX_WRITE_FAILURES", fmt.Errorf("must be positive, got %d", cfg.StdoutMaxWriteFailures))
+	}
+	cfg.OTLPProtocol = p.string("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	switch cfg.OTLPProtocol {
+	case "grpc", "http/protobuf", "http/json":
+	default:
+		p.fail("OTEL_EXPORTER_OTLP_PROTOCOL", fmt.Errorf("unsupported protocol %q", cfg.OTLPProtocol))
+	}
+	cfg.OTLPEndpoint = p.string("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4317")
+	if endpoint, err := normalizeEndpoint(cfg.OTLPEndpoint, cfg.OTLPProtocol); err != nil {
+		p.fail("OTEL_EXPORTER_OTLP_ENDPOINT", err)
+	} else {
+		cfg.OTLPEndpoint = endpoint
+	}
+	cfg.OTLPHeaders = p.keyValues("OTEL_EXPORTER_OTLP_HEADERS")
+	if endpoint, ok := p.lookup("OTEL_EXPORTER_OTLP_SECONDARY_ENDPOINT"); ok {
+		if endpoint, err := normalizeEndpoint(endpoint, cfg.OTLPProtocol); err != nil {
+			p.fail("OTEL_EXPORTER_OTLP_SECONDARY_ENDPOINT", err)
+		} else {
+			cfg.OTLPSecondaryEndpoint = endpoint
+		}
+	}
+	cfg.OTLPSecondaryHeaders = p.keyValues("OTEL_EXPORTER_OTLP_SECONDARY_HEADERS")
+	cfg.OTLPCompression = p.string("OTEL_EXPORTER_OTLP_COMPRESSION", "none")
+	switch cfg.OTLPCompression {
+	case "none", "gzip":
+	default:
+		p.fail("OTEL_EXPORTER_OTLP_COMPRESSION", fmt.Errorf("unsupported compression %q", cfg.OTLPCompression))
+	}
+	cfg.GRPCMaxSendMsgSize = p.int("OTEL_EXPORTER_OTLP_GRPC_MAX_SEND_MSG_SIZE", 16<<20)
+	if cfg.GRPCMaxSendMsgSize <= 0 {
+		p.fail("OTEL_EXPORTER_OTLP_GRPC_MAX_SEND_MSG_SIZE", fmt.Errorf("must be positive, got %d", cfg.GRPCMaxSendMsgSize))
+	}
+	cfg.CircuitBreakerThreshold = p.int("CIRCUIT_BREAKER_THRESHOLD", 0)
+	cfg.CircuitBreakerCooldown = p.millis("CIRCUIT_BREAKER_COOLDOWN", 30*time.Second)
+	switch {
+	case cfg.CircuitBreakerThreshold < 0:
+		p.fail("CIRCUIT_BREAKER_THRESHOLD", fmt.Errorf("must not be negative, got %d", cfg.CircuitBreakerThreshold))
+	case cfg.CircuitBreakerCooldown <= 0:
+		p.fail("CIRCUIT_BREAKER_COOLDOWN", fmt.Errorf("must be positive, got %v", cfg.CircuitBreakerCooldown))
+	}
+	cfg.MaxConcurrentExports = p.int("MAX_CONCURRENT_EXPORTS", 0)
+	cfg.ExportQueueTimeout = p.millis("EXPORT_QUEUE_TIMEOUT", 5*time.Second)
+	switch {
+	case cfg.MaxConcurrentExports < 0:
+		p.fail("MAX_CONCURRENT_EXPORTS", fmt.Errorf("must not be negative, got %d", cfg.MaxConcurrentExports))
+	case cfg.ExportQueueTimeout < 0:
+		p.fail("EXPORT_QUEUE_TIMEOUT", fmt.Errorf("must not be negative, got %v", cfg.ExportQueueTimeout))
+	}
+	cfg.RetryInitialInterval = p.millis("OTLP_RETRY_INITIAL_INTERVAL", 5*time.Second)
+	cfg.RetryMaxInterval = p.millis("OTLP_RETRY_MAX_INTERVAL", 30*time.Second)
+	cfg.RetryMaxElapsedTime = p.millis("OTLP_RETRY_MAX_ELAPSED_TIME", time.Minute)
+	switch {
+	case cfg.RetryInitialInterval <= 0:
+		p.fail("OTLP_RETRY_INITIAL_INTERVAL", fmt.Errorf("must be positive, got %v", cfg.RetryInitialInterval))
+	case cfg.RetryMaxInterval < cfg.RetryInitialInterval:
+		p.fail("OTLP_RETRY_MAX_INTERVAL", fmt.Errorf("must not be less than OTLP_RETRY_INITIAL_INTERVAL, got %v", cfg.RetryMaxInterval))
+	}
+	cfg.SpoolDir = p.string("OTLP_SPOOL_DIR", "")
+	cfg.SpoolMaxBatches = p.int("OTLP_SPOOL_MAX_BATCHES", 100)
+	if cfg.SpoolMaxBatches <= 0 {
+		p.fail("OTLP_SPOOL_MAX_BATCHES", fmt.Errorf("must be positive, got %d", cfg.SpoolMaxBatches))
+	}
+	cfg.TracesOTLPFile = p.string("TRACES_OTLP_FILE", "")
+	cfg.SamplerRatio = p.float("OTEL_TRACES_SAMPLER_ARG", 1)
+	if cfg.SamplerRatio < 0 || cfg.SamplerRatio > 1 {
+		p.fail("OTEL_TRACES_SAMPLER_ARG", fmt.Errorf("ratio %v out of range [0, 1]", cfg.SamplerRatio))
+	}
+	cfg.SamplingConfigURL = p.string("SAMPLING_CONFIG_URL", "")
+	cfg.SamplingConfigPollInterval = p.millis("SAMPLING_CONFIG_POLL_INTERVAL", 30*time.Second)
+	if cfg.SamplingConfigPollInterval <= 0 {
+		p.fail("SAMPLING_CONFIG_POLL_INTERVAL", fmt.Errorf("must be positive, got %v", cfg.SamplingConfigPollInterval))
+	}
+	if specs := p.list("SAMPLING_RULES"); specs != nil {
+		rules, err := parseSamplingRules(specs)
+		if err != nil {
+			p.fail("SAMPLING_RULES", err)
+		}
+		cfg.SamplingRules = rules
+	}
+	cfg.DefaultTraceStateKey, cfg.DefaultTraceStateValue = p.keyValue("DEFAULT_TRACESTATE")
+	if cfg.DefaultTraceStateKey != "" {
+		if _, err := (trace.TraceState{}).Insert(cfg.DefaultTraceStateKey, cfg.DefaultTraceStateValue); err != nil {
+			p.fail("DEFAULT_TRACESTATE", err)
+		}
+	}
+	cfg.VendorTraceState = p.string("VENDOR_TRACESTATE", "")
+	if cfg.VendorTraceState != "" {
+		if _, err := (trace.TraceState{}).Insert(vendorTraceStateKey, cfg.VendorTraceState); err != nil {
+			p.fail("VENDOR_TRACESTATE", err)
+		}
+	}
+	cfg.SamplingAttributes = p.bool("SAMPLING_ATTRIBUTES", false)
+	cfg.Canary = p.bool("CANARY", false)
+	cfg.LogLevel = p.level("LOG_LEVEL", slog.LevelInfo)
+	if pairs := p.keyValues("LOG_SEVERITY_MAP"); pairs != nil {
+		m, err := parseSeverityMap(pairs)
+		if err != nil {
+			p.fail("LOG_SEVERITY_MAP", err)
+		}
+		cfg.LogSeverityMap = m
+	}
+	cfg.LogSampleRatio = p.float("LOG_SAMPLE_RATIO", 1)
+	if cfg.LogSampleRatio < 0 || cfg.LogSampleRatio > 1 {
+		p.fail("LOG_SAMPLE_RATIO", fmt.Errorf("ratio %v out of range [0, 1]", cfg.LogSampleRatio))
+	}
+	if cfg.LogSampleRatio < 1 && cfg.LogSeverityMap != nil {
+		if err := checkSamplingSeverities(cfg.LogSeverityMap); err != nil {
+			p.fail("LOG_SEVERITY_MAP", err)
+		}
+	}
+	cfg.LogQueueSize = p.int("LOG_QUEUE_SIZE", 0)
+	if cfg.LogQueueSize < 0 {
+		p.fail("LOG_QUEUE_SIZE", fmt.Errorf("must not be negative, got %d", cfg.LogQueueSize))
+	}
+	cfg.LogQueuePolicy = p.string("LOG_QUEUE_POLICY", dropOldest)
+	switch cfg.LogQueuePolicy {
+	case dropOldest, dropNewest:
+	default:
+		p.fail("LOG_QUEUE_POLICY", fmt.Errorf("unsupported policy %q", cfg.LogQueuePolicy))
+	}
+	cfg.ExportSizeLogging = p.bool("EXPORT_SIZE_LOGGING", false)
+	cfg.SpanQueuePolicy = p.string("SPAN_QUEUE_POLICY", "drop")
+	switch cfg.SpanQueuePolicy {
+	case "drop", "block":
+	default:
+		p.fail("SPAN_QUEUE_POLICY", fmt.Errorf("unsupported policy %q", cfg.SpanQueuePolicy))
+	}
+	cfg.SpanQueueBlockTimeout = p.millis("SPAN_QUEUE_BLOCK_TIMEOUT", time.Second)
+	// デフォルトは5秒です。デモ用に1秒に設定しています。
+	cfg.BatchTimeout = p.millis("OTEL_BSP_SCHEDULE_DELAY", time.Second)
+	// デフォルトは1分です。デモ用に3秒に設定しています。
+	cfg.MetricInterval = p.millis("OTEL_METRIC_EXPORT_INTERVAL", 3*time.Second)
+	cfg.ExemplarFilter = p.string("OTEL_METRICS_EXEMPLAR_FILTER", "trace_based")
+	switch cfg.ExemplarFilter {
+	case "trace_based", "always_on", "always_off":
+	default:
+		p.fail("OTEL_METRICS_EXEMPLAR_FILTER", fmt.Errorf("unsupported filter %q", cfg.ExemplarFilter))
+	}
+	if _, ok := p.lookup("METRIC_EXEMPLAR_RESERVOIR_SIZE"); ok {
+		cfg.ExemplarReservoirSize = p.int("METRIC_EXEMPLAR_RESERVOIR_SIZE", 0)
+		if cfg.ExemplarReservoirSize <= 0 {
+			p.fail("METRIC_EXEMPLAR_RESERVOIR_SIZE", fmt.Errorf("must be positive, got %d", cfg.ExemplarReservoirSize))
+		}
+	}
+	cfg.GCPauseThreshold = p.millis("GC_PAUSE_THRESHOLD", 0)
+	cfg.MaxSpanDuration = p.millis("MAX_SPAN_DURATION", 0)
+	cfg.CollectorProbe = p.string("COLLECTOR_PROBE", "off")
+	switch cfg.CollectorProbe {
+	case "off", "strict", "lenient":
+	default:
+		p.fail("COLLECTOR_PROBE", fmt.Errorf("unsupported mode %q", cfg.CollectorProbe))
+	}
+	cfg.CollectorProbeAttempts = p.int("COLLECTOR_PROBE_ATTEMPTS", 5)
+	cfg.CollectorProbeInitialBackoff = p.millis("COLLECTOR_PROBE_INITIAL_BACKOFF", 500*time.Millisecond)
+	cfg.CollectorProbeMaxBackoff = p.millis("COLLECTOR_PROBE_MAX_BACKOFF", 5*time.Second)
+	switch {
+	case cfg.CollectorProbeAttempts <= 0:
+		p.fail("COLLECTOR_PROBE_ATTEMPTS", fmt.Errorf("must be positive, got %d", cfg.CollectorProbeAttempts))
+	case cfg.CollectorProbeInitialBackoff <= 0:
+		p.fail("COLLECTOR_PROBE_INITIAL_BACKOFF", fmt.Errorf("must be positive, got %v", cfg.CollectorProbeInitialBackoff))
+	case cfg.CollectorProbeMaxBackoff < cfg.CollectorProbeInitialBackoff:
+		p.fail("COLLECTOR_PROBE_MAX_BACKOFF", fmt.Errorf("must not be less than COLLECTOR_PROBE_INITIAL_BACKOFF, got %v", cfg.CollectorProbeMaxBackoff))
+	}
+	cfg.StartupTelemetryCheck = p.bool("STARTUP_TELEMETRY_CHECK", false)
+	cfg.ServerTiming = p.bool("SERVER_TIMING", false)
+	cfg.TLSCertFile = p.string("TLS_CERT_FILE", "")
+	cfg.TLSKeyFile = p.string("TLS_KEY_FILE", "")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		p.fail("TLS_CERT_FILE", errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	switch v := p.string("TLS_MIN_VERSION", "1.2"); v {
+	case "1.0":
+		cfg.TLSMinVersion = tls.VersionTLS10
+	case "1.1":
+		cfg.TLSMinVersion = tls.VersionTLS11
+	case "1.2":
+		cfg.TLSMinVersion = tls.VersionTLS12
+	case "1.3":
+		cfg.TLSMinVersion = tls.VersionTLS13
+	default:
+		p.fail("TLS_MIN_VERSION", fmt.Errorf("unsupported version %q", v))
+	}
+	cfg.RequestTimeout = p.millis("REQUEST_TIMEOUT", 0)
+	if cfg.RequestTimeout < 0 {
+		p.fail("REQUEST_TIMEOUT", fmt.Errorf("must not be negative, got %v", cfg.RequestTimeout))
+	}
+	cfg.UserAgentAttribute = p.bool("USER_AGENT_ATTRIBUTE", false)
+	cfg.UserAgentMaxLength = p.int("USER_AGENT_MAX_LENGTH", 256)
+	if cfg.UserAgentMaxLength <= 0 {
+		p.fail("USER_AGENT_MAX_LENGTH", fmt.Errorf("must be positive, got %d", cfg.UserAgentMaxLength))
+	}
+	cfg.RequiredHeader = p.string("REQUIRED_HEADER", "X-Api-Key")
+	cfg.EnforceRequiredHeader = p.bool("ENFORCE_REQUIRED_HEADER", false)
+	cfg.QueryParamAttributes = p.list("QUERY_PARAM_ATTRIBUTES")
+	cfg.QueryParamMaxLength = p.int("QUERY_PARAM_MAX_LENGTH", 128)
+	if cfg.QueryParamMaxLength <= 0 {
+		p.fail("QUERY_PARAM_MAX_LENGTH", fmt.Errorf("must be positive, got %d", cfg.QueryParamMaxLength))
+	}
+	cfg.RequestHeaderAttributes = p.list("REQUEST_HEADER_ATTRIBUTES")
+	cfg.ErrorBodyLogMaxBytes = int64(p.int("ERROR_BODY_LOG_MAX_BYTES", 0))
+	if cfg.ErrorBodyLogMaxBytes < 0 {
+		p.fail("ERROR_BODY_LOG_MAX_BYTES", fmt.Errorf("must not be negative, got %d", cfg.ErrorBodyLogMaxBytes))
+	}
+	cfg.BodyHashMaxBytes = int64(p.int("BODY_HASH_MAX_BYTES", 0))
+	if cfg.BodyHashMaxBytes < 0 {
+		p.fail("BODY_HASH_MAX_BYTES", fmt.Errorf("must not be negative, got %d", cfg.BodyHashMaxBytes))
+	}
+	cfg.ErrorBodyRedactFields = p.list("ERROR_BODY_REDACT_FIELDS")
+	if cfg.ErrorBodyRedactFields == nil {
+		cfg.ErrorBodyRedactFields = []string{"password", "token", "secret"}
+	}
+	cfg.PlayerMaxLength = p.int("PLAYER_MAX_LENGTH", 64)
+	if cfg.PlayerMaxLength <= 0 {
+		p.fail("PLAYER_MAX_LENGTH", fmt.Errorf("must be positive, got %d", cfg.PlayerMaxLength))
+	}
+	if name := p.string("ANONYMOUS_PLAYER", ""); name != "" {
+		// リクエストのプレイヤー名と同じ検証を行います。
+		player, err := sanitizePlayer(name, cfg.PlayerMaxLength)
+		if err != nil {
+			p.fail("ANONYMOUS_PLAYER", err)
+		}
+		cfg.AnonymousPlayer = player
+	}
+	cfg.AnonymousPlayerRedirect = p.bool("ANONYMOUS_PLAYER_REDIRECT", false)
+	if cfg.AnonymousPlayerRedirect && cfg.AnonymousPlayer == "" {
+		p.fail("ANONYMOUS_PLAYER_REDIRECT", errors.New("requires ANONYMOUS_PLAYER"))
+	}
+	cfg.MaxDice = p.int("MAX_DICE", 100)
+	if cfg.MaxDice <= 0 {
+		p.fail("MAX_DICE", fmt.Errorf("must be positive, got %d", cfg.MaxDice))
+	}
+	cfg.RNG = p.string("DICE_RNG", "math")
+	switch cfg.RNG {
+	case "crypto", "math":
+	default:
+		p.fail("DICE_RNG", fmt.Errorf("unsupported source %q", cfg.RNG))
+	}
+	cfg.IdempotencyTTL = p.millis("IDEMPOTENCY_TTL", 0)
+	cfg.ConcurrencyLimit = p.int("CONCURRENCY_LIMIT", 0)
+	if cfg.ConcurrencyLimit < 0 {
+		p.fail("CONCURRENCY_LIMIT", fmt.Errorf("must not be negative, got %d", cfg.ConcurrencyLimit))
+	}
+	switch mode := p.string("CONCURRENCY_LIMIT_MODE", "reject"); mode {
+	case "reject":
+	case "wait":
+		cfg.ConcurrencyWait = true
+	default:
+		p.fail("CONCURRENCY_LIMIT_MODE", fmt.Errorf("unsupported mode %q", mode))
+	}
+	cfg.ConcurrencyWaitTimeout = p.millis("CONCURRENCY_WAIT_TIMEOUT", time.Second)
+	cfg.BaggageMaxMembers = p.int("BAGGAGE_MAX_MEMBERS", defaultBaggageMaxMembers)
+	if cfg.BaggageMaxMembers <= 0 {
+		p.fail("BAGGAGE_MAX_MEMBERS", fmt.Errorf("must be positive, got %d", cfg.BaggageMaxMembers))
+	}
+	cfg.BaggageMaxBytes = p.int("BAGGAGE_MAX_BYTES", defaultBaggageMaxBytes)
+	if cfg.BaggageMaxBytes <= 0 {
+		p.fail("BAGGAGE_MAX_BYTES", fmt.Errorf("must be positive, got %d", cfg.BaggageMaxBytes))
+	}
+	cfg.MetricsAddr = p.string("METRICS_ADDR", "")
+	for _, k := range p.list("METRIC_RESOURCE_ATTRIBUTES") {
+		cfg.MetricResourceAttributes = append(cfg.MetricResourceAttributes, attribute.Key(k))
+	}
+	cfg.MetricDeltaInstruments = p.list("METRIC_DELTA_INSTRUMENTS")
+	for _, pattern := range cfg.MetricDeltaInstruments {
+		if _, err := path.Match(pattern, ""); err != nil {
+			p.fail("METRIC_DELTA_INSTRUMENTS", fmt.Errorf("invalid pattern %q: %w", pattern, err))
+		}
+	}
+	cfg.DebugEndpoints = p.bool("ENABLE_DEBUG_ENDPOINTS", false)
+	cfg.AdminEndpoints = p.bool("ENABLE_ADMIN_ENDPOINTS", false)
+	cfg.FlakyEndpoint = p.bool("ENABLE_FLAKY_ENDPOINT", false)
+	cfg.FlakySeed = int64(p.int("FLAKY_SEED", 0))
+	cfg.SpanDropKey, cfg.SpanDropValue = p.keyValue("SPAN_DROP_ATTRIBUTE")
+	if specs := p.list("SPAN_ATTRIBUTE_PROCESSORS"); specs != nil {
+		processors, err := parseAttributeProcessors(specs)
+		if err != nil {
+			p.fail("SPAN_ATTRIBUTE_PROCESSORS", err)
+		}
+		cfg.SpanAttributeProcessors = processors
+	}
+	cfg.SemconvCompat = p.string("SEMCONV_COMPAT", "stable")
+	switch cfg.SemconvCompat {
+	case "stable", "dup":
+	default:
+		p.fail("SEMCONV_COMPAT", fmt.Errorf("unsupported mode %q", cfg.SemconvCompat))
+	}
+	cfg.AttributeNaming = p.string("ATTRIBUTE_NAMING", "off")
+	switch cfg.AttributeNaming {
+	case "off", "warn", "rename":
+	default:
+		p.fail("ATTRIBUTE_NAMING", fmt.Errorf("unsupported mode %q", cfg.AttributeNaming))
+	}
+	cfg.AttributeValueMaxLength = p.int("ATTRIBUTE_VALUE_MAX_LENGTH", 0)
+	if cfg.AttributeValueMaxLength < 0 {
+		p.fail("ATTRIBUTE_VALUE_MAX_LENGTH", fmt.Errorf("must not be negative, got %d", cfg.AttributeValueMaxLength))
+	}
+	return cfg, p.err
+}
+
+// configWarningsは、起動はできるもののエクスポートが失敗する可能性の高い設定の組み合わせを検出し、
+// その内容を説明するメッセージを返します。
+func configWarnings(cfg config) []string {
+	if !usesOTLP(cfg) {
+		return nil
+	}
+
+	var warnings []string
+	if cfg.OTLPProtocol != "grpc" {
+		warnings = append(warnings, fmt.Sprintf(
+			"OTEL_EXPORTER_OTLP_PROTOCOL=%s is not supported, OTLP is exported over grpc", cfg.OTLPProtocol))
+	}
+	// 4318はOTLP/HTTPの既定のポートのため、gRPCで送信すると失敗します。
+	if port := endpointPort(cfg.OTLPEndpoint); port == "4318" {
+		warnings = append(warnings, fmt.Sprintf(
+			"OTEL_EXPORTER_OTLP_ENDPOINT=%s uses the OTLP/HTTP port 4318, but OTLP is exported over grpc (default port 4317)", cfg.OTLPEndpoint))
+	}
+	return warnings
+}
+
+// normalizeEndpointは、"http://host"、"host:4317"、"host"などの形式のエンドポイントを"host:port"に揃えます。
+// スキームとパスは取り除き、ポートがない場合はprotocolの既定のポート（gRPCは4317、HTTPは4318）を補います。
+func normalizeEndpoint(endpoint, protocol string) (string, error) {
+	defaultPort := "4317"
+	if protocol != "grpc" {
+		defaultPort = "4318"
+	}
+	// 角括弧のないIPv6アドレスは、URLとして解釈できないためそのままホストとして扱います。
+	if net.ParseIP(endpoint) != nil {
+		return net.JoinHostPort(endpoint, defaultPort), nil
+	}
+	s := endpoint
+	if !strings.Contains(s, "://") {
+		s = "//" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// endpointPortは、"host:port"またはURL形式のエンドポイントからポート番号を取り出します。
+func endpointPort(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		if u, err := url.Parse(endpoint); err == nil {
+			return u.Port()
+		}
+		return ""
+	}
+	_, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// readConfigFileは、"KEY=VALUE"形式の行からなる設定ファイルを読み込みます。
+// 空行と"#"で始まる行は無視します。
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	m := make(map[string]string)
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: invalid line %q", path, i+1, line)
+		}
+		m[strings.TrimSpace(k)] = v
+	}
+	return m, nil
+}
+
+// envParserは、環境変数の値を解析し、発生したエラーをまとめて保持します。
+// 未設定または空の環境変数にはデフォルト値を使用します。
+type envParser struct {
+	// fileは、環境変数より優先される設定ファイルの値です。
+	file map[string]string
+	err  error
+}
+
+func (p *envParser) fail(key string, err error) {
+	p.err = errors.Join(p.err, fmt.Errorf("%s: %w", key, err))
+}
+
+func (p *envParser) lookup(key string) (string, bool) {
+	v, ok := p.file[key]
+	if !ok {
+		v = os.Getenv(key)
+	}
+	v = strings.TrimSpace(v)
+	return v, v != ""
+}
+
+func (p *envParser) string(key, def string) string {
+	if v, ok := p.lookup(key); ok {
+		return v
+	}
+	return def
+}
+
+func (p *envParser) bool(key string, def bool) bool {
+	v, ok := p.lookup(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return b
+}
+
+func (p *envParser) int(key string, def int) int {
+	v, ok := p.lookup(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return n
+}
+
+func (p *envParser) float(key string, def float64) float64 {
+	v, ok := p.lookup(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return f
+}
+
+func (p *envParser) level(key string, def slog.Level) slog.Level {
+	v, ok := p.lookup(key)
+	if !ok {
+		return def
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(v)); err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return l
+}
+
+// millisは、ミリ秒単位の整数値を解析します。
+func (p *envParser) millis(key string, def time.Duration) time.Duration {
+	v, ok := p.lookup(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		p.fail(key, fmt.Errorf("invalid milliseconds %q", v))
+		return def
+	}
+	return time.Duration(n) * time.Millisecond
+}
+
+// listは、カンマ区切りの値を解析します。空の要素は無視します。
+func (p *envParser) list(key string) []string {
+	v, ok := p.lookup(key)
+	if !ok {
+		return nil
+	}
+	var l []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// keyValueは、"key=value"形式の値を解析します。未設定の場合は空文字列を返します。
+func (p *envParser) keyValue(key string) (string, string) {
+	v, ok := p.lookup(key)
+	if !ok {
+		return "", ""
+	}
+	k, val, ok := strings.Cut(v, "=")
+	if !ok || k == "" {
+		p.fail(key, fmt.Errorf("invalid key=value pair %q", v))
+		return "", ""
+	}
+	return strings.TrimSpace(k), strings.TrimSpace(val)
+}
+
+// keyValuesは、"k1=v1,k2=v2"形式の値を解析します。
+func (p *envParser) keyValues(key string) map[string]string {
+	v, ok := p.lookup(key)
+	if !ok {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			p.fail(key, fmt.Errorf("invalid key=value pair %q", pair))
+			continue
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	}
+	return m
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfigWarningsProtocolPortMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		endpoint string
+		want     string
+	}{
+		{name: "grpc to http port", exporter: "otlp", endpoint: "collector:4318", want: "4318"},
+		{name: "grpc to grpc port", exporter: "otlp", endpoint: "collector:4317"},
+		{name: "otlp not used", exporter: "stdout", endpoint: "collector:4318"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", tt.exporter)
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+
+			warnings := configWarnings(newTestConfig(t))
+			if tt.want == "" {
+				if len(warnings) != 0 {
+					t.Errorf("warnings = %q, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.want) {
+				t.Errorf("warnings = %q, want one mentioning %s", warnings, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		protocol string
+		want     string
+	}{
+		{endpoint: "collector", protocol: "grpc", want: "collector:4317"},
+		{endpoint: "collector", protocol: "http/protobuf", want: "collector:4318"},
+		{endpoint: "collector:4317", protocol: "grpc", want: "collector:4317"},
+		{endpoint: "collector:9000", protocol: "http/protobuf", want: "collector:9000"},
+		{endpoint: "http://collector", protocol: "grpc", want: "collector:4317"},
+		{endpoint: "https://collector", protocol: "http/protobuf", want: "collector:4318"},
+		{endpoint: "http://collector:4318/v1/traces", protocol: "http/protobuf", want: "collector:4318"},
+		{endpoint: "localhost:4317", protocol: "grpc", want: "localhost:4317"},
+		{endpoint: "127.0.0.1", protocol: "grpc", want: "127.0.0.1:4317"},
+		{endpoint: "::1", protocol: "grpc", want: "[::1]:4317"},
+		{endpoint: "[::1]:9000", protocol: "grpc", want: "[::1]:9000"},
+		{endpoint: "http://[::1]", protocol: "http/protobuf", want: "[::1]:4318"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint+" "+tt.protocol, func(t *testing.T) {
+			got, err := normalizeEndpoint(tt.endpoint, tt.protocol)
+			if err != nil {
+				t.Fatalf("normalizeEndpoint(%q, %q) failed: %v", tt.endpoint, tt.protocol, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeEndpoint(%q, %q) = %q, want %q", tt.endpoint, tt.protocol, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEndpointRejectsInvalid(t *testing.T) {
+	for _, endpoint := range []string{"", "http://", ":4317"} {
+		if got, err := normalizeEndpoint(endpoint, "grpc"); err == nil {
+			t.Errorf("normalizeEndpoint(%q) = %q, want an error", endpoint, got)
+		}
+	}
+}
+
+func TestRequireServiceName(t *testing.T) {
+	t.Setenv("REQUIRE_SERVICE_NAME", "true")
+
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	os.Unsetenv("OTEL_SERVICE_NAME")
+	_, err := loadConfig()
+	if err == nil || !strings.Contains(err.Error(), "OTEL_SERVICE_NAME") {
+		t.Errorf("loadConfig() without OTEL_SERVICE_NAME = %v, want an error naming it", err)
+	}
+
+	t.Setenv("OTEL_SERVICE_NAME", "dice-prod")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() with OTEL_SERVICE_NAME = %v, want nil", err)
+	}
+	if cfg.ServiceName != "dice-prod" {
+		t.Errorf("ServiceName = %q, want dice-prod", cfg.ServiceName)
+	}
+}
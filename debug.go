@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redactedは、秘匿すべき値を置き換える文字列です。
+const redacted = "REDACTED"
+
+// debugConfigは、/debug/configが返す設定の表現です。
+type debugConfig struct {
+	ServiceName     string            `json:"service_name"`
+	SchemaURL       string            `json:"schema_url"`
+	TelemetryMode   string            `json:"telemetry_mode"`
+	TracesExporter  string            `json:"traces_exporter"`
+	MetricsExporter string            `json:"metrics_exporter"`
+	LogsExporter    string            `json:"logs_exporter"`
+	OTLPEndpoint    string            `json:"otlp_endpoint"`
+	OTLPHeaders     map[string]string `json:"otlp_headers"`
+	Sampler         string            `json:"sampler"`
+	SamplerRatio    float64           `json:"sampler_ratio"`
+	LogLevel        string            `json:"log_level"`
+	BatchTimeout    string            `json:"batch_timeout"`
+	MetricInterval  string            `json:"metric_interval"`
+}
+
+// newDebugConfigは、OTLPヘッダーの値をマスクしたcfgの表現を返します。
+// サービス名には、OTEL_RESOURCE_ATTRIBUTESや既定の名前も考慮してresに設定された値を使います。
+// resがnilの場合は、cfgの値を使います。
+func newDebugConfig(cfg config, res *resource.Resource) debugConfig {
+	headers := make(map[string]string, len(cfg.OTLPHeaders))
+	for k := range cfg.OTLPHeaders {
+		headers[k] = redacted
+	}
+	serviceName := cfg.ServiceName
+	if res != nil {
+		v, _ := res.Set().Value(semconv.ServiceNameKey)
+		serviceName = v.AsString()
+	}
+	return debugConfig{
+		ServiceName:     serviceName,
+		SchemaURL:       cfg.SchemaURL,
+		TelemetryMode:   cfg.TelemetryMode,
+		TracesExporter:  cfg.TracesExporter,
+		MetricsExporter: cfg.MetricsExporter,
+		LogsExporter:    cfg.LogsExporter,
+		OTLPEndpoint:    cfg.OTLPEndpoint,
+		OTLPHeaders:     headers,
+		Sampler:         newSampler(cfg).Description(),
+		SamplerRatio:    cfg.SamplerRatio,
+		LogLevel:        cfg.LogLevel.String(),
+		BatchTimeout:    cfg.BatchTimeout.String(),
+		MetricInterval:  cfg.MetricInterval.String(),
+	}
+}
+
+// debugConfigHandlerは、現在有効な設定をJSONで返すハンドラーを返します。
+func debugConfigHandler(live *liveConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, newDebugConfig(live.config(), live.res.Load()))
+	}
+}
+
+// debugCollectMetricsHandlerは、readerでメトリクスを収集し、現在の値をJSONで返すハンドラーを返します。
+// エクスポートの間隔を待たずに値を確認できるため、結合テストで使用します。
+func debugCollectMetricsHandler(reader *metric.ManualReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(r.Context(), &rm); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, rm.ScopeMetrics)
+	}
+}
+
+// debugTraceは、/debug/traceが返すトレースコンテキストの表現です。
+type debugTrace struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+	Sampled bool   `json:"sampled"`
+}
+
+// debugTraceHandlerは、リクエストのサーバースパンのトレースIDとスパンID、サンプリングの有無をJSONで返します。
+// フロントエンドから送ったリクエストが、どのトレースとして記録されたかを確認するために使用します。
+func debugTraceHandler(w http.ResponseWriter, r *http.Request) {
+	sc := trace.SpanContextFromContext(r.Context())
+	writeJSON(w, debugTrace{
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+		Sampled: sc.IsSampled(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Write failed: %v\n", err)
+	}
+}
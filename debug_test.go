@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"dice/spantest"
+)
+
+func TestDebugConfigRedactsHeaders(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "dice-test")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret-value")
+	live := newLiveConfig(newTestConfig(t))
+
+	rec := httptest.NewRecorder()
+	debugConfigHandler(live)(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	if strings.Contains(rec.Body.String(), "secret-value") {
+		t.Fatalf("response leaks the header value: %s", rec.Body)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"service_name", "otlp_endpoint", "sampler", "batch_timeout", "metric_interval"} {
+		if _, ok := got[field]; !ok {
+			t.Errorf("field %q missing from %s", field, rec.Body)
+		}
+	}
+	if got["service_name"] != "dice-test" {
+		t.Errorf("service_name = %v, want dice-test", got["service_name"])
+	}
+	headers, _ := got["otlp_headers"].(map[string]any)
+	if headers["api-key"] != redacted {
+		t.Errorf("otlp_headers[api-key] = %v, want %s", headers["api-key"], redacted)
+	}
+}
+
+func TestDebugConfigReportsResolvedServiceName(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "unset uses the default name", want: defaultServiceName},
+		{name: "resource attributes", env: map[string]string{"OTEL_RESOURCE_ATTRIBUTES": "service.name=dice-attrs"}, want: "dice-attrs"},
+		{name: "service name", env: map[string]string{"OTEL_SERVICE_NAME": "dice-env"}, want: "dice-env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevTP, prevMP, prevLP := otel.GetTracerProvider(), otel.GetMeterProvider(), global.GetLoggerProvider()
+			t.Cleanup(func() {
+				otel.SetTracerProvider(prevTP)
+				otel.SetMeterProvider(prevMP)
+				global.SetLoggerProvider(prevLP)
+			})
+			t.Setenv("OTEL_SERVICE_NAME", "")
+			os.Unsetenv("OTEL_SERVICE_NAME")
+			// テレメトリーを送信しないモードでも、リソースは作成されます。
+			t.Setenv("TELEMETRY_MODE", "dev")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			live := newLiveConfig(newTestConfig(t))
+			shutdown, err := setupOTelSDK(context.Background(), live)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+			rec := httptest.NewRecorder()
+			debugConfigHandler(live)(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+			var got struct {
+				ServiceName string `json:"service_name"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ServiceName != tt.want {
+				t.Errorf("service_name = %q, want %q", got.ServiceName, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugEndpointsDisabledByDefault(t *testing.T) {
+	handler, err := newHTTPHandler(newLiveConfig(newTestConfig(t)), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDebugCollectMetricsReturnsCurrentValues(t *testing.T) {
+	cfg := newTestConfig(t)
+	mp, reader := newTestMeterProvider(t, cfg)
+	h := newTestDiceHandler(t, cfg, tracenoop.NewTracerProvider(), mp)
+
+	sum := 0
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+		req.SetPathValue("player", "alice")
+		rec := httptest.NewRecorder()
+		h.rolldice(rec, req)
+		roll, err := strconv.Atoi(strings.TrimSpace(rec.Body.String()))
+		if err != nil {
+			t.Fatalf("body = %q, want a roll", rec.Body.String())
+		}
+		sum += roll
+	}
+
+	rec := httptest.NewRecorder()
+	debugCollectMetricsHandler(reader)(rec, httptest.NewRequest(http.MethodGet, "/debug/collect-metrics", nil))
+	var scopes []struct {
+		Metrics []struct {
+			Name string
+			Data struct {
+				DataPoints []struct {
+					Value float64
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &scopes); err != nil {
+		t.Fatalf("response %s is not valid JSON: %v", rec.Body, err)
+	}
+	got := map[string]float64{}
+	for _, s := range scopes {
+		for _, m := range s.Metrics {
+			for _, dp := range m.Data.DataPoints {
+				got[m.Name] += dp.Value
+			}
+		}
+	}
+	if got["dice.rolls"] != 2 || got["dice.roll.value_sum"] != float64(sum) {
+		t.Errorf("dice.rolls = %v, dice.roll.value_sum = %v, want 2 and %d", got["dice.rolls"], got["dice.roll.value_sum"], sum)
+	}
+}
+
+func TestDebugTraceReturnsServerSpan(t *testing.T) {
+	spans, rec := serveTraced(t, http.HandlerFunc(debugTraceHandler), httptest.NewRequest(http.MethodGet, "/debug/trace", nil))
+
+	var got debugTrace
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	sc := spantest.AssertSpanExists(t, spans, "server").SpanContext
+	want := debugTrace{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String(), Sampled: true}
+	if got != want {
+		t.Errorf("/debug/trace = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+)
+
+// drainStateは、新しいロールの受け付けを止め、処理中のロールの完了を待つためのドレインの状態です。
+// ゼロダウンタイムでのデプロイ時に、ロードバランサーから外れる前のインスタンスで使用します。
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+	done     chan struct{}
+}
+
+// newDrainStateは、リクエストを受け付けている状態のdrainStateを返します。
+func newDrainState() *drainState {
+	return &drainState{done: make(chan struct{})}
+}
+
+// enterは、ドレイン中でなければ処理中のリクエストとして登録し、trueを返します。
+// trueを返した場合は、処理後にleaveを必ず呼び出してください。
+func (d *drainState) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.inFlight.Add(1)
+	return true
+}
+
+// leaveは、enterで登録したリクエストの処理が終わったことを記録します。
+func (d *drainState) leave() {
+	d.inFlight.Done()
+}
+
+// startは、ドレインを開始します。処理中のリクエストがすべて終わると、Doneが返すチャネルが閉じられます。
+// 既にドレイン中の場合は何もしません。
+func (d *drainState) start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return
+	}
+	d.draining = true
+	go func() {
+		d.inFlight.Wait()
+		close(d.done)
+	}()
+}
+
+// Doneは、ドレインが完了した際に閉じられるチャネルを返します。
+func (d *drainState) Done() <-chan struct{} {
+	return d.done
+}
+
+// adminDrainHandlerは、POSTされた際にドレインを開始するハンドラーを返します。
+// 以降のロールは503で拒否し、処理中のロールが終わった後にサーバーを停止します。
+func adminDrainHandler(drain *drainState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		log.Printf("Draining: rejecting new rolls and waiting for in-flight rolls to finish")
+		drain.start()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
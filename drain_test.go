@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestDrainFinishesInFlightRolls(t *testing.T) {
+	h := newTestDiceHandler(t, newTestConfig(t), tracenoop.NewTracerProvider(), nil)
+	h.drain = newDrainState()
+	// 処理中のロールは、releaseが閉じられるまで出目を決めずに待機します。
+	entered, release := make(chan struct{}), make(chan struct{})
+	h.intn = func(int) int {
+		close(entered)
+		<-release
+		return 0
+	}
+	roll := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+		req.SetPathValue("player", "alice")
+		rec := httptest.NewRecorder()
+		h.rolldice(rec, req)
+		return rec
+	}
+
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() { inFlight <- roll() }()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	adminDrainHandler(h.drain)(rec, httptest.NewRequest(http.MethodPost, "/admin/drain", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("drain status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if rec := roll(); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("new roll status = %d while draining, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	select {
+	case <-h.drain.Done():
+		t.Fatal("drain completed while a roll was in flight")
+	default:
+	}
+
+	close(release)
+	if rec := <-inFlight; rec.Code != http.StatusOK {
+		t.Errorf("in-flight roll status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	select {
+	case <-h.drain.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not complete after the in-flight roll finished")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+// startupCheckTimeoutは、起動時の確認でスパンのエクスポートを待機する最大時間です。
+const startupCheckTimeout = 5 * time.Second
+
+// runEmitTestTraceは、emit-test-traceサブコマンドを実行します。
+// コレクターへの疎通確認のため、テスト用のトレースを1つ送信して終了します。
+func runEmitTestTrace() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := emitTestTrace(ctx, cfg); err != nil {
+		return fmt.Errorf("failed to emit test trace: %w", err)
+	}
+	return nil
+}
+
+// emitTestTraceは、サービスと同じエクスポーターの設定でスパンを1つ送信し、エクスポートの結果を返します。
+func emitTestTrace(ctx context.Context, cfg config) (err error) {
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	diagLogger := newDiagLogger(cfg.LogLevel)
+
+	var conn *grpc.ClientConn
+	if cfg.TracesExporter == "otlp" {
+		conn, err = initConn(cfg, diagLogger)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, conn.Close())
+		}()
+	}
+	return exportTestSpan(ctx, cfg, res, conn, diagLogger, "emit-test-trace")
+}
+
+// checkTelemetryは、スパンを1つエクスポートし、エクスポートに成功したかを返します。
+// サービスの起動時に、テレメトリーのパイプラインが壊れていることを早期に検出するために使います。
+func checkTelemetry(ctx context.Context, cfg config, res *resource.Resource, conn *grpc.ClientConn, diagLogger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, startupCheckTimeout)
+	defer cancel()
+	return exportTestSpan(ctx, cfg, res, conn, diagLogger, "startup-check")
+}
+
+// exportTestSpanは、spanNameという名前のスパンを1つエクスポートし、エクスポートで発生したエラーを返します。
+// サービスと同じエクスポーターと属性の処理を使いますが、結果を確かめられるよう次の点が異なります。
+//   - サンプラーの設定にかかわらず、必ずサンプリングします。
+//   - スプールを使用せず、送信できなかった場合はそのエラーを返します。
+//   - サーキットブレーカーを使用せず、必ずエクスポートを試みます。
+func exportTestSpan(ctx context.Context, cfg config, res *resource.Resource, conn *grpc.ClientConn, diagLogger *slog.Logger, spanName string) error {
+	strict := cfg
+	strict.SpoolDir = ""
+	exporter, err := newTraceExporter(ctx, strict, conn)
+	if err != nil {
+		return err
+	}
+	exporter = wrapSpanContent(exporter, cfg, newSpanAttributeProcessors(cfg), diagLogger)
+	// エクスポートのエラーはグローバルなエラーハンドラーに渡されてしまうため、ここで捕捉します。
+	recorder := &errorRecordingExporter{SpanExporter: exporter}
+	tracerProvider := trace.NewTracerProvider(
+		trace.WithResource(res),
+		trace.WithSampler(trace.AlwaysSample()),
+		trace.WithSyncer(recorder),
+	)
+
+	_, span := tracerProvider.Tracer(name).Start(ctx, spanName)
+	span.End()
+
+	err = tracerProvider.Shutdown(ctx)
+	return errors.Join(recorder.Err(), err)
+}
+
+// errorRecordingExporterは、ExportSpansで発生したエラーを記録するSpanExporterです。
+type errorRecordingExporter struct {
+	trace.SpanExporter
+
+	mu  sync.Mutex
+	err error
+}
+
+func (e *errorRecordingExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		e.mu.Lock()
+		e.err = errors.Join(e.err, err)
+		e.mu.Unlock()
+	}
+	return err
+}
+
+// Errは、これまでに記録されたエラーを返します。
+func (e *errorRecordingExporter) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// traceReceiverは、受信したスパンの名前を記録するOTLPのモックのレシーバーです。
+type traceReceiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+	mu sync.Mutex
+	// failがtrueの場合、すべてのエクスポートを再送できないエラーで拒否します。
+	fail  bool
+	names []string
+}
+
+func (r *traceReceiver) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail {
+		return nil, status.Error(codes.InvalidArgument, "rejected")
+	}
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				r.names = append(r.names, s.Name)
+			}
+		}
+	}
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// spanNamesは、これまでに受信したスパンの名前を返します。
+func (r *traceReceiver) spanNames() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.names)
+}
+
+// startTraceReceiverは、recvをoptsのgRPCサーバーで待ち受け、OTLPでエクスポートする設定を返します。
+func startTraceReceiver(t testing.TB, recv coltracepb.TraceServiceServer, opts ...grpc.ServerOption) config {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(opts...)
+	coltracepb.RegisterTraceServiceServer(srv, recv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cfg := newTestConfig(t)
+	cfg.TracesExporter = "otlp"
+	cfg.OTLPEndpoint = lis.Addr().String()
+	return cfg
+}
+
+func TestEmitTestTrace(t *testing.T) {
+	recv := &traceReceiver{}
+	cfg := startTraceReceiver(t, recv)
+
+	if err := emitTestTrace(context.Background(), cfg); err != nil {
+		t.Fatalf("emitTestTrace() = %v, want nil", err)
+	}
+	if got := recv.spanNames(); !slices.Equal(got, []string{"emit-test-trace"}) {
+		t.Errorf("received spans = %v, want [emit-test-trace]", got)
+	}
+}
+
+func TestEmitTestTraceReportsExportFailure(t *testing.T) {
+	cfg := startTraceReceiver(t, &traceReceiver{fail: true})
+
+	if err := emitTestTrace(context.Background(), cfg); err == nil {
+		t.Error("emitTestTrace() = nil, want the export error")
+	}
+}
+
+func TestStartupTelemetryCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    bool
+		wantErr bool
+	}{
+		{name: "exported", fail: false, wantErr: false},
+		{name: "export fails", fail: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := otel.GetTracerProvider()
+			t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+			recv := &traceReceiver{fail: tt.fail}
+			cfg := startTraceReceiver(t, recv)
+			cfg.StartupTelemetryCheck = true
+			// サービスのサンプラーやスプール、サーキットブレーカーは、確認の結果に影響しません。
+			cfg.SamplerRatio = 0
+			cfg.SpoolDir = t.TempDir()
+			cfg.CircuitBreakerThreshold = 1
+
+			shutdown, err := setupOTelSDK(context.Background(), newLiveConfig(cfg))
+			if err == nil {
+				t.Cleanup(func() { _ = shutdown(context.Background()) })
+			}
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("setupOTelSDK() = %v, want error: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(recv.spanNames(), []string{"startup-check"}) {
+				t.Errorf("received spans = %v, want [startup-check]", recv.spanNames())
+			}
+		})
+	}
+}
+
+func TestEmitTestTraceIgnoresSpool(t *testing.T) {
+	cfg := startTraceReceiver(t, &traceReceiver{fail: true})
+	cfg.SpoolDir = t.TempDir()
+
+	if err := emitTestTrace(context.Background(), cfg); err == nil {
+		t.Error("emitTestTrace() = nil, want the export error even with a spool")
+	}
+}
+
+func TestSpoolReplaysAfterRecovery(t *testing.T) {
+	recv := &traceReceiver{fail: true}
+	cfg := startTraceReceiver(t, recv)
+	cfg.SpoolDir = t.TempDir()
+	conn, err := initConn(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	ctx := context.Background()
+	exporter, err := newTraceExporter(ctx, cfg, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = exporter.Shutdown(context.Background()) })
+
+	// コレクターの障害中に送信したスパンは、ディスクに退避されます。
+	if err := exporter.ExportSpans(ctx, tracetest.SpanStubs{{Name: "during-outage"}}.Snapshots()); !errors.Is(err, errBatchSpooled) {
+		t.Fatalf("ExportSpans() during outage = %v, want errBatchSpooled", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(cfg.SpoolDir, "*.pb")); len(files) != 1 {
+		t.Fatalf("spooled batches = %v, want 1", files)
+	}
+
+	// 復旧後の送信の成功をきっかけに、退避したスパンも再送されます。
+	recv.mu.Lock()
+	recv.fail = false
+	recv.mu.Unlock()
+	if err := exporter.ExportSpans(ctx, tracetest.SpanStubs{{Name: "after-recovery"}}.Snapshots()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		files, _ := filepath.Glob(filepath.Join(cfg.SpoolDir, "*.pb"))
+		if slices.Contains(recv.spanNames(), "during-outage") && len(files) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received spans = %v, spooled batches = %v, want the spooled span to be replayed and removed", recv.spanNames(), files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
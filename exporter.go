@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"google.golang.org/grpc"
+)
+
+// sizeLoggingExporterは、ExportSpansの呼び出しごとにスパンの数と推定サイズをDEBUGレベルで記録するSpanExporterです。
+// 大きなエクスポートの調査に使用します。
+type sizeLoggingExporter struct {
+	trace.SpanExporter
+	logger *slog.Logger
+}
+
+func (e *sizeLoggingExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	if e.logger.Enabled(ctx, slog.LevelDebug) {
+		size := 0
+		for _, s := range spans {
+			size += estimateSpanSize(s)
+		}
+		e.logger.DebugContext(ctx, "Exporting spans", "spans", len(spans), "estimated_bytes", size)
+	}
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+// dnsErrorExporterは、最初のエクスポートがエンドポイントの名前解決に失敗した場合に、
+// 設定を見直すよう促すエラーをログに記録するSpanExporterです。
+// gRPCのエラーメッセージだけでは、原因がホスト名の誤りだと分かりにくいため使用します。
+type dnsErrorExporter struct {
+	trace.SpanExporter
+	endpoint string
+	logger   *slog.Logger
+	checked  atomic.Bool
+}
+
+func (e *dnsErrorExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if !e.checked.Swap(true) && err != nil && isDNSError(err) {
+		e.logger.ErrorContext(ctx, "Cannot resolve the OTLP endpoint host, check OTEL_EXPORTER_OTLP_ENDPOINT",
+			"endpoint", e.endpoint, "error", err)
+	}
+	return err
+}
+
+// concurrencyLimitedExporterは、同時に実行するExportSpansの数をlimiterで制限するSpanExporterです。
+// エクスポートが集中した際に、送信中のバッチが保持するメモリーが増え続けないようにします。
+// 枠を獲得できなかったバッチは破棄し、エラーを返します。
+type concurrencyLimitedExporter struct {
+	trace.SpanExporter
+	limiter *concurrencyLimiter
+}
+
+func (e *concurrencyLimitedExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	acquired, _ := e.limiter.acquire(ctx)
+	if !acquired {
+		return fmt.Errorf("too many concurrent span exports, dropped %d spans", len(spans))
+	}
+	defer e.limiter.release()
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+// connClosingExporterは、シャットダウン時に専用のgRPCコネクションも閉じるSpanExporterです。
+type connClosingExporter struct {
+	trace.SpanExporter
+	conn *grpc.ClientConn
+}
+
+func (e *connClosingExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.conn.Close())
+}
+
+// serviceNameExporterは、リソースにservice.nameのないスパンをエクスポートせずに破棄するSpanExporterです。
+// バックエンドでサービスを特定できないスパンが送られないようにします。破棄したことは最初の1回のみ記録します。
+type serviceNameExporter struct {
+	trace.SpanExporter
+	logger *slog.Logger
+	logged atomic.Bool
+}
+
+func (e *serviceNameExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	kept := make([]trace.ReadOnlySpan, 0, len(spans))
+	for _, s := range spans {
+		if hasServiceName(s.Resource()) {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) < len(spans) && !e.logged.Swap(true) {
+		e.logger.WarnContext(ctx, "Dropping spans whose resource has no service.name",
+			"dropped", len(spans)-len(kept))
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return e.SpanExporter.ExportSpans(ctx, kept)
+}
+
+// hasServiceNameは、resに空でないservice.nameがあるかどうかを返します。
+// SDKがサービス名の代わりに設定する"unknown_service"で始まる名前は、ないものとして扱います。
+func hasServiceName(res *resource.Resource) bool {
+	v, ok := res.Set().Value(semconv.ServiceNameKey)
+	return ok && v.AsString() != "" && !strings.HasPrefix(v.AsString(), "unknown_service")
+}
+
+// isDNSErrorは、errが名前解決の失敗によるものかどうかを返します。
+// gRPCは名前解決のエラーをメッセージとしてのみ返すため、メッセージの内容でも判定します。
+func isDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "no such host") || strings.Contains(msg, "produced zero addresses")
+}
+
+// estimateSpanSizeは、スパンをエクスポートする際のおおよそのバイト数を返します。
+// 名前、ID、時刻、属性、イベント、リンクの大きさを合計したもので、エンコードによる差は考慮しません。
+func estimateSpanSize(s trace.ReadOnlySpan) int {
+	// トレースID(16)、スパンID(8)、親スパンID(8)、開始・終了時刻(8×2)。
+	size := len(s.Name()) + 16 + 8 + 8 + 16
+	size += attrsSize(s.Attributes())
+	for _, e := range s.Events() {
+		size += len(e.Name) + 8 + attrsSize(e.Attributes)
+	}
+	for _, l := range s.Links() {
+		size += 16 + 8 + attrsSize(l.Attributes)
+	}
+	return size
+}
+
+func attrsSize(attrs []attribute.KeyValue) int {
+	size := 0
+	for _, kv := range attrs {
+		size += len(kv.Key) + len(kv.Value.Emit())
+	}
+	return size
+}
+
+// resourceAttrExporterは、リソースの属性のうちkeysに含まれるものを、
+// 各データポイントの属性に追加してからエクスポートするmetric.Exporterです。
+// リソースの属性をメトリクスで扱えないバックエンド向けに使用します。
+// SDKのビューでは属性を追加できないため、エクスポートの直前に追加します。
+type resourceAttrExporter struct {
+	metric.Exporter
+	keys []attribute.Key
+}
+
+func (e *resourceAttrExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	var promoted []attribute.KeyValue
+	for _, k := range e.keys {
+		if v, ok := rm.Resource.Set().Value(k); ok {
+			promoted = append(promoted, attribute.KeyValue{Key: k, Value: v})
+		}
+	}
+	if len(promoted) > 0 {
+		for i := range rm.ScopeMetrics {
+			for j := range rm.ScopeMetrics[i].Metrics {
+				m := &rm.ScopeMetrics[i].Metrics[j]
+				m.Data = withAttributes(m.Data, promoted)
+			}
+		}
+	}
+	return e.Exporter.Export(ctx, rm)
+}
+
+// withAttributesは、dataの各データポイントの属性にattrsを追加したものを返します。
+// データポイントに同じキーの属性がある場合は、データポイントの値を優先します。
+// 指数ヒストグラムとサマリーはこのサービスでは使用しないため、そのまま返します。
+func withAttributes(data metricdata.Aggregation, attrs []attribute.KeyValue) metricdata.Aggregation {
+	switch d := data.(type) {
+	case metricdata.Sum[int64]:
+		addAttributes(d.DataPoints, attrs)
+	case metricdata.Sum[float64]:
+		addAttributes(d.DataPoints, attrs)
+	case metricdata.Gauge[int64]:
+		addAttributes(d.DataPoints, attrs)
+	case metricdata.Gauge[float64]:
+		addAttributes(d.DataPoints, attrs)
+	case metricdata.Histogram[int64]:
+		addHistogramAttributes(d.DataPoints, attrs)
+	case metricdata.Histogram[float64]:
+		addHistogramAttributes(d.DataPoints, attrs)
+	}
+	return data
+}
+
+func addAttributes[N int64 | float64](dps []metricdata.DataPoint[N], attrs []attribute.KeyValue) {
+	for i := range dps {
+		dps[i].Attributes = mergeAttributes(dps[i].Attributes, attrs)
+	}
+}
+
+func addHistogramAttributes[N int64 | float64](dps []metricdata.HistogramDataPoint[N], attrs []attribute.KeyValue) {
+	for i := range dps {
+		dps[i].Attributes = mergeAttributes(dps[i].Attributes, attrs)
+	}
+}
+
+// mergeAttributesは、setにattrsを追加した属性の集合を返します。setの値が優先されます。
+func mergeAttributes(set attribute.Set, attrs []attribute.KeyValue) attribute.Set {
+	// NewSetは同じキーのうち後の値を採用するため、setの属性を後に置きます。
+	kvs := make([]attribute.KeyValue, 0, len(attrs)+set.Len())
+	kvs = append(kvs, attrs...)
+	kvs = append(kvs, set.ToSlice()...)
+	return attribute.NewSet(kvs...)
+}
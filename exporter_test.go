@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSizeLoggingExporterLogsSpanCount(t *testing.T) {
+	var buf bytes.Buffer
+	inner := tracetest.NewInMemoryExporter()
+	exporter := &sizeLoggingExporter{
+		SpanExporter: inner,
+		logger:       slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	spans := tracetest.SpanStubs{{Name: "a"}, {Name: "b"}, {Name: "c"}}.Snapshots()
+	if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "spans=3") || !strings.Contains(out, "estimated_bytes=") {
+		t.Errorf("log = %q, want the span count and estimated size", out)
+	}
+	if got := len(inner.GetSpans()); got != 3 {
+		t.Errorf("forwarded %d spans, want 3", got)
+	}
+}
+
+func TestResourceAttrExporterPromotesAttributes(t *testing.T) {
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "dice"),
+		attribute.String("deployment.environment.name", "staging"),
+	)
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithResource(res), metric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	rolls, _ := mp.Meter(name).Int64Counter("dice.rolls")
+	rolls.Add(context.Background(), 1, otelmetric.WithAttributes(attribute.String("player", "alice")))
+	duration, _ := mp.Meter(name).Float64Histogram("dice.roll.duration")
+	duration.Record(context.Background(), 0.5)
+
+	capture := &captureMetricExporter{}
+	exporter := &resourceAttrExporter{Exporter: capture, keys: []attribute.Key{"deployment.environment.name", "cloud.region"}}
+	rm := collect(t, reader)
+	if err := exporter.Export(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := capture.exported[0]
+	sum := findMetric(t, exported, "dice.rolls").Data.(metricdata.Sum[int64])
+	want := attribute.NewSet(
+		attribute.String("player", "alice"),
+		attribute.String("deployment.environment.name", "staging"),
+	)
+	if got := sum.DataPoints[0].Attributes; !got.Equals(&want) {
+		t.Errorf("dice.rolls attributes = %v, want %v", got.ToSlice(), want.ToSlice())
+	}
+	hist := findMetric(t, exported, "dice.roll.duration").Data.(metricdata.Histogram[float64])
+	if v, ok := hist.DataPoints[0].Attributes.Value("deployment.environment.name"); !ok || v.AsString() != "staging" {
+		t.Errorf("dice.roll.duration attributes = %v, want deployment.environment.name=staging", hist.DataPoints[0].Attributes.ToSlice())
+	}
+}
+
+func TestDNSErrorExporterLogsFriendlyMessage(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.TracesExporter = "otlp"
+	// .invalidのドメインは、名前解決に必ず失敗します。
+	cfg.OTLPEndpoint = "collector.invalid:4317"
+	cfg.RetryInitialInterval = time.Millisecond
+	cfg.RetryMaxElapsedTime = 10 * time.Millisecond
+	conn, err := initConn(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	inner, err := newTraceExporter(context.Background(), cfg, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	exporter := &dnsErrorExporter{SpanExporter: inner, endpoint: cfg.OTLPEndpoint, logger: slog.New(slog.NewTextHandler(&buf, nil))}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := exporter.ExportSpans(ctx, tracetest.SpanStubs{{Name: "roll"}}.Snapshots()); err == nil {
+		t.Fatal("ExportSpans() = nil, want a name resolution error")
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "Cannot resolve the OTLP endpoint host") || !strings.Contains(out, "endpoint=collector.invalid:4317") {
+		t.Errorf("log = %q, want the friendly message with the endpoint", out)
+	}
+}
+
+func TestServiceNameExporterDropsUnnamedSpans(t *testing.T) {
+	var buf bytes.Buffer
+	inner := tracetest.NewInMemoryExporter()
+	exporter := &serviceNameExporter{SpanExporter: inner, logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	spans := tracetest.SpanStubs{
+		{Name: "named", Resource: resource.NewSchemaless(attribute.String("service.name", "dice"))},
+		{Name: "unnamed", Resource: resource.Empty()},
+		{Name: "unknown", Resource: resource.NewSchemaless(attribute.String("service.name", "unknown_service:dice"))},
+	}.Snapshots()
+	for range 2 {
+		if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, s := range inner.GetSpans() {
+		if s.Name != "named" {
+			t.Errorf("exported span %q, want only spans with a service.name", s.Name)
+		}
+	}
+	if n := strings.Count(buf.String(), "no service.name"); n != 1 {
+		t.Errorf("log = %q, want the drop logged once", buf.String())
+	}
+}
+
+// peakSpanExporterは、同時に実行されたエクスポートの最大数を記録するSpanExporterです。
+type peakSpanExporter struct {
+	current, peak atomic.Int32
+}
+
+func (e *peakSpanExporter) ExportSpans(context.Context, []trace.ReadOnlySpan) error {
+	n := e.current.Add(1)
+	defer e.current.Add(-1)
+	for {
+		p := e.peak.Load()
+		if n <= p || e.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return nil
+}
+
+func (e *peakSpanExporter) Shutdown(context.Context) error { return nil }
+
+func TestConcurrencyLimitedExporterCapsExports(t *testing.T) {
+	const limit = 2
+	inner := &peakSpanExporter{}
+	exporter := &concurrencyLimitedExporter{SpanExporter: inner, limiter: newConcurrencyLimiter(limit, true, 5*time.Second)}
+
+	spans := tracetest.SpanStubs{{Name: "roll"}}.Snapshots()
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := inner.peak.Load(); got > limit {
+		t.Errorf("peak concurrent exports = %d, want at most %d", got, limit)
+	}
+}
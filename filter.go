@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanFilterは、指定した属性を持つスパンをエクスポート前に破棄します。
+// 合成監視のトラフィックなど、バックエンドに送る必要のないスパンを取り除くために使います。
+//
+// 開始時点のバゲージと属性で一致したスパンは、samplerで包んだサンプラーがサンプリングしないため記録されません。
+// 記録されないスパンの子スパンは、親のサンプリングの結果に従うサンプラー（newSampler）により同じく記録されないため、
+// 親スパンがいつ終了したかによらず、子スパンも破棄されます。
+// サンプリングしないことは下流のサービスにも伝搬されるため、下流でも同じトレースは記録されません。
+//
+// 終了時点で設定された属性で一致したスパンは、wrapProcessorsで包んだスパンプロセッサー（バッチプロセッサーなど）に渡しません。
+// この場合、すでに開始した子スパンは破棄されないため、子スパンに確実に引き継ぎたい場合は、属性ではなくバゲージを使用してください。
+type spanFilter struct {
+	key   string
+	value string
+}
+
+// newSpanFilterは、key=valueに一致するスパンを破棄するspanFilterを返します。
+func newSpanFilter(key, value string) *spanFilter {
+	return &spanFilter{key: key, value: value}
+}
+
+// samplerは、開始時点で破棄対象のスパンをサンプリングせず、それ以外の判断をnextに委ねるサンプラーを返します。
+func (f *spanFilter) sampler(next trace.Sampler) trace.Sampler {
+	return &filteringSampler{filter: f, next: next}
+}
+
+// wrapProcessorsは、終了時点で破棄対象でないスパンのみをnextの各プロセッサーに渡すSpanProcessorを返します。
+// 同じスパンを複数のエクスポーターに送る場合も、判定が一致するよう1つのプロセッサーにまとめて包みます。
+func (f *spanFilter) wrapProcessors(next ...trace.SpanProcessor) trace.SpanProcessor {
+	return &filteringProcessor{filter: f, next: next}
+}
+
+func (f *spanFilter) matchBaggage(ctx context.Context) bool {
+	m := baggage.FromContext(ctx).Member(f.key)
+	return m.Key() != "" && m.Value() == f.value
+}
+
+func (f *spanFilter) matchAttrs(attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if string(kv.Key) == f.key && kv.Value.Emit() == f.value {
+			return true
+		}
+	}
+	return false
+}
+
+// filteringSamplerは、spanFilterに一致するスパンをサンプリングしないサンプラーです。
+type filteringSampler struct {
+	filter *spanFilter
+	next   trace.Sampler
+}
+
+func (s *filteringSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	res := s.next.ShouldSample(p)
+	if s.filter.matchBaggage(p.ParentContext) || s.filter.matchAttrs(p.Attributes) {
+		// tracestateはnextの結果を保ち、下流への伝搬に引き継ぎます。
+		res.Decision = trace.Drop
+		res.Attributes = nil
+	}
+	return res
+}
+
+func (s *filteringSampler) Description() string {
+	return fmt.Sprintf("SpanFilter{%s=%s,%s}", s.filter.key, s.filter.value, s.next.Description())
+}
+
+// filteringProcessorは、終了時点でspanFilterに一致するスパンをnextに渡さないSpanProcessorです。
+type filteringProcessor struct {
+	filter *spanFilter
+	next   []trace.SpanProcessor
+}
+
+var _ trace.SpanProcessor = (*filteringProcessor)(nil)
+
+func (p *filteringProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	for _, sp := range p.next {
+		sp.OnStart(parent, s)
+	}
+}
+
+func (p *filteringProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if p.filter.matchAttrs(s.Attributes()) {
+		return
+	}
+	for _, sp := range p.next {
+		sp.OnEnd(s)
+	}
+}
+
+func (p *filteringProcessor) Shutdown(ctx context.Context) error {
+	var err error
+	for _, sp := range p.next {
+		err = errors.Join(err, sp.Shutdown(ctx))
+	}
+	return err
+}
+
+func (p *filteringProcessor) ForceFlush(ctx context.Context) error {
+	var err error
+	for _, sp := range p.next {
+		err = errors.Join(err, sp.ForceFlush(ctx))
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanFilterDropsMatchingSpans(t *testing.T) {
+	first, second := tracetest.NewSpanRecorder(), tracetest.NewSpanRecorder()
+	filter := newSpanFilter("synthetic", "true")
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(filter.sampler(newSampler(newTestConfig(t)))),
+		trace.WithSpanProcessor(filter.wrapProcessors(first, second)))
+	tracer := tp.Tracer("test")
+	ctx := context.Background()
+
+	// 開始時の属性で一致したスパンと、その子スパン。
+	parentCtx, parent := tracer.Start(ctx, "synthetic-start", oteltrace.WithAttributes(attribute.Bool("synthetic", true)))
+	_, child := tracer.Start(parentCtx, "synthetic-child")
+	child.End()
+	parent.End()
+	_, s := tracer.Start(ctx, "synthetic-attr-at-start", oteltrace.WithAttributes(attribute.String("synthetic", "true")))
+	s.End()
+
+	// 終了時に設定された属性で一致したスパン。
+	_, s = tracer.Start(ctx, "synthetic-end")
+	s.SetAttributes(attribute.String("synthetic", "true"))
+	s.End()
+
+	// バゲージで一致したスパン。
+	member, err := baggage.NewMember("synthetic", "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, s = tracer.Start(baggage.ContextWithBaggage(ctx, bag), "synthetic-baggage")
+	s.End()
+
+	// 一致しないスパン。
+	_, s = tracer.Start(ctx, "real", oteltrace.WithAttributes(attribute.String("synthetic", "false")))
+	s.End()
+
+	for _, rec := range []*tracetest.SpanRecorder{first, second} {
+		ended := rec.Ended()
+		if len(ended) != 1 || ended[0].Name() != "real" {
+			names := make([]string, len(ended))
+			for i, s := range ended {
+				names[i] = s.Name()
+			}
+			t.Errorf("exported spans = %v, want [real]", names)
+		}
+	}
+}
+
+func TestSpanFilterDecidesBeforeBatching(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	filter := newSpanFilter("synthetic", "true")
+	// 即座にエクスポートするプロセッサーでも、終了時の属性で一致したスパンは渡されません。
+	tp := trace.NewTracerProvider(trace.WithSpanProcessor(filter.wrapProcessors(trace.NewSimpleSpanProcessor(exporter))))
+	_, s := tp.Tracer("test").Start(context.Background(), "late")
+	s.SetAttributes(attribute.String("synthetic", "true"))
+	s.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exporter.GetSpans()); n != 0 {
+		t.Errorf("exported %d spans, want 0", n)
+	}
+}
+
+func TestSpanFilterDropsChildrenEndingAfterParent(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	filter := newSpanFilter("synthetic", "true")
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(filter.sampler(newSampler(newTestConfig(t)))),
+		trace.WithSpanProcessor(filter.wrapProcessors(trace.NewSimpleSpanProcessor(exporter))))
+	tracer := tp.Tracer("test")
+
+	// 親スパンが先に終了しても、その後に開始・終了した子スパンは破棄されます。
+	parentCtx, parent := tracer.Start(context.Background(), "synthetic", oteltrace.WithAttributes(attribute.String("synthetic", "true")))
+	parent.End()
+	_, child := tracer.Start(parentCtx, "late-child")
+	child.End()
+
+	if n := len(exporter.GetSpans()); n != 0 {
+		t.Errorf("exported %d spans, want 0", n)
+	}
+	// 破棄したことは、サンプリングしないという形で下流にも伝搬されます。
+	if child.SpanContext().IsSampled() {
+		t.Error("child of a filtered span is sampled, want it to inherit the drop")
+	}
+	if !child.SpanContext().IsValid() || child.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Error("child of a filtered span lost the trace ID, want the trace to stay connected")
+	}
+}
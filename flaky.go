@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultFlakyErrorRateは、error_rateが指定されていない場合に/rolldice/flakyを失敗させる割合です。
+const defaultFlakyErrorRate = 0.5
+
+// flakySourceは、/rolldice/flakyで失敗させるかを決める、シードを指定できる乱数源です。
+// シードを固定すると、失敗するリクエストの並びを再現できます。
+type flakySource struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// newFlakySourceは、seedをシードとするflakySourceを返します。seedが0の場合は現在時刻を使用します。
+func newFlakySource(seed int64) *flakySource {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &flakySource{rand: rand.New(rand.NewSource(seed))}
+}
+
+// float64は、[0, 1)の乱数を返します。
+func (s *flakySource) float64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64()
+}
+
+// rolldiceFlakyは、?error_rateで指定した割合のリクエストを500で失敗させ、それ以外は通常どおりサイコロを振ります。
+// 失敗したリクエストは、通常のエラーと同じくスパンをエラーにし、エラー数に計上します。
+// ドレイン中は、通常のロールと同じく503を返します。
+func (h *diceHandler) rolldiceFlaky(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	locale := detectLocale(r)
+
+	leave, ok := h.enterDrain(ctx, w, locale)
+	if !ok {
+		return
+	}
+	defer leave()
+
+	rate := defaultFlakyErrorRate
+	if v := r.URL.Query().Get("error_rate"); v != "" {
+		var err error
+		rate, err = strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			h.fail(ctx, w, locale, http.StatusBadRequest, "invalid_error_rate")
+			return
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Float64("flaky.error_rate", rate))
+
+	if h.flaky.float64() < rate {
+		h.fail(ctx, w, locale, http.StatusInternalServerError, "flaky_failure")
+		return
+	}
+	h.rolldice(w, r)
+}
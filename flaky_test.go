@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRolldiceFlakyErrorRate(t *testing.T) {
+	t.Setenv("ENABLE_FLAKY_ENDPOINT", "true")
+	t.Setenv("FLAKY_SEED", "42")
+	cfg := newTestConfig(t)
+	mp, reader := newTestMeterProvider(t, cfg)
+	h := newTestDiceHandler(t, cfg, tracenoop.NewTracerProvider(), mp)
+
+	const requests = 1000
+	failed := 0
+	for range requests {
+		rec := httptest.NewRecorder()
+		h.rolldiceFlaky(rec, httptest.NewRequest(http.MethodGet, "/rolldice/flaky?error_rate=0.3", nil))
+		switch rec.Code {
+		case http.StatusInternalServerError:
+			failed++
+		case http.StatusOK:
+		default:
+			t.Fatalf("status = %d, want 200 or 500", rec.Code)
+		}
+	}
+	if failed < 250 || failed > 350 {
+		t.Errorf("%d of %d requests failed, want about 30%%", failed, requests)
+	}
+
+	var counted int64
+	for _, dp := range findMetric(t, collect(t, reader), "dice.errors").Data.(metricdata.Sum[int64]).DataPoints {
+		if v, _ := dp.Attributes.Value("error.type"); v.AsString() == "flaky_failure" {
+			counted = dp.Value
+		}
+	}
+	if counted != int64(failed) {
+		t.Errorf("dice.errors{error.type=flaky_failure} = %d, want %d", counted, failed)
+	}
+}
+
+func TestRolldiceFlakyRejectedWhileDraining(t *testing.T) {
+	t.Setenv("ENABLE_FLAKY_ENDPOINT", "true")
+	h := newTestDiceHandler(t, newTestConfig(t), tracenoop.NewTracerProvider(), nil)
+	h.drain = newDrainState()
+	h.drain.start()
+
+	rec := httptest.NewRecorder()
+	h.rolldiceFlaky(rec, httptest.NewRequest(http.MethodGet, "/rolldice/flaky?error_rate=0", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d while draining, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
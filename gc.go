@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// gcPollIntervalは、GCの停止時間を確認する間隔です。
+// ReadMemStatsは短時間すべてのゴルーチンを停止させるため、頻繁には呼び出しません。
+const gcPollInterval = time.Second
+
+// startGCPauseMonitorは、thresholdを超えたGCの停止時間をruntime.gc.long_pause.durationに記録するゴルーチンを起動します。
+// レイテンシーの急増とGCの相関を調べるために使用します。ゴルーチンはctxが終了すると停止します。
+func startGCPauseMonitor(ctx context.Context, meter metric.Meter, threshold time.Duration) error {
+	pauses, err := meter.Float64Histogram("runtime.gc.long_pause.duration",
+		metric.WithDescription("The duration of GC pauses exceeding the configured threshold"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	lastGC := stats.NumGC
+
+	go func() {
+		ticker := time.NewTicker(gcPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			runtime.ReadMemStats(&stats)
+			// PauseNsは直近256回分の循環バッファーのため、間隔内にそれより多くのGCが発生した場合は古いものを取りこぼします。
+			n := min(stats.NumGC-lastGC, uint32(len(stats.PauseNs)))
+			for i := range n {
+				pause := time.Duration(stats.PauseNs[(stats.NumGC-i+255)%256])
+				if pause > threshold {
+					pauses.Record(ctx, pause.Seconds())
+				}
+			}
+			lastGC = stats.NumGC
+		}
+	}()
+	return nil
+}
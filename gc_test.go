@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestGCPauseMonitorRecordsLongPauses(t *testing.T) {
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// すべての停止時間が閾値を超えるよう、最小の閾値を指定します。
+	if err := startGCPauseMonitor(ctx, mp.Meter(name), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	runtime.GC()
+
+	deadline := time.Now().Add(3 * gcPollInterval)
+	for {
+		rm := collect(t, reader)
+		if len(rm.ScopeMetrics) > 0 {
+			hist := findMetric(t, rm, "runtime.gc.long_pause.duration").Data.(metricdata.Histogram[float64])
+			if len(hist.DataPoints) > 0 && hist.DataPoints[0].Count > 0 {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("runtime.gc.long_pause.duration was not recorded after a forced GC")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
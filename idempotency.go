@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// idempotencyCacheは、Idempotency-Keyごとにロールの結果をttlの間保持します。
+// 再送されたリクエストに同じ結果を返すために使います。
+// 同じキーのリクエストが同時に届いた場合は、最初のリクエストがキーを予約し、残りはその結果を待ちます。
+type idempotencyCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	// readyは、結果が保存されるか予約が解除されると閉じられます。
+	ready chan struct{}
+	// doneは、結果が保存されたかどうかです。falseの間は処理中です。
+	done    bool
+	resp    string
+	expires time.Time
+}
+
+// newIdempotencyCacheは、結果をttlの間保持するidempotencyCacheを返します。
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:       ttl,
+		entries:   make(map[string]*idempotencyEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// reserveは、keyに対して保持しているレスポンスを返します。
+// 同じkeyのリクエストを処理中の場合は、その結果が保存されるかctxが終了するまで待機します。
+// 保持しているレスポンスがない場合はkeyを予約してhit=falseを返すため、
+// 呼び出し元はcompleteで結果を保存し、最後に必ずreleaseを呼び出してください。
+func (c *idempotencyCache) reserve(ctx context.Context, key string) (resp string, hit bool, err error) {
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		c.sweep(now)
+		e, ok := c.entries[key]
+		if !ok || (e.done && now.After(e.expires)) {
+			c.entries[key] = &idempotencyEntry{ready: make(chan struct{})}
+			c.mu.Unlock()
+			return "", false, nil
+		}
+		if e.done {
+			c.mu.Unlock()
+			return e.resp, true, nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-e.ready:
+			// 結果が保存されたか、予約が解除されたため、もう一度確認します。
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		}
+	}
+}
+
+// completeは、reserveで予約したkeyに対するレスポンスを保存し、待機しているリクエストに渡します。
+func (c *idempotencyCache) complete(key, resp string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.done {
+		return
+	}
+	e.done, e.resp, e.expires = true, resp, time.Now().Add(c.ttl)
+	close(e.ready)
+}
+
+// releaseは、reserveで予約したkeyの結果が保存されていない場合に、予約を解除します。
+// 待機しているリクエストのうち1つが、改めてkeyを予約します。
+func (c *idempotencyCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.done {
+		return
+	}
+	delete(c.entries, key)
+	close(e.ready)
+}
+
+// sweepは、期限切れのエントリーをttlごとにまとめて削除します。c.muを保持して呼び出してください。
+func (c *idempotencyCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) <= c.ttl {
+		return
+	}
+	for k, e := range c.entries {
+		if e.done && now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.lastSweep = now
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// rollWithKeyは、Idempotency-Keyをkeyとしてplayerのサイコロをdiceの指定で振り、レスポンスの本文を返します。
+func rollWithKey(h *diceHandler, player, dice, key string) string {
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/"+player+"?dice="+dice, nil)
+	req.SetPathValue("player", player)
+	req.Header.Set("Idempotency-Key", key)
+	rec := httptest.NewRecorder()
+	h.rolldice(rec, req)
+	return rec.Body.String()
+}
+
+// idempotentHitsは、rollスパンのidempotent.hit属性の値ごとの数を返します。
+func idempotentHits(spans tracetest.SpanStubs) map[bool]int {
+	hits := map[bool]int{}
+	for _, s := range spans {
+		for _, kv := range s.Attributes {
+			if kv.Key == "idempotent.hit" {
+				hits[kv.Value.AsBool()]++
+			}
+		}
+	}
+	return hits
+}
+
+func TestIdempotencyKeyReturnsSameRoll(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_TTL", "60000")
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+	first := rollWithKey(h, "alice", "5d20", "retry-1")
+	second := rollWithKey(h, "alice", "5d20", "retry-1")
+	if first != second {
+		t.Errorf("retried roll = %q, want the first roll %q", second, first)
+	}
+	if got := idempotentHits(exporter.GetSpans()); got[true] != 1 || got[false] != 1 {
+		t.Errorf("idempotent.hit = %v, want one miss then one hit", got)
+	}
+}
+
+func TestIdempotencyKeyScopedToPlayerAndDice(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_TTL", "60000")
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+	rollWithKey(h, "alice", "2d6", "shared")
+	rollWithKey(h, "bob", "2d6", "shared")
+	rollWithKey(h, "alice", "3d6", "shared")
+	if got := idempotentHits(exporter.GetSpans()); got[true] != 0 || got[false] != 3 {
+		t.Errorf("idempotent.hit = %v, want a miss for each player and dice", got)
+	}
+}
+
+func TestIdempotencyKeyConcurrentRequests(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_TTL", "60000")
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+	const n = 20
+	bodies := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = rollWithKey(h, "alice", "5d20", "burst")
+		}()
+	}
+	wg.Wait()
+
+	for i, b := range bodies {
+		if b != bodies[0] {
+			t.Errorf("response %d = %q, want %q", i, b, bodies[0])
+		}
+	}
+	// ロールを実行するのは、最初にキーを予約したリクエストのみです。
+	if got := idempotentHits(exporter.GetSpans()); got[false] != 1 || got[true] != n-1 {
+		t.Errorf("idempotent.hit = %v, want 1 miss and %d hits", got, n-1)
+	}
+	rolled := 0
+	for _, s := range exporter.GetSpans() {
+		if hasAttribute(s, "dice.rolls") {
+			rolled++
+		}
+	}
+	if rolled != 1 {
+		t.Errorf("rolled %d times, want 1", rolled)
+	}
+}
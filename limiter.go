@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// concurrencyLimiterは、同時に処理するリクエストの数を制限するセマフォです。
+type concurrencyLimiter struct {
+	sem chan struct{}
+	// waitがtrueの場合、上限に達していても最大timeoutまで空きを待機します。
+	wait    bool
+	timeout time.Duration
+}
+
+// newConcurrencyLimiterは、同時実行数をlimitに制限するconcurrencyLimiterを返します。
+func newConcurrencyLimiter(limit int, wait bool, timeout time.Duration) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		sem:     make(chan struct{}, limit),
+		wait:    wait,
+		timeout: timeout,
+	}
+}
+
+// acquireは、実行枠の獲得を試みます。
+// acquiredは枠を獲得できたかどうか、limitedは上限に達していたかどうかを示します。
+// 枠を獲得できた場合は、処理後にreleaseを必ず呼び出してください。
+func (l *concurrencyLimiter) acquire(ctx context.Context) (acquired, limited bool) {
+	select {
+	case l.sem <- struct{}{}:
+		return true, false
+	default:
+	}
+	if !l.wait {
+		return false, true
+	}
+
+	t := time.NewTimer(l.timeout)
+	defer t.Stop()
+	select {
+	case l.sem <- struct{}{}:
+		return true, true
+	case <-t.C:
+		return false, true
+	case <-ctx.Done():
+		return false, true
+	}
+}
+
+// releaseは、acquireで獲得した実行枠を解放します。
+func (l *concurrencyLimiter) release() {
+	<-l.sem
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestConcurrencyLimiterEnforcesCap(t *testing.T) {
+	const limit = 3
+	l := newConcurrencyLimiter(limit, true, 5*time.Second)
+
+	var current, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acquired, _ := l.acquire(context.Background())
+			if !acquired {
+				t.Error("acquire failed while waiting")
+				return
+			}
+			defer l.release()
+			n := current.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			current.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > limit {
+		t.Errorf("peak concurrency = %d, want at most %d", got, limit)
+	}
+}
+
+func TestConcurrencyLimiterRejects(t *testing.T) {
+	l := newConcurrencyLimiter(1, false, 0)
+	if acquired, limited := l.acquire(context.Background()); !acquired || limited {
+		t.Fatalf("first acquire = (%v, %v), want (true, false)", acquired, limited)
+	}
+	if acquired, limited := l.acquire(context.Background()); acquired || !limited {
+		t.Errorf("second acquire = (%v, %v), want (false, true)", acquired, limited)
+	}
+	l.release()
+	if acquired, _ := l.acquire(context.Background()); !acquired {
+		t.Error("acquire after release failed")
+	}
+}
+
+func TestConcurrencyLimiterWaitTimeout(t *testing.T) {
+	l := newConcurrencyLimiter(1, true, 20*time.Millisecond)
+	l.acquire(context.Background())
+	if acquired, limited := l.acquire(context.Background()); acquired || !limited {
+		t.Errorf("acquire while full = (%v, %v), want (false, true)", acquired, limited)
+	}
+}
+
+func TestWaitDurationRecordedUnderContention(t *testing.T) {
+	t.Setenv("CONCURRENCY_LIMIT", "1")
+	t.Setenv("CONCURRENCY_LIMIT_MODE", "wait")
+	t.Setenv("CONCURRENCY_WAIT_TIMEOUT", "5000")
+	cfg := newTestConfig(t)
+	mp, reader := newTestMeterProvider(t, cfg)
+	h := newTestDiceHandler(t, cfg, tracenoop.NewTracerProvider(), mp)
+
+	roll := func() {
+		req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+		req.SetPathValue("player", "alice")
+		rec := httptest.NewRecorder()
+		h.rolldice(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	}
+
+	// 空きがある場合は0を記録します。
+	roll()
+	// 枠を塞いだ状態では、解放されるまで待機した時間を記録します。
+	const hold = 20 * time.Millisecond
+	if acquired, _ := h.limiter.acquire(context.Background()); !acquired {
+		t.Fatal("could not acquire the only slot")
+	}
+	time.AfterFunc(hold, h.limiter.release)
+	roll()
+
+	dps := findMetric(t, collect(t, reader), "dice.wait.duration").Data.(metricdata.Histogram[int64]).DataPoints
+	if len(dps) != 1 || dps[0].Count != 2 {
+		t.Fatalf("data points = %+v, want one with 2 waits", dps)
+	}
+	if lo, _ := dps[0].Min.Value(); lo != 0 {
+		t.Errorf("min wait = %dms, want 0 for the uncontended request", lo)
+	}
+	if hi, _ := dps[0].Max.Value(); hi < hold.Milliseconds() {
+		t.Errorf("max wait = %dms, want at least %dms", hi, hold.Milliseconds())
+	}
+}
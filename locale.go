@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+// supportedLocalesは、レスポンスの表示に対応している言語です。先頭がデフォルトの言語です。
+var supportedLocales = []language.Tag{
+	language.English,
+	language.Japanese,
+}
+
+var localeMatcher = language.NewMatcher(supportedLocales)
+
+// messagesは、言語ごとのレスポンスのメッセージです。
+var messages = map[language.Tag]map[string]string{
+	language.English: {
+		"batch_too_large":         "batch request body is too large",
+		"concurrency_limited":     "too many concurrent rolls",
+		"draining":                "the server is shutting down",
+		"flaky_failure":           "simulated failure",
+		"invalid_dice":            "invalid dice notation, expected NdM such as 3d6",
+		"invalid_error_rate":      "invalid error rate, expected a number between 0 and 1",
+		"invalid_player":          "invalid player name",
+		"missing_required_header": "missing required header",
+		"request_timeout":         "request timed out",
+		"too_many_dice":           "too many dice",
+	},
+	language.Japanese: {
+		"batch_too_large":         "まとめて振る指定のボディが大きすぎます",
+		"concurrency_limited":     "同時に振られているサイコロが多すぎます",
+		"draining":                "サーバーを停止しています",
+		"flaky_failure":           "意図的に発生させたエラーです",
+		"invalid_dice":            "サイコロの指定が不正です（例: 3d6）",
+		"invalid_error_rate":      "エラーの割合が不正です（0〜1の数値を指定してください）",
+		"invalid_player":          "プレイヤー名が不正です",
+		"missing_required_header": "必須のヘッダーがありません",
+		"request_timeout":         "リクエストがタイムアウトしました",
+		"too_many_dice":           "サイコロの数が多すぎます",
+	},
+}
+
+// detectLocaleは、Accept-Languageヘッダーから対応している言語のうち最も適したものを選びます。
+// ヘッダーがない場合や、対応している言語がない場合は英語を返します。
+func detectLocale(r *http.Request) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(tags) == 0 {
+		return supportedLocales[0]
+	}
+	_, i, confidence := localeMatcher.Match(tags...)
+	if confidence == language.No {
+		return supportedLocales[0]
+	}
+	return supportedLocales[i]
+}
+
+// localizeは、keyに対応するlocaleのメッセージを返します。
+func localize(locale language.Tag, key string) string {
+	if msg, ok := messages[locale][key]; ok {
+		return msg
+	}
+	return messages[supportedLocales[0]][key]
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"dice/spantest"
+)
+
+func TestRolldiceLocale(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		wantLocale     string
+		wantBody       string
+	}{
+		{name: "matching", acceptLanguage: "ja-JP,ja;q=0.9,en;q=0.5", wantLocale: "ja", wantBody: "サイコロの指定が不正です（例: 3d6）"},
+		{name: "unsupported", acceptLanguage: "fr-FR,fr;q=0.9", wantLocale: "en", wantBody: "invalid dice notation, expected NdM such as 3d6"},
+		{name: "missing", wantLocale: "en", wantBody: "invalid dice notation, expected NdM such as 3d6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+			h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+			// エラーメッセージで言語を確認するため、不正なサイコロを指定します。
+			req := httptest.NewRequest(http.MethodGet, "/rolldice/alice?dice=bogus", nil)
+			req.SetPathValue("player", "alice")
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rec := httptest.NewRecorder()
+			h.rolldice(rec, req)
+
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+			spantest.AssertAttribute(t, roll, "http.locale", attribute.StringValue(tt.wantLocale))
+		})
+	}
+}
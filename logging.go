@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newAppLoggerは、level以上のログをOpenTelemetryに送り、WARN以上のログをスパンイベントとしても記録するロガーを返します。
+// WithLogFieldでコンテキストに設定したフィールドは、すべてのログに付加されます。
+func newAppLogger(level slog.Leveler) *slog.Logger {
+	return slog.New(&levelHandler{
+		Handler: &logFieldHandler{Handler: newSpanEventHandler(otelslog.NewHandler(name))},
+		level:   level,
+	})
+}
+
+// newDiagLoggerは、テレメトリーのパイプライン自体の診断情報を標準エラー出力に書き出すロガーを返します。
+// エクスポートの処理中に呼ばれるため、OpenTelemetryのロガーは使用しません。
+func newDiagLogger(level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// spanEventHandlerは、WARN以上のログをアクティブなスパンのイベントとしても記録するslog.Handlerです。
+// ログとトレースを関連付けられないバックエンドでも、スパンからエラーを確認できるようにします。
+type spanEventHandler struct {
+	slog.Handler
+
+	attrs []attribute.KeyValue
+	group string
+}
+
+// newSpanEventHandlerは、nextにログを渡しつつスパンイベントを記録するspanEventHandlerを返します。
+func newSpanEventHandler(next slog.Handler) *spanEventHandler {
+	return &spanEventHandler{Handler: next}
+}
+
+func (h *spanEventHandler) Handle(ctx context.Context, r slog.Record) error {
+	if span := trace.SpanFromContext(ctx); r.Level >= slog.LevelWarn && span.IsRecording() {
+		attrs := slices.Clone(h.attrs)
+		attrs = append(attrs, attribute.String("log.severity", r.Level.String()))
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = appendSlogAttr(attrs, h.group, a)
+			return true
+		})
+		span.AddEvent(r.Message, trace.WithTimestamp(r.Time), trace.WithAttributes(attrs...))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *spanEventHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	attrs := slices.Clone(h.attrs)
+	for _, a := range as {
+		attrs = appendSlogAttr(attrs, h.group, a)
+	}
+	return &spanEventHandler{Handler: h.Handler.WithAttrs(as), attrs: attrs, group: h.group}
+}
+
+func (h *spanEventHandler) WithGroup(name string) slog.Handler {
+	return &spanEventHandler{Handler: h.Handler.WithGroup(name), attrs: h.attrs, group: joinGroup(h.group, name)}
+}
+
+// appendSlogAttrは、slogの属性をスパンの属性に変換してattrsに追加します。
+// グループは"."で区切ったキーに展開します。
+func appendSlogAttr(attrs []attribute.KeyValue, group string, a slog.Attr) []attribute.KeyValue {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		g := joinGroup(group, a.Key)
+		for _, ga := range v.Group() {
+			attrs = appendSlogAttr(attrs, g, ga)
+		}
+		return attrs
+	}
+	if a.Key == "" {
+		return attrs
+	}
+
+	key := joinGroup(group, a.Key)
+	switch v.Kind() {
+	case slog.KindBool:
+		return append(attrs, attribute.Bool(key, v.Bool()))
+	case slog.KindInt64:
+		return append(attrs, attribute.Int64(key, v.Int64()))
+	case slog.KindFloat64:
+		return append(attrs, attribute.Float64(key, v.Float64()))
+	default:
+		return append(attrs, attribute.String(key, v.String()))
+	}
+}
+
+func joinGroup(group, key string) string {
+	if group == "" {
+		return key
+	}
+	return group + "." + key
+}
+
+// logFieldsKeyは、ログに付加するフィールドを保持するコンテキストのキーです。
+type logFieldsKey struct{}
+
+// WithLogFieldは、ctxから記録するすべてのログにkeyとvalueのフィールドを付加するコンテキストを返します。
+// 同じキーを複数回設定した場合は、後に設定した値が使われます。
+func WithLogField(ctx context.Context, key string, value any) context.Context {
+	fields, _ := ctx.Value(logFieldsKey{}).([]slog.Attr)
+	fields = slices.DeleteFunc(slices.Clone(fields), func(a slog.Attr) bool { return a.Key == key })
+	return context.WithValue(ctx, logFieldsKey{}, append(fields, slog.Any(key, value)))
+}
+
+// logFieldHandlerは、WithLogFieldでコンテキストに設定したフィールドをログに付加するslog.Handlerです。
+type logFieldHandler struct {
+	slog.Handler
+}
+
+func (h *logFieldHandler) Handle(ctx context.Context, r slog.Record) error {
+	if fields, ok := ctx.Value(logFieldsKey{}).([]slog.Attr); ok {
+		r = r.Clone()
+		r.AddAttrs(fields...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *logFieldHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	return &logFieldHandler{Handler: h.Handler.WithAttrs(as)}
+}
+
+func (h *logFieldHandler) WithGroup(name string) slog.Handler {
+	return &logFieldHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// levelHandlerは、levelより低いレベルのログを破棄するslog.Handlerです。
+// slog.LevelVarを渡すことで、実行中にレベルを変更できます。
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= h.level.Level() && h.Handler.Enabled(ctx, l)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.level.Level() {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(as), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"dice/spantest"
+)
+
+func TestSpanEventHandlerRecordsWarnings(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+	var buf bytes.Buffer
+	logger := slog.New(newSpanEventHandler(slog.NewTextHandler(&buf, nil)))
+
+	ctx, span := tp.Tracer(name).Start(context.Background(), "roll")
+	logger.InfoContext(ctx, "rolling")
+	logger.WithGroup("dice").ErrorContext(ctx, "roll failed", "sides", 6)
+	span.End()
+
+	if out := buf.String(); !strings.Contains(out, "rolling") || !strings.Contains(out, "roll failed") {
+		t.Errorf("log output = %q, want both records", out)
+	}
+
+	roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+	if len(roll.Events) != 1 {
+		t.Fatalf("span events = %v, want only the error log", roll.Events)
+	}
+	event := roll.Events[0]
+	if event.Name != "roll failed" {
+		t.Errorf("event name = %q, want %q", event.Name, "roll failed")
+	}
+	want := []attribute.KeyValue{
+		attribute.String("log.severity", "ERROR"),
+		attribute.Int64("dice.sides", 6),
+	}
+	for _, kv := range want {
+		found := false
+		for _, got := range event.Attributes {
+			if got == kv {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("event attributes = %v, want %s=%s", event.Attributes, kv.Key, kv.Value.Emit())
+		}
+	}
+}
+
+func TestLogFieldHandlerAddsContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&logFieldHandler{Handler: slog.NewTextHandler(&buf, nil)})
+
+	ctx := WithLogField(context.Background(), "tenant_id", "acme")
+	ctx = WithLogField(ctx, "region", "eu")
+	ctx = WithLogField(ctx, "tenant_id", "globex")
+	logger.With("player", "alice").InfoContext(ctx, "rolled")
+	logger.InfoContext(context.Background(), "unscoped")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log output = %q, want two records", buf.String())
+	}
+	for _, want := range []string{"player=alice", "tenant_id=globex", "region=eu"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("record = %q, want it to contain %s", lines[0], want)
+		}
+	}
+	if strings.Contains(lines[0], "acme") {
+		t.Errorf("record = %q, want the overwritten tenant_id dropped", lines[0])
+	}
+	if strings.Contains(lines[1], "tenant_id") {
+		t.Errorf("record = %q, want no fields without WithLogField", lines[1])
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/log"
+)
+
+// ログキューが満杯の場合の方針です。
+const (
+	// dropOldestは、最も古いレコードを破棄して新しいレコードを受け入れます。
+	dropOldest = "drop_oldest"
+	// dropNewestは、新しいレコードを破棄します。
+	dropNewest = "drop_newest"
+)
+
+// boundedLogProcessorは、上限のあるキューにレコードを溜め、定期的にまとめてエクスポートするlog.Processorです。
+// ログが急増してキューが満杯になった場合でも、ログの出力元をブロックせず、方針に従ってレコードを破棄します。
+// 破棄したレコードの数はDroppedで取得できます。
+type boundedLogProcessor struct {
+	exporter log.Exporter
+	size     int
+	policy   string
+	interval time.Duration
+
+	mu    sync.Mutex
+	queue []log.Record
+
+	dropped  atomic.Int64
+	stopped  atomic.Bool
+	notify   chan struct{}
+	done     chan struct{}
+	finished chan struct{}
+	exportMu sync.Mutex
+}
+
+var _ log.Processor = (*boundedLogProcessor)(nil)
+
+// newBoundedLogProcessorは、最大size件のレコードを保持し、interval毎にexporterへエクスポートするboundedLogProcessorを返します。
+func newBoundedLogProcessor(exporter log.Exporter, size int, policy string, interval time.Duration) *boundedLogProcessor {
+	p := &boundedLogProcessor{
+		exporter: exporter,
+		size:     size,
+		policy:   policy,
+		interval: interval,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *boundedLogProcessor) run() {
+	defer close(p.finished)
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		case <-p.notify:
+		}
+		// 定期的なエクスポートのエラーは返す先がないため、グローバルなエラーハンドラーに渡します。
+		if err := p.export(context.Background()); err != nil {
+			otel.Handle(err)
+		}
+	}
+}
+
+func (p *boundedLogProcessor) OnEmit(_ context.Context, r *log.Record) error {
+	if p.stopped.Load() {
+		return nil
+	}
+	// レコードは呼び出し元で再利用されるため、複製して保持します。
+	rec := r.Clone()
+
+	p.mu.Lock()
+	if len(p.queue) >= p.size {
+		p.dropped.Add(1)
+		if p.policy == dropNewest {
+			p.mu.Unlock()
+			return nil
+		}
+		p.queue = p.queue[1:]
+	}
+	p.queue = append(p.queue, rec)
+	full := len(p.queue) >= p.size
+	p.mu.Unlock()
+
+	// キューが満杯になったら、次の間隔を待たずにエクスポートします。
+	if full {
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// exportは、キューに溜まっているレコードをすべてエクスポートします。
+func (p *boundedLogProcessor) export(ctx context.Context) error {
+	p.exportMu.Lock()
+	defer p.exportMu.Unlock()
+
+	p.mu.Lock()
+	batch := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return p.exporter.Export(ctx, batch)
+}
+
+// Droppedは、キューが満杯だったために破棄したレコードの数を返します。
+func (p *boundedLogProcessor) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+func (p *boundedLogProcessor) Shutdown(ctx context.Context) error {
+	if p.stopped.Swap(true) {
+		return nil
+	}
+	close(p.done)
+	<-p.finished
+	return errors.Join(p.export(ctx), p.exporter.Shutdown(ctx))
+}
+
+func (p *boundedLogProcessor) ForceFlush(ctx context.Context) error {
+	if p.stopped.Load() {
+		return nil
+	}
+	return errors.Join(p.export(ctx), p.exporter.ForceFlush(ctx))
+}
+
+// registerDroppedLogsCounterは、pが破棄したレコードの数を報告するメトリクスを登録します。
+func registerDroppedLogsCounter(p *boundedLogProcessor) error {
+	_, err := otel.Meter(name).Int64ObservableCounter("otel.log.dropped",
+		metric.WithDescription("The number of log records dropped because the queue was full"),
+		metric.WithUnit("{record}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(p.Dropped())
+			return nil
+		}))
+	return err
+}
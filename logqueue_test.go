@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+)
+
+// emitRecordsは、本文が"1"からnまでのレコードをpに渡します。
+func emitRecords(t testing.TB, p log.Processor, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		var r log.Record
+		r.SetBody(otellog.StringValue(strconv.Itoa(i)))
+		if err := p.OnEmit(context.Background(), &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBoundedLogProcessorPolicies(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{policy: dropOldest, want: []string{"3", "4", "5"}},
+		{policy: dropNewest, want: []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			exporter := &captureLogExporter{}
+			p := newBoundedLogProcessor(exporter, 3, tt.policy, time.Hour)
+			t.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+
+			// キューが満杯になった際のエクスポートを止め、溢れた分が方針どおりに破棄されるようにします。
+			p.exportMu.Lock()
+			emitRecords(t, p, 5)
+			p.exportMu.Unlock()
+
+			if err := p.ForceFlush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := exporter.bodies(); !slices.Equal(got, tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+			if got := p.Dropped(); got != 2 {
+				t.Errorf("Dropped() = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestBoundedLogProcessorReportsExportErrors(t *testing.T) {
+	handled := make(chan error, 1)
+	prev := otel.GetErrorHandler()
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		select {
+		case handled <- err:
+		default:
+		}
+	}))
+	t.Cleanup(func() { otel.SetErrorHandler(prev) })
+
+	exportErr := errors.New("collector unavailable")
+	p := newBoundedLogProcessor(&captureLogExporter{err: exportErr}, 1, dropOldest, time.Hour)
+	t.Cleanup(func() { _ = p.Shutdown(context.Background()) })
+	// キューが満杯になると、バックグラウンドでエクスポートされます。
+	emitRecords(t, p, 1)
+
+	select {
+	case err := <-handled:
+		if !errors.Is(err, exportErr) {
+			t.Errorf("handled error = %v, want %v", err, exportErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("export error was not passed to the error handler")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+)
+
+// samplingLogProcessorは、WARN未満のログをratioの割合に間引いてからnextに渡すプロセッサーです。
+// WARN以上のログはすべて渡します。
+// WARN以上かは重大度番号で判定するため、LOG_SEVERITY_MAPではWARNの前後の関係を保つ必要があります（checkSamplingSeveritiesで検証します）。
+//
+// トレースに紐づくログはトレースIDで判定するため、同じトレースのログはまとめて残るか破棄されます。
+// それ以外のログは連番を分散させたハッシュで判定するため、急増したログも一様に間引かれます。
+type samplingLogProcessor struct {
+	next log.Processor
+	// thresholdは、ハッシュ値がこれ未満のログを残すしきい値です。
+	threshold uint64
+	seq       atomic.Uint64
+}
+
+var _ log.Processor = (*samplingLogProcessor)(nil)
+
+// newSamplingLogProcessorは、WARN未満のログをratio（0〜1）の割合で残すsamplingLogProcessorを返します。
+func newSamplingLogProcessor(next log.Processor, ratio float64) *samplingLogProcessor {
+	return &samplingLogProcessor{
+		next:      next,
+		threshold: uint64(ratio * math.MaxUint64),
+	}
+}
+
+func (p *samplingLogProcessor) OnEmit(ctx context.Context, r *log.Record) error {
+	if r.Severity() >= otellog.SeverityWarn || p.sampled(r) {
+		return p.next.OnEmit(ctx, r)
+	}
+	return nil
+}
+
+func (p *samplingLogProcessor) sampled(r *log.Record) bool {
+	var h uint64
+	if tid := r.TraceID(); tid.IsValid() {
+		// トレースIDの後半はランダムな値のため、そのまま使用します。
+		h = binary.BigEndian.Uint64(tid[8:16])
+	} else {
+		// 黄金比による乗算ハッシュで、連番を値の範囲全体に均等に分散させます。
+		h = p.seq.Add(1) * 0x9E3779B97F4A7C15
+	}
+	return h < p.threshold
+}
+
+func (p *samplingLogProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *samplingLogProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/sdk/log"
+)
+
+func TestSamplingLogProcessorThinsInfoOnly(t *testing.T) {
+	exporter := &captureLogExporter{}
+	lp := log.NewLoggerProvider(log.WithProcessor(newSamplingLogProcessor(log.NewSimpleProcessor(exporter), 0.25)))
+	t.Cleanup(func() { _ = lp.Shutdown(context.Background()) })
+	logger := otelslog.NewLogger(name, otelslog.WithLoggerProvider(lp))
+
+	const n = 2000
+	for range n {
+		logger.Info("info")
+		logger.Warn("warn")
+	}
+
+	counts := map[string]int{}
+	for _, b := range exporter.bodies() {
+		counts[b]++
+	}
+	if counts["warn"] != n {
+		t.Errorf("kept %d WARN logs, want all %d", counts["warn"], n)
+	}
+	if got := float64(counts["info"]) / n; got < 0.2 || got > 0.3 {
+		t.Errorf("kept %.3f of INFO logs, want about 0.25", got)
+	}
+}
+
+func TestLogSeverityMapMustKeepWarnBoundaryWhenSampling(t *testing.T) {
+	// WARNをINFOの範囲の番号に置き換えると、WARNのログも間引かれてしまいます。
+	t.Setenv("LOG_SEVERITY_MAP", "DEBUG=5,INFO=9,WARN=10,ERROR=17")
+	t.Setenv("LOG_SAMPLE_RATIO", "0.5")
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig() accepted a severity map that moves WARN below the sampling boundary")
+	}
+
+	// 間引かない場合は、任意の対応を指定できます。
+	t.Setenv("LOG_SAMPLE_RATIO", "1")
+	if _, err := loadConfig(); err != nil {
+		t.Errorf("loadConfig() = %v, want nil without log sampling", err)
+	}
+}
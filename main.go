@@ -2,30 +2,94 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/metric"
 )
 
 func main() {
-	if err := run(); err != nil {
+	var err error
+	// サブコマンドが指定されていない場合は、HTTPサーバーを起動します。
+	switch cmd := subcommand(); cmd {
+	case "":
+		err = run()
+	case "emit-test-trace":
+		err = runEmitTestTrace()
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil {
 		log.Fatalln(err)
 	}
 }
 
+func subcommand() string {
+	if len(os.Args) < 2 {
+		return ""
+	}
+	return os.Args[1]
+}
+
 func run() (err error) {
 	// SIGINT（CTRL+C）を適切に処理するようにします。
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
+	// 標準出力のパイプが閉じられた際にSIGPIPEでプロセスが終了せず、
+	// 標準出力のエクスポーターが書き込みのエラーとして扱えるようにします。
+	signal.Ignore(syscall.SIGPIPE)
+
+	// 設定の読み込み。
+	cfg, err := loadConfig()
+	if err != nil {
+		return
+	}
+	for _, w := range configWarnings(cfg) {
+		log.Printf("WARNING: %s", w)
+	}
+
+	// SIGHUPを受け取った際に、設定を再読み込みします。
+	live := newLiveConfig(cfg)
+	go watchReload(ctx, live)
+	// 設定サービスから、サンプリングの割合を定期的に取得します。
+	if cfg.SamplingConfigURL != "" {
+		go pollSamplingConfig(ctx, http.DefaultClient, cfg.SamplingConfigURL, cfg.SamplingConfigPollInterval, live)
+	}
+	// 実際に使用するサンプリングの割合を、起動時に確認できるようにします。
+	live.logSampler()
+
+	// コレクターへの疎通確認。
+	// strictモードでは到達できない場合に起動を中止し、lenientモードでは警告を記録して起動を続けます。
+	if cfg.CollectorProbe != "off" && usesOTLP(cfg) {
+		probeErr := probeCollector(ctx, cfg.OTLPEndpoint, cfg.CollectorProbeAttempts, cfg.CollectorProbeInitialBackoff, cfg.CollectorProbeMaxBackoff)
+		if probeErr != nil {
+			if cfg.CollectorProbe == "strict" {
+				err = probeErr
+				return
+			}
+			log.Printf("WARNING: %v, starting anyway", probeErr)
+		}
+	}
 
 	// OpenTelemetryのセットアップ。
-	otelShutdown, err := setupOTelSDK(ctx)
+	// デバッグ用のエンドポイントから、任意のタイミングでメトリクスを収集できるようにします。
+	var metricsReader *metric.ManualReader
+	var extraReaders []metric.Reader
+	if cfg.DebugEndpoints {
+		metricsReader = metric.NewManualReader()
+		extraReaders = append(extraReaders, metricsReader)
+	}
+	otelShutdown, err := setupOTelSDK(ctx, live, extraReaders...)
 	if err != nil {
 		return
 	}
@@ -33,6 +97,23 @@ func run() (err error) {
 	defer func() {
 		err = errors.Join(err, otelShutdown(context.Background()))
 	}()
+	if cfg.GCPauseThreshold > 0 {
+		if err = startGCPauseMonitor(ctx, otel.Meter(name), cfg.GCPauseThreshold); err != nil {
+			return
+		}
+	}
+
+	// /admin/drainでドレインを開始できるようにします。
+	var drain *drainState
+	var drained <-chan struct{}
+	if cfg.AdminEndpoints {
+		drain = newDrainState()
+		drained = drain.Done()
+	}
+	handler, err := newHTTPHandler(live, metricsReader, drain)
+	if err != nil {
+		return
+	}
 
 	// HTTPサーバーを起動。
 	srv := &http.Server{
@@ -40,10 +121,16 @@ func run() (err error) {
 		BaseContext:  func(_ net.Listener) context.Context { return ctx },
 		ReadTimeout:  time.Second,
 		WriteTimeout: 10 * time.Second,
-		Handler:      newHTTPHandler(),
+		Handler:      handler,
+		TLSConfig:    newTLSConfig(cfg),
 	}
 	srvErr := make(chan error, 1)
 	go func() {
+		// 証明書が設定されている場合はHTTPSで待ち受けます。
+		if cfg.TLSCertFile != "" {
+			srvErr <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+			return
+		}
 		srvErr <- srv.ListenAndServe()
 	}()
 
@@ -57,6 +144,10 @@ func run() (err error) {
 		// 最初の CTRL+C を待機します。
 		// 可能な限り早くシグナル通知の受信を停止します。
 		stop()
+	case <-drained:
+		// ドレインが完了したら、割り込みと同様にサーバーを停止します。
+		log.Printf("Drain complete, shutting down")
+		stop()
 	}
 
 	// Shutdownが呼び出されると、ListenAndServeは即座にErrServerClosedを返します。
@@ -64,7 +155,24 @@ func run() (err error) {
 	return
 }
 
-func newHTTPHandler() http.Handler {
+// newTLSConfigは、HTTPSで待ち受ける際のTLSの設定を返します。
+// cfg.TLSMinVersionより古いバージョンのTLSでのハンドシェイクは拒否します。
+func newTLSConfig(cfg config) *tls.Config {
+	return &tls.Config{MinVersion: cfg.TLSMinVersion}
+}
+
+// newHTTPHandlerは、サービスのHTTPハンドラーを返します。
+// metricsReaderは、デバッグ用のエンドポイントでメトリクスを収集するリーダーです。
+// drainは、/admin/drainで開始するドレインの状態です。nilの場合は/admin/以下を登録しません。
+func newHTTPHandler(live *liveConfig, metricsReader *metric.ManualReader, drain *drainState) (http.Handler, error) {
+	cfg := live.config()
+	logger := newAppLogger(live.logLevel)
+	dice, err := newDefaultDiceHandler(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	dice.drain = drain
+
 	mux := http.NewServeMux()
 
 	// handleFuncはmux.HandleFuncの代替であり、
@@ -76,10 +184,58 @@ func newHTTPHandler() http.Handler {
 	}
 
 	// ハンドラーの登録。
-	handleFunc("/rolldice/", rolldice)
-	handleFunc("/rolldice/{player}", rolldice)
+	// ロールの結果は毎回異なるため、キャッシュさせません。
+	handleFunc("/rolldice/", cacheControl(dice.rolldiceAnonymous, "no-store"))
+	handleFunc("/rolldice/{player}", cacheControl(dice.rolldice, "no-store"))
+	handleFunc("/rolldice/{player}/batch", cacheControl(dice.rolldiceBatch, "no-store"))
+	if cfg.FlakyEndpoint {
+		// アラートの検証用に、一定の割合で失敗するエンドポイントを登録します。
+		// /rolldice/{player}より優先されるため、"flaky"という名前のプレイヤーはこのエンドポイントで処理されます。
+		handleFunc("/rolldice/flaky", cacheControl(dice.rolldiceFlaky, "no-store"))
+	}
+	if drain != nil {
+		handleFunc("/admin/drain", adminDrainHandler(drain))
+	}
+	if cfg.DebugEndpoints {
+		// デバッグ用のエンドポイントは、環境変数で有効にした場合のみ登録します。
+		handleFunc("/debug/config", debugConfigHandler(live))
+		handleFunc("/debug/collect-metrics", debugCollectMetricsHandler(metricsReader))
+		handleFunc("/debug/trace", debugTraceHandler)
+	}
+
+	// ミドルウェアの追加。
+	var handler http.Handler = mux
+	if cfg.RequestTimeout > 0 {
+		handler = timeoutMiddleware(handler, cfg.RequestTimeout)
+	}
+	handler = spanAttrsMiddleware(handler)
+	if cfg.ServerTiming {
+		handler = serverTimingMiddleware(handler)
+	}
+	handler = tlsMiddleware(handler)
+	if cfg.UserAgentAttribute {
+		handler = userAgentMiddleware(handler, cfg.UserAgentMaxLength)
+	}
+	if cfg.BodyHashMaxBytes > 0 {
+		handler = bodyHashMiddleware(handler, cfg.BodyHashMaxBytes)
+	}
+	if cfg.ErrorBodyLogMaxBytes > 0 {
+		handler = errorBodyLogMiddleware(handler, logger, cfg.ErrorBodyLogMaxBytes, cfg.ErrorBodyRedactFields)
+	}
+	if len(cfg.QueryParamAttributes) > 0 {
+		handler = queryParamMiddleware(handler, cfg.QueryParamAttributes, cfg.QueryParamMaxLength)
+	}
+	if len(cfg.RequestHeaderAttributes) > 0 {
+		handler = requestHeaderMiddleware(handler, cfg.RequestHeaderAttributes)
+	}
+	if cfg.EnforceRequiredHeader {
+		handler = requiredHeaderMiddleware(handler, cfg.RequiredHeader)
+	}
+	// バゲージはHTTP計装が取り出した後に切り詰めるため、otelhttpの内側に置きます。
+	handler = baggageLimitMiddleware(handler, cfg.BaggageMaxMembers, cfg.BaggageMaxBytes)
 
 	// サーバー全体に対してHTTP計装を追加します。
-	handler := otelhttp.NewHandler(mux, "/")
-	return handler
+	handler = otelhttp.NewHandler(handler, "/")
+	handler = requestStartMiddleware(handler)
+	return handler, nil
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSMinVersion(t *testing.T) {
+	tests := []struct {
+		minVersion    string
+		clientVersion uint16
+		wantErr       bool
+	}{
+		{minVersion: "", clientVersion: tls.VersionTLS11, wantErr: true},
+		{minVersion: "", clientVersion: tls.VersionTLS12, wantErr: false},
+		{minVersion: "1.3", clientVersion: tls.VersionTLS12, wantErr: true},
+		{minVersion: "1.3", clientVersion: tls.VersionTLS13, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.minVersion+"/"+tls.VersionName(tt.clientVersion), func(t *testing.T) {
+			t.Setenv("TLS_MIN_VERSION", tt.minVersion)
+			srv := httptest.NewUnstartedServer(okHandler)
+			srv.TLS = newTLSConfig(newTestConfig(t))
+			srv.StartTLS()
+			t.Cleanup(srv.Close)
+
+			// クライアントは、指定したバージョンのTLSのみで接続します。
+			client := srv.Client()
+			transport := client.Transport.(*http.Transport)
+			transport.TLSClientConfig.MinVersion = tt.clientVersion
+			transport.TLSClientConfig.MaxVersion = tt.clientVersion
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GET with %s = %v, want error: %t", tls.VersionName(tt.clientVersion), err, tt.wantErr)
+			}
+		})
+	}
+}
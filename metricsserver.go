@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+// newPrometheusReaderは、Prometheus形式でメトリクスを公開するリーダーを作成し、
+// addrで/metricsを提供するサーバーを起動します。
+// resourceKeysに含まれるリソースの属性は、各メトリクスのラベルとして公開します。
+// 返される関数でサーバーをシャットダウンしてください。
+func newPrometheusReader(addr string, resourceKeys []attribute.Key) (metric.Reader, func(context.Context) error, error) {
+	reg := prometheus.NewRegistry()
+	opts := []otelprom.Option{otelprom.WithRegisterer(reg)}
+	if len(resourceKeys) > 0 {
+		opts = append(opts, otelprom.WithResourceAsConstantLabels(attribute.NewAllowKeysFilter(resourceKeys...)))
+	}
+	reader, err := otelprom.New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	shutdown, err := startMetricsServer(addr, reg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, shutdown, nil
+}
+
+// startMetricsServerは、Prometheusがスクレイプする/metricsを、アプリケーションとは別のaddrで公開します。
+// 内部向けのポートで公開することで、メトリクスが公開ポートから見えないようにします。
+// 返される関数でサーバーをシャットダウンしてください。
+func startMetricsServer(addr string, reg *prometheus.Registry) (shutdown func(context.Context) error, err error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:         addr,
+		ReadTimeout:  time.Second,
+		WriteTimeout: 10 * time.Second,
+		Handler:      mux,
+	}
+
+	// ポートが使用中の場合などに起動時に失敗するよう、先にリッスンしておきます。
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server failed: %v", err)
+		}
+	}()
+	return srv.Shutdown, nil
+}
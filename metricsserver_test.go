@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+// freeAddrは、テストで使用できるローカルのアドレスを返します。
+func freeAddr(t testing.TB) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestMetricsServedOnSeparatePort(t *testing.T) {
+	addr := freeAddr(t)
+	reader, shutdown, err := newPrometheusReader(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	counter, _ := mp.Meter(name).Int64Counter("dice.rolls")
+	counter.Add(context.Background(), 1)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "dice_rolls") {
+		t.Errorf("metrics port: status %d, body %q, want 200 with dice_rolls", resp.StatusCode, body)
+	}
+
+	// アプリケーションのポートでは/metricsを公開しません。
+	app, err := newHTTPHandler(newLiveConfig(newTestConfig(t)), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("app port: status %d for /metrics, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// metricReceiverは、受信したメトリクスの名前を記録するOTLPのモックのレシーバーです。
+type metricReceiver struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *metricReceiver) Export(_ context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				r.names = append(r.names, m.Name)
+			}
+		}
+	}
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestMetricsPushedAndScraped(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv := &metricReceiver{}
+	srv := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(srv, recv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cfg := newTestConfig(t)
+	cfg.MetricsExporter = "otlp"
+	cfg.OTLPEndpoint = lis.Addr().String()
+	conn, err := initConn(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	addr := freeAddr(t)
+	promReader, stopMetricsServer, err := newPrometheusReader(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = stopMetricsServer(context.Background()) })
+
+	ctx := context.Background()
+	mp, err := newMeterProvider(ctx, cfg, resource.Empty(), conn, &exportStats{}, promReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	counter, _ := mp.Meter(name).Int64Counter("dice.rolls")
+	counter.Add(ctx, 1)
+
+	// プッシュ: 定期的なエクスポートを待たずに送信します。
+	if err := mp.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recv.mu.Lock()
+	pushed := slices.Contains(recv.names, "dice.rolls")
+	recv.mu.Unlock()
+	if !pushed {
+		t.Error("dice.rolls was not pushed to the OTLP receiver")
+	}
+
+	// プル: 同じ計装が/metricsからも取得できます。
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "dice_rolls") {
+		t.Errorf("/metrics = %q, want dice_rolls", body)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestStartKeyは、リクエストの開始時刻を保持するコンテキストのキーです。
+type requestStartKey struct{}
+
+// requestStartMiddlewareは、リクエストの開始時刻をコンテキストに記録します。
+// ミドルウェアでの処理時間も含めて計測できるよう、最も外側に置いてください。
+func requestStartMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestStartKey{}, time.Now())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestStartは、requestStartMiddlewareが記録したリクエストの開始時刻を返します。
+// 記録されていない場合は現在時刻を返します。
+func requestStart(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(requestStartKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// serverTimingsKeyは、Server-Timingヘッダーに含めるフェーズの処理時間を蓄積するserverTimingsを保持するコンテキストのキーです。
+type serverTimingsKey struct{}
+
+// serverTimingsは、AddServerTimingで記録されたフェーズの処理時間です。
+// ハンドラーから複数のゴルーチンで追加される場合があるため、ロックで保護します。
+type serverTimings struct {
+	mu      sync.Mutex
+	entries []string
+	// sentは、ヘッダーを送信したかどうかです。送信した後に記録されたフェーズは含めません。
+	sent bool
+}
+
+// serverTimingMiddlewareは、レスポンスにリクエストの処理時間を示すServer-Timingヘッダーを付与します。
+// ハンドラーがAddServerTimingで記録したフェーズ（ロールの待機や処理など）の処理時間を記録順に並べ、
+// 最後にリクエスト全体の処理時間をtotalとして付与します。
+// ヘッダーはボディより先に送信する必要があるため、含まれるのはレスポンスの書き込み開始までに記録したフェーズで、
+// totalは書き込み開始までの時間です。
+func serverTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timings := &serverTimings{}
+		tw := &serverTimingWriter{ResponseWriter: w, start: requestStart(r.Context()), timings: timings}
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingsKey{}, timings)))
+		// ハンドラーが何も書き込まなかった場合も、ヘッダーを付与します。
+		tw.setHeader()
+	})
+}
+
+// AddServerTimingは、ctxのリクエストのServer-Timingヘッダーに、nameのフェーズの処理時間durを追加します。
+// nameには、ヘッダーのトークンとして使える文字（英数字など）のみを指定してください。
+// serverTimingMiddlewareを通らないコンテキストや、ヘッダーを送信した後では何もしません。
+func AddServerTiming(ctx context.Context, name string, dur time.Duration) {
+	timings, ok := ctx.Value(serverTimingsKey{}).(*serverTimings)
+	if !ok {
+		return
+	}
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	if timings.sent {
+		return
+	}
+	timings.entries = append(timings.entries, formatServerTiming(name, dur))
+}
+
+// formatServerTimingは、Server-Timingヘッダーの1つのメトリクスをミリ秒単位で表します。
+func formatServerTiming(name string, dur time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(dur)/float64(time.Millisecond))
+}
+
+// serverTimingWriterは、最初の書き込み時にServer-Timingヘッダーを設定するhttp.ResponseWriterです。
+type serverTimingWriter struct {
+	http.ResponseWriter
+	start   time.Time
+	timings *serverTimings
+	done    bool
+}
+
+func (w *serverTimingWriter) setHeader() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.timings.mu.Lock()
+	defer w.timings.mu.Unlock()
+	w.timings.sent = true
+	entries := append(w.timings.entries, formatServerTiming("total", time.Since(w.start)))
+	w.Header().Set("Server-Timing", strings.Join(entries, ", "))
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrapは、http.ResponseControllerが元のhttp.ResponseWriterにアクセスできるようにします。
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// userAgentMiddlewareは、User-Agentヘッダーをサーバースパンのuser_agent.original属性に記録します。
+// maxLenを超えるUser-Agentは切り詰められます。
+func userAgentMiddleware(next http.Handler, maxLen int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.UserAgent(); ua != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetAttributes(attribute.String("user_agent.original", truncate(ua, maxLen)))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tlsMiddlewareは、TLSで受け付けたリクエストのTLSのバージョンと暗号スイートを、
+// サーバースパンのtls.protocol.versionとtls.cipher属性に記録します。平文のリクエストには何も記録しません。
+func tlsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			// tls.VersionNameは"TLS 1.3"の形式のため、バージョンの番号のみを記録します。
+			version := strings.TrimPrefix(tls.VersionName(r.TLS.Version), "TLS ")
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				semconv.TLSProtocolVersion(version),
+				semconv.TLSCipher(tls.CipherSuiteName(r.TLS.CipherSuite)),
+			)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheControlは、レスポンスにCache-Controlヘッダーのdirectiveを設定し、
+// キャッシュ可能かどうかをサーバースパンのhttp.response.cacheable属性に記録します。
+// ルートごとにdirectiveを指定できるため、キャッシュしてよいルートではmax-ageなどを指定します。
+func cacheControl(next func(http.ResponseWriter, *http.Request), directive string) func(http.ResponseWriter, *http.Request) {
+	cacheable := true
+	for _, d := range strings.Split(directive, ",") {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "no-store", "no-cache", "private":
+			cacheable = false
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", directive)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.Bool("http.response.cacheable", cacheable))
+		next(w, r)
+	}
+}
+
+// sensitiveQueryParamsは、許可リストに含まれていても記録しないクエリパラメーターの名前です。
+var sensitiveQueryParams = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"auth",
+	"password",
+	"secret",
+	"token",
+}
+
+// queryParamMiddlewareは、許可リストに含まれるクエリパラメーターを
+// サーバースパンのhttp.request.query.<name>属性に記録します。
+// 機密情報を含む可能性のあるパラメーターは記録しません。
+func queryParamMiddleware(next http.Handler, allowlist []string, maxLen int) http.Handler {
+	var names []string
+	for _, n := range allowlist {
+		if !slices.Contains(sensitiveQueryParams, strings.ToLower(n)) {
+			names = append(names, n)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var attrs []attribute.KeyValue
+		for _, n := range names {
+			if vs, ok := query[n]; ok {
+				v := truncate(strings.Join(vs, ","), maxLen)
+				attrs = append(attrs, attribute.String("http.request.query."+n, v))
+			}
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attrs...)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sensitiveHeadersは、許可リストに含まれていても記録しないリクエストヘッダーの名前です。
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+}
+
+// requestHeaderMiddlewareは、許可リストに含まれるリクエストヘッダーを
+// サーバースパンのhttp.request.header.<name>属性に記録します。
+// 複数の値はカンマで連結し、認証情報を含むヘッダーは記録しません。
+func requestHeaderMiddleware(next http.Handler, allowlist []string) http.Handler {
+	var names []string
+	for _, n := range allowlist {
+		n = http.CanonicalHeaderKey(n)
+		if !slices.Contains(sensitiveHeaders, n) {
+			names = append(names, n)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var attrs []attribute.KeyValue
+		for _, n := range names {
+			if vs := r.Header.Values(n); len(vs) > 0 {
+				attrs = append(attrs, attribute.String("http.request.header."+strings.ToLower(n), strings.Join(vs, ",")))
+			}
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attrs...)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredHeaderMiddlewareは、headerのないリクエストに401を返します。
+// ヘッダーの値の検証はゲートウェイで行うため、ここでは存在のみを確認します。
+// 拒否したリクエストのサーバースパンには、missing_required_headerイベントを記録します。
+func requiredHeaderMiddleware(next http.Handler, header string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(header) == "" {
+			trace.SpanFromContext(r.Context()).AddEvent("missing_required_header", trace.WithAttributes(
+				attribute.String("http.request.header.name", header)))
+			http.Error(w, localize(detectLocale(r), "missing_required_header"), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timeoutMiddlewareは、http.TimeoutHandlerでハンドラーの処理時間をtimeoutに制限します。
+// タイムアウトした場合は503を返し、サーバースパンにtimeoutイベントを記録してステータスをエラーにします。
+// タイムアウトしたかどうかは、TimeoutHandlerが書き込んだレスポンスがタイムアウトのメッセージの503かで判定するため、
+// ハンドラー自身が返した503や、コンテキストの終了を受けて直後に戻ったハンドラーを取り違えません。
+func timeoutMiddleware(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := localize(detectLocale(r), "request_timeout")
+		tw := &timeoutBodyWriter{statusWriter: statusWriter{ResponseWriter: w}, msg: msg}
+		http.TimeoutHandler(next, timeout, msg).ServeHTTP(tw, r)
+
+		if tw.timedOut() {
+			span := trace.SpanFromContext(r.Context())
+			span.AddEvent("timeout", trace.WithAttributes(attribute.String("http.server.timeout", timeout.String())))
+			span.SetStatus(codes.Error, "request timed out")
+		}
+	})
+}
+
+// timeoutBodyWriterは、レスポンスのステータスに加え、本文がタイムアウトのメッセージmsgと一致するかを記録するResponseWriterです。
+// 比較に必要な長さを超えた本文は保持しません。
+type timeoutBodyWriter struct {
+	statusWriter
+	msg  string
+	body []byte
+}
+
+func (w *timeoutBodyWriter) Write(b []byte) (int, error) {
+	if room := len(w.msg) + 1 - len(w.body); room > 0 {
+		w.body = append(w.body, b[:min(len(b), room)]...)
+	}
+	return w.statusWriter.Write(b)
+}
+
+// timedOutは、TimeoutHandlerがタイムアウトのレスポンスを書き込んだかどうかを返します。
+func (w *timeoutBodyWriter) timedOut() bool {
+	return w.status == http.StatusServiceUnavailable && string(w.body) == w.msg
+}
+
+// truncateは、sを最大n文字（rune単位）に切り詰めます。
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j]
+		}
+		i++
+	}
+	return s
+}
+
+// statusWriterは、ハンドラーが返したステータスコードを記録するhttp.ResponseWriterです。
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrapは、http.ResponseControllerが元のhttp.ResponseWriterにアクセスできるようにします。
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"dice/spantest"
+)
+
+// serveTracedは、hをotelhttpで計装してreqを処理し、記録されたスパンとレスポンスを返します。
+func serveTraced(t testing.TB, h http.Handler, req *http.Request) (tracetest.SpanStubs, *httptest.ResponseRecorder) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+	rec := httptest.NewRecorder()
+	otelhttp.NewHandler(h, "server", otelhttp.WithTracerProvider(tp)).ServeHTTP(rec, req)
+	return exporter.GetSpans(), rec
+}
+
+// okHandlerは、常に200を返すハンドラーです。
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func TestServerTimingHeader(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	h := requestStartMiddleware(serverTimingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte("ok"))
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rolldice", nil))
+
+	got := rec.Header().Get("Server-Timing")
+	m := regexp.MustCompile(`^total;dur=(\d+\.\d{3})$`).FindStringSubmatch(got)
+	if m == nil {
+		t.Fatalf("Server-Timing = %q, want total;dur=<ms>", got)
+	}
+	dur, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dur < float64(delay.Milliseconds()) || dur > 5000 {
+		t.Errorf("dur = %v ms, want between %d and 5000", dur, delay.Milliseconds())
+	}
+}
+
+func TestServerTimingPhases(t *testing.T) {
+	h := requestStartMiddleware(serverTimingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddServerTiming(r.Context(), "wait", 1500*time.Microsecond)
+		AddServerTiming(r.Context(), "roll", 250*time.Microsecond)
+		w.Write([]byte("ok"))
+		// ヘッダーを送信した後に記録したフェーズは含まれません。
+		AddServerTiming(r.Context(), "late", time.Millisecond)
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rolldice", nil))
+
+	got := rec.Header().Get("Server-Timing")
+	if !regexp.MustCompile(`^wait;dur=1\.500, roll;dur=0\.250, total;dur=\d+\.\d{3}$`).MatchString(got) {
+		t.Errorf("Server-Timing = %q, want wait, roll and total in order", got)
+	}
+}
+
+func TestServerTimingRolldice(t *testing.T) {
+	t.Setenv("CONCURRENCY_LIMIT", "1")
+	cfg := newTestConfig(t)
+	dice := newTestDiceHandler(t, cfg, tracenoop.NewTracerProvider(), nil)
+	h := requestStartMiddleware(serverTimingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("player", "alice")
+		dice.rolldice(w, r)
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	got := rec.Header().Get("Server-Timing")
+	if !regexp.MustCompile(`^wait;dur=\d+\.\d{3}, roll;dur=\d+\.\d{3}, total;dur=\d+\.\d{3}$`).MatchString(got) {
+		t.Errorf("Server-Timing = %q, want the wait and roll phases before total", got)
+	}
+}
+
+func TestUserAgentAttribute(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want string
+	}{
+		{name: "short", ua: "curl/8.0", want: "curl/8.0"},
+		{name: "truncated", ua: strings.Repeat("a", 20), want: strings.Repeat("a", 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/rolldice", nil)
+			req.Header.Set("User-Agent", tt.ua)
+			spans, _ := serveTraced(t, userAgentMiddleware(okHandler, 10), req)
+
+			server := spantest.AssertSpanExists(t, spans, "server")
+			spantest.AssertAttribute(t, server, "user_agent.original", attribute.StringValue(tt.want))
+		})
+	}
+}
+
+// hasAttributeは、spanが属性keyを持つかどうかを返します。
+func hasAttribute(span tracetest.SpanStub, key attribute.Key) bool {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestQueryParamAttributes(t *testing.T) {
+	h := queryParamMiddleware(okHandler, []string{"dice", "player", "password"}, 5)
+	req := httptest.NewRequest(http.MethodGet, "/rolldice?dice=3d6&player=alexander&password=hunter2&other=x", nil)
+	spans, _ := serveTraced(t, h, req)
+
+	server := spantest.AssertSpanExists(t, spans, "server")
+	spantest.AssertAttribute(t, server, "http.request.query.dice", attribute.StringValue("3d6"))
+	spantest.AssertAttribute(t, server, "http.request.query.player", attribute.StringValue("alexa"))
+	for _, key := range []attribute.Key{"http.request.query.password", "http.request.query.other"} {
+		if hasAttribute(server, key) {
+			t.Errorf("span has attribute %q, want it omitted", key)
+		}
+	}
+}
+
+func TestRequiredHeaderMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantStatus int
+		wantEvent  bool
+	}{
+		{name: "present", apiKey: "secret", wantStatus: http.StatusOK, wantEvent: false},
+		{name: "missing", apiKey: "", wantStatus: http.StatusUnauthorized, wantEvent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/rolldice", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-Api-Key", tt.apiKey)
+			}
+			spans, rec := serveTraced(t, requiredHeaderMiddleware(okHandler, "X-Api-Key"), req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			server := spantest.AssertSpanExists(t, spans, "server")
+			if got := findEvent(server, "missing_required_header") != nil; got != tt.wantEvent {
+				t.Errorf("missing_required_header event recorded = %t, want %t", got, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestRequestStartIncludesMiddlewareTime(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	var latency time.Duration
+	h := requestStartMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 内側のミドルウェアでかかった時間も、記録された開始時刻からの経過時間に含まれます。
+		time.Sleep(delay)
+		latency = time.Since(requestStart(r.Context()))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/rolldice", nil))
+
+	if latency < delay || latency > 5*time.Second {
+		t.Errorf("latency = %v, want between %v and 5s", latency, delay)
+	}
+
+	// 記録されていない場合は現在時刻を返します。
+	if d := time.Since(requestStart(context.Background())); d < 0 || d > time.Second {
+		t.Errorf("requestStart without the middleware is %v ago, want about now", d)
+	}
+}
+
+func TestTLSAttributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		newServer func(http.Handler) *httptest.Server
+		wantTLS   bool
+	}{
+		{name: "tls", newServer: httptest.NewTLSServer, wantTLS: true},
+		{name: "plaintext", newServer: httptest.NewServer, wantTLS: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+			srv := tt.newServer(otelhttp.NewHandler(tlsMiddleware(okHandler), "server", otelhttp.WithTracerProvider(tp)))
+			t.Cleanup(srv.Close)
+
+			resp, err := srv.Client().Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			// サーバースパンは、レスポンスを返した後に終了します。
+			for deadline := time.Now().Add(time.Second); len(exporter.GetSpans()) == 0 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+
+			server := spantest.AssertSpanExists(t, exporter.GetSpans(), "server")
+			if !tt.wantTLS {
+				if hasAttribute(server, "tls.protocol.version") || hasAttribute(server, "tls.cipher") {
+					t.Error("TLS attributes recorded for a plaintext request")
+				}
+				return
+			}
+			spantest.AssertAttribute(t, server, "tls.protocol.version", attribute.StringValue("1.3"))
+			if !hasAttribute(server, "tls.cipher") {
+				t.Error("tls.cipher not recorded")
+			}
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		directive     string
+		wantCacheable bool
+	}{
+		{directive: "no-store", wantCacheable: false},
+		{directive: "private, max-age=60", wantCacheable: false},
+		{directive: "public, max-age=60", wantCacheable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.directive, func(t *testing.T) {
+			h := http.HandlerFunc(cacheControl(okHandler, tt.directive))
+			spans, rec := serveTraced(t, h, httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil))
+
+			if got := rec.Header().Get("Cache-Control"); got != tt.directive {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.directive)
+			}
+			server := spantest.AssertSpanExists(t, spans, "server")
+			spantest.AssertAttribute(t, server, "http.response.cacheable", attribute.BoolValue(tt.wantCacheable))
+		})
+	}
+}
+
+func TestRequestHeaderAttributes(t *testing.T) {
+	h := requestHeaderMiddleware(okHandler, []string{"x-request-source", "X-Tenant", "authorization", "Cookie"})
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+	req.Header.Set("X-Request-Source", "mobile")
+	req.Header.Add("X-Tenant", "acme")
+	req.Header.Add("X-Tenant", "globex")
+	req.Header.Set("X-Unlisted", "ignored")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	spans, _ := serveTraced(t, h, req)
+
+	server := spantest.AssertSpanExists(t, spans, "server")
+	spantest.AssertAttribute(t, server, "http.request.header.x-request-source", attribute.StringValue("mobile"))
+	spantest.AssertAttribute(t, server, "http.request.header.x-tenant", attribute.StringValue("acme,globex"))
+	// 許可リストにないヘッダーと、認証情報を含むヘッダーは記録しません。
+	for _, key := range []attribute.Key{"http.request.header.x-unlisted", "http.request.header.authorization", "http.request.header.cookie"} {
+		if hasAttribute(server, key) {
+			t.Errorf("%s was recorded", key)
+		}
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+	slow := timeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), timeout)
+
+	spans, rec := serveTraced(t, slow, httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	server := spantest.AssertSpanExists(t, spans, "server")
+	if server.Status.Code != codes.Error {
+		t.Errorf("span status = %v, want %v", server.Status.Code, codes.Error)
+	}
+	event := findEvent(server, "timeout")
+	if event == nil {
+		t.Fatalf("span events = %v, want a timeout event", server.Events)
+	}
+	want := attribute.String("http.server.timeout", timeout.String())
+	if len(event.Attributes) != 1 || event.Attributes[0] != want {
+		t.Errorf("timeout event attributes = %v, want [%v]", event.Attributes, want)
+	}
+
+	// 時間内に完了したリクエストには記録しません。
+	spans, rec = serveTraced(t, timeoutMiddleware(okHandler, time.Second), httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if findEvent(spantest.AssertSpanExists(t, spans, "server"), "timeout") != nil {
+		t.Error("timeout event recorded for a request that completed in time")
+	}
+
+	// ハンドラー自身が返した503も、タイムアウトとしては記録しません。
+	unavailable := timeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+	}), time.Second)
+	spans, rec = serveTraced(t, unavailable, httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if findEvent(spantest.AssertSpanExists(t, spans, "server"), "timeout") != nil {
+		t.Error("timeout event recorded for the handler's own 503")
+	}
+}
+
+func TestTimeoutBodyWriterMatchesOnlyTheTimeoutMessage(t *testing.T) {
+	const msg = "request timed out"
+	tests := []struct {
+		name   string
+		status int
+		writes []string
+		want   bool
+	}{
+		{name: "timeout response", status: http.StatusServiceUnavailable, writes: []string{msg}, want: true},
+		{name: "message split across writes", status: http.StatusServiceUnavailable, writes: []string{"request ", "timed out"}, want: true},
+		{name: "handler 503 with another body", status: http.StatusServiceUnavailable, writes: []string{"draining\n"}, want: false},
+		{name: "handler 503 starting with the message", status: http.StatusServiceUnavailable, writes: []string{msg, " upstream"}, want: false},
+		{name: "same body with another status", status: http.StatusOK, writes: []string{msg}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &timeoutBodyWriter{statusWriter: statusWriter{ResponseWriter: httptest.NewRecorder()}, msg: msg}
+			w.WriteHeader(tt.status)
+			for _, s := range tt.writes {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := w.timedOut(); got != tt.want {
+				t.Errorf("timedOut() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,8 +11,11 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"go.opentelemetry.io/contrib/bridges/otelslog"
@@ -28,18 +31,61 @@ import (
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var serviceName = semconv.ServiceNameKey.String("test-service")
 
+// defaultEndpoint is the collector endpoint used when no endpoint is configured.
+const defaultEndpoint = "localhost:14318"
+
+// otlpEndpoint returns the host:port the exporter for signal ("TRACES",
+// "METRICS" or "LOGS") sends to. The signal-specific
+// OTEL_EXPORTER_OTLP_<SIGNAL>_ENDPOINT takes precedence over the general
+// OTEL_EXPORTER_OTLP_ENDPOINT, which in turn takes precedence over
+// defaultEndpoint.
+func otlpEndpoint(signal string) string {
+	for _, key := range []string{"OTEL_EXPORTER_OTLP_" + signal + "_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"} {
+		if v := os.Getenv(key); v != "" {
+			// WithEndpoint expects host:port, so drop the scheme of a URL.
+			if u, err := url.Parse(v); err == nil && u.Host != "" {
+				return u.Host
+			}
+			return v
+		}
+	}
+	return defaultEndpoint
+}
+
+// otlpProxy returns the proxy function used by the OTLP HTTP exporters. An
+// explicit proxy URL in OTEL_EXPORTER_OTLP_PROXY takes precedence; otherwise
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY are honored. Note that requests to
+// localhost are never proxied when using the environment.
+func otlpProxy() (func(*http.Request) (*url.URL, error), error) {
+	v := os.Getenv("OTEL_EXPORTER_OTLP_PROXY")
+	if v == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_PROXY: %w", err)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
 // Initializes an OTLP exporter, and configures the corresponding trace provider.
 func initTracerProvider(ctx context.Context, res *resource.Resource) (func(context.Context) error, error) {
+	proxy, err := otlpProxy()
+	if err != nil {
+		return nil, err
+	}
+
 	// Set up a trace exporter
 	traceExporter, err := otlptracehttp.New(ctx,
 		otlptracehttp.WithInsecure(),
-		otlptracehttp.WithEndpoint("localhost:14318"),
+		otlptracehttp.WithEndpoint(otlpEndpoint("TRACES")),
+		otlptracehttp.WithProxy(proxy),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
@@ -64,9 +110,15 @@ func initTracerProvider(ctx context.Context, res *resource.Resource) (func(conte
 
 // Initializes an OTLP exporter, and configures the corresponding meter provider.
 func initMeterProvider(ctx context.Context, res *resource.Resource) (func(context.Context) error, error) {
+	proxy, err := otlpProxy()
+	if err != nil {
+		return nil, err
+	}
+
 	metricExporter, err := otlpmetrichttp.New(ctx,
 		otlpmetrichttp.WithInsecure(),
-		otlpmetrichttp.WithEndpoint("localhost:14318"),
+		otlpmetrichttp.WithEndpoint(otlpEndpoint("METRICS")),
+		otlpmetrichttp.WithProxy(proxy),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create metrics exporter: %w", err)
@@ -82,9 +134,15 @@ func initMeterProvider(ctx context.Context, res *resource.Resource) (func(contex
 }
 
 func initLoggerProvider(ctx context.Context, res *resource.Resource) (*slog.Logger, error) {
+	proxy, err := otlpProxy()
+	if err != nil {
+		return nil, err
+	}
+
 	logExp, err := otlploghttp.New(ctx,
 		otlploghttp.WithInsecure(),
-		otlploghttp.WithEndpoint("localhost:14318"),
+		otlploghttp.WithEndpoint(otlpEndpoint("LOGS")),
+		otlploghttp.WithProxy(proxy),
 	)
 	if err != nil {
 		return nil, err
@@ -97,6 +155,34 @@ func initLoggerProvider(ctx context.Context, res *resource.Resource) (*slog.Logg
 	return logger, nil
 }
 
+// workSpanKinds returns the span kinds of the spans in the work loop, read
+// from the comma-separated WORK_SPAN_KINDS (e.g. "client,server"). The i-th
+// span uses kinds[i%len(kinds)]; the default is a single internal kind.
+func workSpanKinds() ([]trace.SpanKind, error) {
+	v := os.Getenv("WORK_SPAN_KINDS")
+	if v == "" {
+		return []trace.SpanKind{trace.SpanKindInternal}, nil
+	}
+	var kinds []trace.SpanKind
+	for _, s := range strings.Split(v, ",") {
+		switch strings.TrimSpace(strings.ToLower(s)) {
+		case "internal":
+			kinds = append(kinds, trace.SpanKindInternal)
+		case "server":
+			kinds = append(kinds, trace.SpanKindServer)
+		case "client":
+			kinds = append(kinds, trace.SpanKindClient)
+		case "producer":
+			kinds = append(kinds, trace.SpanKindProducer)
+		case "consumer":
+			kinds = append(kinds, trace.SpanKindConsumer)
+		default:
+			return nil, fmt.Errorf("invalid WORK_SPAN_KINDS entry %q", s)
+		}
+	}
+	return kinds, nil
+}
+
 func newLogExporter() (sdklog.Exporter, error) {
 	return stdoutlog.New(
 		stdoutlog.WithWriter(os.Stdout),
@@ -105,50 +191,72 @@ func newLogExporter() (sdklog.Exporter, error) {
 }
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run sets up the providers and runs the work loop. Errors are returned
+// rather than logged fatally so that the deferred shutdowns flush the
+// telemetry emitted so far.
+func run() error {
 	log.Printf("Waiting for connection...")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
 	res, err := resource.New(ctx,
+		// Use the same semantic conventions version as the SDK's own detectors.
+		resource.WithSchemaURL(semconv.SchemaURL),
 		resource.WithAttributes(
 			// The service name used to display traces in backends
 			serviceName,
 		),
 	)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	logger, err := initLoggerProvider(ctx, res)
 	if err != nil {
-		panic(fmt.Sprintf("error setting up OTel Log SDK - %v", err))
+		return fmt.Errorf("error setting up OTel Log SDK: %w", err)
 	}
 
 	shutdownTracerProvider, err := initTracerProvider(ctx, res)
 	if err != nil {
-		logger.Error(fmt.Sprintf("failed to initialize TracerProvider: %s", err))
+		return fmt.Errorf("failed to initialize TracerProvider: %w", err)
 	}
 	defer func() {
-		if err := shutdownTracerProvider(ctx); err != nil {
+		// ctx is already canceled after an interrupt, which would abort the
+		// final flush, so shut down with a context that ignores cancellation.
+		if err := shutdownTracerProvider(context.WithoutCancel(ctx)); err != nil {
 			logger.Error(fmt.Sprintf("failed to shutdown TracerProvider: %s", err))
 		}
 	}()
 
 	shutdownMeterProvider, err := initMeterProvider(ctx, res)
 	if err != nil {
-		logger.Error(fmt.Sprintf("failed to initialize MeterProvider: %s", err))
+		return fmt.Errorf("failed to initialize MeterProvider: %w", err)
 	}
 	defer func() {
-		if err := shutdownMeterProvider(ctx); err != nil {
+		if err := shutdownMeterProvider(context.WithoutCancel(ctx)); err != nil {
 			logger.Error(fmt.Sprintf("failed to shutdown MeterProvider: %s", err))
 		}
 	}()
 
+	kinds, err := workSpanKinds()
+	if err != nil {
+		return err
+	}
+
 	name := "go.opentelemetry.io/contrib/examples/otel-collector"
-	tracer := otel.Tracer(name)
-	meter := otel.Meter(name)
+	return runWork(ctx, otel.Tracer(name), otel.Meter(name), logger, kinds)
+}
 
+// runWork runs the demo work loop, emitting one span per iteration with the
+// span kinds cycling through kinds. It returns as soon as ctx is canceled,
+// ending the spans started so far so that they can be flushed.
+func runWork(ctx context.Context, tracer trace.Tracer, meter metric.Meter, logger *slog.Logger, kinds []trace.SpanKind) error {
 	// Attributes represent additional key-value descriptors that can be bound
 	// to a metric observer or recorder.
 	commonAttrs := []attribute.KeyValue{
@@ -159,7 +267,7 @@ func main() {
 
 	runCount, err := meter.Int64Counter("run", metric.WithDescription("The number of times the iteration ran"))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	// Work begins
@@ -169,13 +277,23 @@ func main() {
 		trace.WithAttributes(commonAttrs...))
 	defer span.End()
 	for i := 0; i < 10; i++ {
-		_, iSpan := tracer.Start(ctx, fmt.Sprintf("Sample-%d", i))
+		_, iSpan := tracer.Start(ctx, fmt.Sprintf("Sample-%d", i), trace.WithSpanKind(kinds[i%len(kinds)]))
 		runCount.Add(ctx, 1, metric.WithAttributes(commonAttrs...))
 		logger.Info(fmt.Sprintf("Doing really hard work (%d / 10)\n", i+1))
 
-		<-time.After(time.Second)
+		// Stop waiting as soon as we are interrupted so that the spans emitted
+		// so far are flushed promptly.
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+		}
 		iSpan.End()
+		if ctx.Err() != nil {
+			logger.Info("Interrupted, stopping work")
+			return nil
+		}
 	}
 
 	logger.Info("Done!")
+	return nil
 }
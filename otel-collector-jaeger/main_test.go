@@ -0,0 +1,170 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestOTLPEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		general string
+		traces  string
+		// wantTraces and wantMetrics are the endpoints for TRACES and METRICS;
+		// only TRACES has a signal-specific override.
+		wantTraces  string
+		wantMetrics string
+	}{
+		{name: "default", wantTraces: defaultEndpoint, wantMetrics: defaultEndpoint},
+		{name: "general", general: "collector:4318", wantTraces: "collector:4318", wantMetrics: "collector:4318"},
+		{name: "signal overrides general", general: "collector:4318", traces: "traces:4318", wantTraces: "traces:4318", wantMetrics: "collector:4318"},
+		{name: "signal only", traces: "traces:4318", wantTraces: "traces:4318", wantMetrics: defaultEndpoint},
+		{name: "scheme is dropped", general: "http://collector:4318", wantTraces: "collector:4318", wantMetrics: "collector:4318"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.general)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tt.traces)
+			t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+
+			if got := otlpEndpoint("TRACES"); got != tt.wantTraces {
+				t.Errorf("otlpEndpoint(TRACES) = %q, want %q", got, tt.wantTraces)
+			}
+			if got := otlpEndpoint("METRICS"); got != tt.wantMetrics {
+				t.Errorf("otlpEndpoint(METRICS) = %q, want %q", got, tt.wantMetrics)
+			}
+		})
+	}
+}
+
+func TestRunWorkStopsOnCancel(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := runWork(ctx, tp.Tracer("test"), noop.NewMeterProvider().Meter("test"), logger, []trace.SpanKind{trace.SpanKindInternal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each iteration waits a second, so returning well before that means
+	// the wait was interrupted.
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("runWork returned after %v, want prompt exit on cancel", elapsed)
+	}
+
+	var names []string
+	for _, s := range sr.Ended() {
+		names = append(names, s.Name())
+	}
+	want := []string{"Sample-0", "CollectorExporter-Example"}
+	if !slices.Equal(names, want) {
+		t.Errorf("ended spans = %v, want %v", names, want)
+	}
+}
+
+func TestOTLPProxy(t *testing.T) {
+	// The fake proxy records the requests forwarded through it.
+	var mu sync.Mutex
+	var forwarded []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		forwarded = append(forwarded, r.URL.Host+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_PROXY", proxy.URL)
+
+	proxyFunc, err := otlpProxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithInsecure(),
+		otlptracehttp.WithEndpoint("collector.invalid:4318"),
+		otlptracehttp.WithProxy(proxyFunc),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := tp.Tracer("test").Start(ctx, "proxied")
+	span.End()
+	if err := tp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(forwarded, []string{"collector.invalid:4318/v1/traces"}) {
+		t.Errorf("proxied requests = %v, want [collector.invalid:4318/v1/traces]", forwarded)
+	}
+}
+
+func TestOTLPProxyInvalidURL(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_PROXY", "://bad")
+	if _, err := otlpProxy(); err == nil {
+		t.Error("otlpProxy() accepted an invalid URL")
+	}
+}
+
+func TestWorkSpanKinds(t *testing.T) {
+	t.Setenv("WORK_SPAN_KINDS", "server, client")
+	kinds, err := workSpanKinds()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Let the first iteration finish and interrupt the second one.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(1200*time.Millisecond, cancel)
+	if err := runWork(ctx, tp.Tracer("test"), noop.NewMeterProvider().Meter("test"), logger, kinds); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]trace.SpanKind{}
+	for _, s := range sr.Ended() {
+		got[s.Name()] = s.SpanKind()
+	}
+	want := map[string]trace.SpanKind{
+		"Sample-0":                  trace.SpanKindServer,
+		"Sample-1":                  trace.SpanKindClient,
+		"CollectorExporter-Example": trace.SpanKindInternal,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("span kinds = %v, want %v", got, want)
+	}
+}
+
+func TestWorkSpanKindsInvalid(t *testing.T) {
+	t.Setenv("WORK_SPAN_KINDS", "client,bogus")
+	if _, err := workSpanKinds(); err == nil {
+		t.Error("workSpanKinds() accepted an unknown kind")
+	}
+}
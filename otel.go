@@ -3,33 +3,94 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	stdlog "log"
+	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/log/global"
+	lognoop "go.opentelemetry.io/otel/log/noop"
+	otelmetric "go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
 )
 
+// shutdownStepは、setupOTelSDKが返すshutdownで呼び出すクリーンアップ関数です。
+// nameは、所要時間をログやメトリクスに記録する際に使います。
+type shutdownStep struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// loggerProviderStepは、ロガープロバイダーのshutdownStepの名前です。
+const loggerProviderStep = "logger_provider"
+
 // setupOTelSDKは、OpenTelemetryのパイプラインを初期化します。
 // エラーが返されなかった場合は、適切にクリーンアップを行うためにshutdownを必ず呼び出してください。
-func setupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, err error) {
-	var shutdownFuncs []func(context.Context) error
+// サンプラーにはliveのものを使用するため、設定の再読み込みが反映されます。
+// extraReadersは、メータープロバイダーに追加で登録するリーダーです。
+func setupOTelSDK(ctx context.Context, live *liveConfig, extraReaders ...metric.Reader) (shutdown func(context.Context) error, err error) {
+	cfg := live.config()
+	var shutdownFuncs []shutdownStep
+	var shutdownDuration otelmetric.Float64Histogram
+	// shutdownLoggerは、シャットダウンの経過をOpenTelemetryのログとしても記録するロガーです。
+	// ロガープロバイダーの停止後はnilになります。
+	var shutdownLogger *slog.Logger
+	diagLogger := newDiagLogger(live.logLevel)
+	stats := &exportStats{}
 
 	// shutdown は、shutdownFuncsを通じて登録されたクリーンアップ関数を呼び出します。
 	// 各クリーンアップ関数の呼び出しで発生したエラーはjoinされます。
 	// 登録された各クリーンアップ関数は一度だけ実行されます。
+	// 各クリーンアップ関数にかかった時間はログに記録し、メータープロバイダーが停止する前であればメトリクスにも記録します。
+	// ロガープロバイダーは、トレースとメトリクスを送り切った後に停止するため、それまでの経過はログとしても送信されます。
+	// すべてのプロバイダーが送り切った後に、エクスポートの集計結果をログに記録します。
 	shutdown = func(ctx context.Context) error {
+		if shutdownFuncs == nil {
+			return nil
+		}
 		var err error
-		for _, fn := range shutdownFuncs {
-			err = errors.Join(err, fn(ctx))
+		for _, step := range shutdownFuncs {
+			if step.name == loggerProviderStep && shutdownLogger != nil {
+				shutdownLogger.InfoContext(ctx, "Telemetry shutdown complete, flushing logs")
+				shutdownLogger = nil
+			}
+			start := time.Now()
+			stepErr := step.fn(ctx)
+			elapsed := time.Since(start)
+			diagLogger.Info("shutdown step finished", "step", step.name, "duration", elapsed, "error", stepErr)
+			if shutdownLogger != nil {
+				shutdownLogger.InfoContext(ctx, "shutdown step finished", "step", step.name, "duration", elapsed, "error", stepErr)
+			}
+			if shutdownDuration != nil {
+				shutdownDuration.Record(ctx, elapsed.Seconds(), otelmetric.WithAttributes(attribute.String("step", step.name)))
+			}
+			err = errors.Join(err, stepErr)
 		}
 		shutdownFuncs = nil
+		stats.logSummary(ctx, diagLogger)
 		return err
 	}
 
@@ -38,40 +99,200 @@ func setupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, er
 		err = errors.Join(inErr, shutdown(ctx))
 	}
 
+	// リソースのセットアップ。
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		handleErr(err)
+		return
+	}
+	if cfg.ServiceNameCheck == "fail" && !hasServiceName(res) {
+		handleErr(errors.New("resource has no service.name, set OTEL_SERVICE_NAME"))
+		return
+	}
+	live.res.Store(res)
+
 	// プロパゲーターのセットアップ。
 	prop := newPropagator()
 	otel.SetTextMapPropagator(prop)
 
+	// OTLPエクスポーター用のgRPCコネクションのセットアップ。
+	// トレース・メトリクス・ログのエクスポーターは、この1つのコネクションを共有します。
+	var conn *grpc.ClientConn
+	if usesOTLP(cfg) {
+		conn, err = initConn(cfg, diagLogger)
+		if err != nil {
+			handleErr(err)
+			return
+		}
+	}
+	closeConn := func(context.Context) error {
+		if conn == nil {
+			return nil
+		}
+		return conn.Close()
+	}
+
 	// トレースプロバイダーのセットアップ。
-	tracerProvider, err := newTracerProvider()
-	if err != nil {
-		handleErr(err)
-		return
+	// 開発モードでは、スパンを一切記録しないno-opのトレースプロバイダーを使用します。
+	if cfg.TelemetryMode == "dev" {
+		otel.SetTracerProvider(tracenoop.NewTracerProvider())
+	} else {
+		var tracerProvider *trace.TracerProvider
+		tracerProvider, err = newTracerProvider(ctx, cfg, res, conn, live.sampler, diagLogger, stats)
+		if err != nil {
+			handleErr(errors.Join(err, closeConn(ctx)))
+			return
+		}
+		shutdownFuncs = append(shutdownFuncs, shutdownStep{"tracer_provider", tracerProvider.Shutdown})
+		otel.SetTracerProvider(tracerProvider)
+
+		// テレメトリーを送信できない状態では、起動を中止します。
+		// サービスのサンプラーやスプールに左右されないよう、確認用のスパンは専用のパイプラインで送信します。
+		if cfg.StartupTelemetryCheck {
+			if checkErr := checkTelemetry(ctx, cfg, res, conn, diagLogger); checkErr != nil {
+				handleErr(errors.Join(fmt.Errorf("startup telemetry check failed, spans cannot be exported: %w", checkErr), closeConn(ctx)))
+				return
+			}
+		}
+	}
+
+	// Prometheus用のメトリクスサーバーのセットアップ。
+	readers := extraReaders
+	if cfg.MetricsAddr != "" {
+		promReader, stopMetricsServer, promErr := newPrometheusReader(cfg.MetricsAddr, cfg.MetricResourceAttributes)
+		if promErr != nil {
+			handleErr(promErr)
+			return
+		}
+		readers = append(readers, promReader)
+		shutdownFuncs = append(shutdownFuncs, shutdownStep{"metrics_server", stopMetricsServer})
 	}
-	shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
-	otel.SetTracerProvider(tracerProvider)
 
 	// メータープロバイダーのセットアップ。
-	meterProvider, err := newMeterProvider()
+	meterProvider, err := newMeterProvider(ctx, cfg, res, conn, stats, readers...)
 	if err != nil {
-		handleErr(err)
+		handleErr(errors.Join(err, closeConn(ctx)))
 		return
 	}
-	shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
+	shutdownFuncs = append(shutdownFuncs, shutdownStep{"meter_provider", meterProvider.Shutdown})
 	otel.SetMeterProvider(meterProvider)
-
-	// ロガープロバイダーのセットアップ。
-	loggerProvider, err := newLoggerProvider()
+	shutdownDuration, err = meterProvider.Meter(name).Float64Histogram("otel.sdk.shutdown.duration",
+		otelmetric.WithDescription("The duration of each telemetry provider's shutdown flush"),
+		otelmetric.WithUnit("s"))
 	if err != nil {
 		handleErr(err)
 		return
 	}
-	shutdownFuncs = append(shutdownFuncs, loggerProvider.Shutdown)
-	global.SetLoggerProvider(loggerProvider)
 
+	// ロガープロバイダーのセットアップ。
+	// ログが失われてもサービスは停止させたくないため、失敗した場合はno-opのロガープロバイダーで続行します。
+	// シャットダウンの経過をログとして送信できるよう、ロガープロバイダーはトレースとメトリクスの後に停止します。
+	loggerProvider, logErr := newLoggerProviderFunc(ctx, cfg, res, conn, stats)
+	if logErr != nil {
+		stdlog.Printf("WARNING: failed to set up logger provider, logs will be discarded: %v", logErr)
+		global.SetLoggerProvider(lognoop.NewLoggerProvider())
+	} else {
+		shutdownFuncs = append(shutdownFuncs, shutdownStep{loggerProviderStep, loggerProvider.Shutdown})
+		global.SetLoggerProvider(loggerProvider)
+		shutdownLogger = slog.New(otelslog.NewHandler(name, otelslog.WithLoggerProvider(loggerProvider)))
+	}
+
+	// コネクションは、すべてのプロバイダーが送り切った後に閉じます。
+	shutdownFuncs = append(shutdownFuncs, shutdownStep{"grpc_conn", closeConn})
 	return
 }
 
+// defaultServiceNameは、サービス名が設定されていない場合に使うservice.nameです。
+const defaultServiceName = "dice"
+
+// instanceIDは、このプロセスのservice.instance.idです。
+// プロセスの実行中は同じ値を返すため、再初期化しても別のインスタンスとして扱われません。
+var instanceID = sync.OnceValue(func() string {
+	return uuid.NewString()
+})
+
+// newResourceは、サービス名などテレメトリーの送信元を表すリソースを返します。
+// 検出した属性は、設定されたスキーマURLのもとにまとめ直します。
+// service.instance.idは、設定された値、OTEL_RESOURCE_ATTRIBUTESの値、プロセスごとに生成したUUIDの順に優先します。
+// service.nameも同様に優先しますが、既定のサービス名はSERVICE_NAME_CHECKが"off"の場合のみ使います。
+func newResource(ctx context.Context, cfg config) (*resource.Resource, error) {
+	var attrs []attribute.KeyValue
+	if cfg.ServiceName != "" {
+		attrs = append(attrs, semconv.ServiceName(cfg.ServiceName))
+	}
+	if cfg.ServiceInstanceID != "" {
+		attrs = append(attrs, semconv.ServiceInstanceID(cfg.ServiceInstanceID))
+	}
+	defaults := []attribute.KeyValue{semconv.ServiceInstanceID(instanceID())}
+	if cfg.ServiceNameCheck == "off" {
+		// 確認しない場合のみ、OTEL_RESOURCE_ATTRIBUTESなどで上書きできる既定のサービス名を使います。
+		defaults = append(defaults, semconv.ServiceName(defaultServiceName))
+	}
+	opts := []resource.Option{
+		resource.WithAttributes(defaults...),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	}
+	if cfg.RuntimeResource {
+		// フリート全体でのバージョンやOSごとの分析に使用します。
+		opts = append(opts, resource.WithProcessRuntimeVersion(), resource.WithOSType())
+	}
+	if cfg.ResourceFile != "" {
+		fileRes, err := resourceFromFile(cfg.ResourceFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, resource.WithAttributes(fileRes.Attributes()...))
+	}
+	opts = append(opts, resource.WithAttributes(attrs...))
+	res, err := resource.New(ctx, opts...)
+	if errors.Is(err, resource.ErrPartialResource) {
+		// 一部の検出に失敗した場合も、検出できた属性で起動を続けます。
+		slog.WarnContext(ctx, "Some resource attributes could not be detected", "error", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return resource.NewWithAttributes(cfg.SchemaURL, res.Attributes()...), nil
+}
+
+// usesOTLPは、いずれかのシグナルをOTLPでエクスポートするかどうかを返します。
+// 開発モードではスパンを記録しないため、トレースのエクスポート先は考慮しません。
+func usesOTLP(cfg config) bool {
+	if cfg.TracesExporter == "otlp" && cfg.TelemetryMode != "dev" {
+		return true
+	}
+	return cfg.MetricsExporter == "otlp" || cfg.LogsExporter == "otlp"
+}
+
+// initConnは、OTLPエクスポーターが共有するgRPCコネクションを作成します。
+// コネクションはエクスポーターのシャットダウン後に一度だけ閉じてください。
+func initConn(cfg config, diagLogger *slog.Logger) (*grpc.ClientConn, error) {
+	// デモ用にTLSを使用しない設定にしています。
+	callOpts := []grpc.CallOption{
+		// 送信するメッセージの上限を明示し、超えた場合は送信前にエラーにします。
+		// 大きなバッチを送信するには、受信側のコレクターの上限（既定は4MiB）も合わせて引き上げてください。
+		grpc.MaxCallSendMsgSize(cfg.GRPCMaxSendMsgSize),
+	}
+	if cfg.OTLPCompression == "gzip" {
+		// エクスポーターのWithCompressorは、WithGRPCConnで渡したコネクションには反映されないため、
+		// コネクションの既定の呼び出しオプションとして設定します。
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	}
+	conn, err := grpc.NewClient(cfg.OTLPEndpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(callOpts...),
+		grpc.WithChainUnaryInterceptor(
+			partialSuccessInterceptor(diagLogger),
+			// エクスポーターの再送は無効にし、試行ごとにログを記録できるこのインターセプターで再送します。
+			retryInterceptor(cfg.RetryInitialInterval, cfg.RetryMaxInterval, cfg.RetryMaxElapsedTime, diagLogger),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection to collector: %w", err)
+	}
+	return conn, nil
+}
+
 func newPropagator() propagation.TextMapPropagator {
 	return propagation.NewCompositeTextMapPropagator(
 		propagation.TraceContext{},
@@ -79,43 +300,329 @@ func newPropagator() propagation.TextMapPropagator {
 	)
 }
 
-func newTracerProvider() (*trace.TracerProvider, error) {
-	traceExporter, err := stdouttrace.New(
+// newSamplerは、親スパンのサンプリング結果に従い、ルートスパンは設定された割合でサンプリングするサンプラーを返します。
+// 上流のサンプリング結果は厳密に尊重し、親がある場合に独自の判断は行いません。
+// サンプリングのルールが設定されている場合、ルートスパンにはプレイヤー名に一致したルールの割合を使用します。
+// 既定のtracestateが設定されている場合、エントリーのないスパンにはそれを追加します。
+func newSampler(cfg config) trace.Sampler {
+	root := trace.TraceIDRatioBased(cfg.SamplerRatio)
+	if len(cfg.SamplingRules) > 0 {
+		root = newRuleSampler(cfg.SamplingRules, root)
+	}
+	sampler := trace.ParentBased(root,
+		trace.WithRemoteParentSampled(trace.AlwaysSample()),
+		trace.WithRemoteParentNotSampled(trace.NeverSample()),
+		trace.WithLocalParentSampled(trace.AlwaysSample()),
+		trace.WithLocalParentNotSampled(trace.NeverSample()),
+	)
+	if cfg.DefaultTraceStateKey != "" {
+		sampler = &defaultTraceStateSampler{Sampler: sampler, key: cfg.DefaultTraceStateKey, value: cfg.DefaultTraceStateValue}
+	}
+	return sampler
+}
+
+func newTraceExporter(ctx context.Context, cfg config, conn *grpc.ClientConn) (trace.SpanExporter, error) {
+	if cfg.TracesExporter == "otlp" {
+		client := otlptracegrpc.NewClient(
+			otlptracegrpc.WithGRPCConn(conn),
+			otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{Enabled: false}),
+			otlptracegrpc.WithHeaders(cfg.OTLPHeaders))
+		if cfg.SpoolDir != "" {
+			// コレクターが停止している間に送信できなかったスパンを、復旧後に再送します。
+			return otlptrace.New(ctx, newSpoolClient(client, cfg.SpoolDir, cfg.SpoolMaxBatches))
+		}
+		return otlptrace.New(ctx, client)
+	}
+	exporter, err := stdouttrace.New(
 		stdouttrace.WithPrettyPrint())
 	if err != nil {
 		return nil, err
 	}
+	return &stdoutSpanExporter{SpanExporter: exporter, failures: newStdoutFailures("traces", cfg.StdoutMaxWriteFailures)}, nil
+}
 
-	tracerProvider := trace.NewTracerProvider(
-		trace.WithBatcher(traceExporter,
-			// デフォルトは5秒です。デモ用に1秒に設定しています。
-			trace.WithBatchTimeout(time.Second)),
-	)
+// newSecondaryTraceExporterは、2つ目のOTLPのエンドポイントに送信するSpanExporterを返します。
+// 圧縮や再送の設定は1つ目のエンドポイントと共有し、ヘッダーのみ個別に指定できます。
+// 専用のgRPCコネクションは、エクスポーターのシャットダウン時に閉じます。
+func newSecondaryTraceExporter(ctx context.Context, cfg config, diagLogger *slog.Logger) (trace.SpanExporter, error) {
+	secondary := cfg
+	secondary.OTLPEndpoint = cfg.OTLPSecondaryEndpoint
+	conn, err := initConn(secondary, diagLogger)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithGRPCConn(conn),
+		otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{Enabled: false}),
+		otlptracegrpc.WithHeaders(cfg.OTLPSecondaryHeaders))
+	if err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+	return &connClosingExporter{SpanExporter: exporter, conn: conn}, nil
+}
+
+func newTracerProvider(ctx context.Context, cfg config, res *resource.Resource, conn *grpc.ClientConn, sampler trace.Sampler, diagLogger *slog.Logger, stats *exportStats) (*trace.TracerProvider, error) {
+	traceExporter, err := newTraceExporter(ctx, cfg, conn)
+	if err != nil {
+		return nil, err
+	}
+	traceExporter = &countingSpanExporter{SpanExporter: traceExporter, stats: stats}
+	if cfg.TracesExporter == "otlp" && cfg.CircuitBreakerThreshold > 0 {
+		// メータープロバイダーはこの後に設定されるため、グローバルなメーターを使用します。
+		traceExporter, err = newCircuitBreakerExporter(traceExporter, cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown, otel.Meter(name), diagLogger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxConcurrentExports > 0 {
+		// 上限に達した場合は、ExportQueueTimeoutの間だけ空きを待機します。
+		limiter := newConcurrencyLimiter(cfg.MaxConcurrentExports, cfg.ExportQueueTimeout > 0, cfg.ExportQueueTimeout)
+		traceExporter = &concurrencyLimitedExporter{SpanExporter: traceExporter, limiter: limiter}
+	}
+	if cfg.TracesExporter == "otlp" {
+		traceExporter = &dnsErrorExporter{SpanExporter: traceExporter, endpoint: cfg.OTLPEndpoint, logger: diagLogger}
+	}
+	if cfg.ExportSizeLogging {
+		traceExporter = &sizeLoggingExporter{SpanExporter: traceExporter, logger: diagLogger}
+	}
+	processors := newSpanAttributeProcessors(cfg)
+	traceExporter = wrapSpanContent(traceExporter, cfg, processors, diagLogger)
+
+	// キューの長さを監視し、スパンが破棄される前に検知できるようにします。
+	queue := &spanQueueTracker{}
+	if err := queue.registerGauge(); err != nil {
+		return nil, err
+	}
+	traceExporter = queue.wrapExporter(traceExporter)
+
+	var primary trace.SpanProcessor
+	if cfg.SpanQueuePolicy == "block" {
+		// キューが満杯の場合は、スパンを破棄する代わりに空きができるまで待機します。
+		// 待機の後に破棄されたスパンを数えないよう、キューの長さはバッチプロセッサーの直前で数えます。
+		processor := queue.processor(trace.NewBatchSpanProcessor(traceExporter,
+			trace.WithBatchTimeout(cfg.BatchTimeout), trace.WithBlocking()))
+		primary = newBackpressureProcessor(processor, cfg.SpanQueueBlockTimeout)
+	} else {
+		primary = queue.processor(trace.NewBatchSpanProcessor(traceExporter,
+			trace.WithBatchTimeout(cfg.BatchTimeout)))
+	}
+	// exportProcessorsは、スパンをエクスポートするプロセッサーです。
+	exportProcessors := []trace.SpanProcessor{primary}
+	// shutdownExportersは、途中で失敗した場合に、作成済みのプロセッサーを停止します。
+	shutdownExporters := func() error {
+		var err error
+		for _, p := range exportProcessors {
+			err = errors.Join(err, p.Shutdown(ctx))
+		}
+		return err
+	}
+	if cfg.TracesOTLPFile != "" {
+		fileExporter, err := newOTLPFileExporter(ctx, cfg.TracesOTLPFile)
+		if err != nil {
+			return nil, errors.Join(err, shutdownExporters())
+		}
+		// コレクターに送信される内容と一致するよう、同じ属性の処理を適用します。
+		fileExporter = wrapSpanContent(fileExporter, cfg, processors, diagLogger)
+		exportProcessors = append(exportProcessors, trace.NewBatchSpanProcessor(fileExporter,
+			trace.WithBatchTimeout(cfg.BatchTimeout)))
+	}
+	if cfg.TracesExporter == "otlp" && cfg.OTLPSecondaryEndpoint != "" {
+		// 2つ目のコレクターにも同じスパンを送信します。
+		// バッチプロセッサーを分けているため、一方のコレクターの障害がもう一方への送信を妨げません。
+		secondary, err := newSecondaryTraceExporter(ctx, cfg, diagLogger)
+		if err != nil {
+			return nil, errors.Join(err, shutdownExporters())
+		}
+		secondary = wrapSpanContent(secondary, cfg, processors, diagLogger)
+		exportProcessors = append(exportProcessors, trace.NewBatchSpanProcessor(secondary,
+			trace.WithBatchTimeout(cfg.BatchTimeout)))
+	}
+	// samplingAttrProcessorには、フィルターを含まないサービスのサンプラーを渡します。
+	tpSampler := sampler
+	if cfg.SpanDropKey != "" {
+		// 開始時点で破棄対象のスパンは記録せず、終了時点で破棄対象となったスパンは、
+		// いずれのエクスポーターのバッチプロセッサーにも渡さないようにします。
+		filter := newSpanFilter(cfg.SpanDropKey, cfg.SpanDropValue)
+		tpSampler = filter.sampler(sampler)
+		exportProcessors = []trace.SpanProcessor{filter.wrapProcessors(exportProcessors...)}
+	}
+
+	opts := []trace.TracerProviderOption{
+		trace.WithResource(res),
+		trace.WithSampler(tpSampler),
+	}
+	for _, p := range exportProcessors {
+		opts = append(opts, trace.WithSpanProcessor(p))
+	}
+	tracerProvider := trace.NewTracerProvider(opts...)
+	if cfg.SamplingAttributes {
+		tracerProvider.RegisterSpanProcessor(samplingAttrProcessor{sampler: sampler, rules: cfg.SamplingRules})
+	}
+	if cfg.Canary {
+		tracerProvider.RegisterSpanProcessor(canaryProcessor{})
+	}
+	if cfg.MaxSpanDuration > 0 {
+		// 開いたままのスパンを強制的に終了させ、エクスポートされるようにします。
+		tracerProvider.RegisterSpanProcessor(newWatchdogProcessor(cfg.MaxSpanDuration))
+	}
 	return tracerProvider, nil
 }
 
-func newMeterProvider() (*metric.MeterProvider, error) {
-	metricExporter, err := stdoutmetric.New()
+// newSpanAttributeProcessorsは、エクスポートする前にスパンの属性へ適用する処理を、適用する順に返します。
+func newSpanAttributeProcessors(cfg config) []SpanAttributeProcessor {
+	processors := cfg.SpanAttributeProcessors
+	if cfg.SemconvCompat == "dup" {
+		processors = append(slices.Clip(processors), legacySemconvAttributes{})
+	}
+	if cfg.AttributeNaming != "off" {
+		// 命名規則の確認は、設定された変換をすべて適用した後に行います。
+		processors = append(slices.Clip(processors), &namingConvention{rename: cfg.AttributeNaming == "rename"})
+	}
+	if cfg.AttributeValueMaxLength > 0 {
+		// 切り詰めは、キーの変換がすべて終わった後の値に対して行います。
+		processors = append(slices.Clip(processors), truncateAttributes{maxLen: cfg.AttributeValueMaxLength})
+	}
+	return processors
+}
+
+// wrapSpanContentは、service.nameのないスパンの破棄と属性の処理をexpに適用します。
+// 送信先ごとに内容が変わらないよう、スパンを書き出すすべてのエクスポーターに適用してください。
+func wrapSpanContent(exp trace.SpanExporter, cfg config, processors []SpanAttributeProcessor, diagLogger *slog.Logger) trace.SpanExporter {
+	if cfg.ServiceNameCheck != "off" {
+		exp = &serviceNameExporter{SpanExporter: exp, logger: diagLogger}
+	}
+	if len(processors) > 0 {
+		exp = &attributeProcessingExporter{SpanExporter: exp, processors: processors}
+	}
+	return exp
+}
+
+// buildTracerProviderは、expへスパンをバッチでエクスポートするトレースプロバイダーを作成します。
+// 他のバイナリーからも、独自のエクスポーターでこのサービスと同じパイプラインを構築できます。
+func buildTracerProvider(exp trace.SpanExporter, res *resource.Resource, sampler trace.Sampler, opts ...trace.BatchSpanProcessorOption) *trace.TracerProvider {
+	return trace.NewTracerProvider(
+		trace.WithResource(res),
+		trace.WithSampler(sampler),
+		trace.WithBatcher(exp, opts...),
+	)
+}
+
+func newMetricExporter(ctx context.Context, cfg config, conn *grpc.ClientConn) (metric.Exporter, error) {
+	if cfg.MetricsExporter == "otlp" {
+		return otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithGRPCConn(conn),
+			otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig{Enabled: false}),
+			otlpmetricgrpc.WithHeaders(cfg.OTLPHeaders))
+	}
+	exporter, err := stdoutmetric.New()
+	if err != nil {
+		return nil, err
+	}
+	return &stdoutMetricExporter{Exporter: exporter, failures: newStdoutFailures("metrics", cfg.StdoutMaxWriteFailures)}, nil
+}
+
+// newExemplarFilterは、設定された名前のエグザンプラーのフィルターを返します。
+// 既定の"trace_based"では、サンプリングされたスパンの中で記録された値に、トレースIDとスパンIDをエグザンプラーとして付与します。
+func newExemplarFilter(name string) exemplar.Filter {
+	switch name {
+	case "always_on":
+		return exemplar.AlwaysOnFilter
+	case "always_off":
+		return exemplar.AlwaysOffFilter
+	default:
+		return exemplar.TraceBasedFilter
+	}
+}
+
+// newMeterProviderは、メトリクスを設定されたエクスポーターへ定期的にプッシュするメータープロバイダーを返します。
+// readersを指定すると、同じ計装のメトリクスをそれらのリーダーからも取得できます。
+// 例えばPrometheusのリーダーを渡すと、OTLPでのプッシュと/metricsでのプルを同時に行えます。
+func newMeterProvider(ctx context.Context, cfg config, res *resource.Resource, conn *grpc.ClientConn, stats *exportStats, readers ...metric.Reader) (*metric.MeterProvider, error) {
+	var metricExporter metric.Exporter
+	metricExporter, err := newMetricExporter(ctx, cfg, conn)
 	if err != nil {
 		return nil, err
 	}
+	metricExporter = &countingMetricExporter{Exporter: metricExporter, stats: stats}
+	if len(cfg.MetricResourceAttributes) > 0 {
+		metricExporter = &resourceAttrExporter{Exporter: metricExporter, keys: cfg.MetricResourceAttributes}
+	}
+	if len(cfg.MetricDeltaInstruments) > 0 {
+		metricExporter = newDeltaExporter(metricExporter, cfg.MetricDeltaInstruments)
+	}
 
-	meterProvider := metric.NewMeterProvider(
+	opts := []metric.Option{
+		metric.WithResource(res),
 		metric.WithReader(metric.NewPeriodicReader(metricExporter,
-			// デフォルトは1分です。デモ用に3秒に設定しています。
-			metric.WithInterval(3*time.Second))),
-	)
+			metric.WithInterval(cfg.MetricInterval))),
+		metric.WithExemplarFilter(newExemplarFilter(cfg.ExemplarFilter)),
+	}
+	if cfg.ExemplarReservoirSize > 0 {
+		// すべての計装で、エグザンプラーを集計の種類によらず指定した数まで保持します。
+		opts = append(opts, metric.WithView(metric.NewView(
+			metric.Instrument{Name: "*"},
+			metric.Stream{ExemplarReservoirProviderSelector: func(metric.Aggregation) exemplar.ReservoirProvider {
+				return exemplar.FixedSizeReservoirProvider(cfg.ExemplarReservoirSize)
+			}},
+		)))
+	}
+	for _, r := range readers {
+		opts = append(opts, metric.WithReader(r))
+	}
+
+	meterProvider := metric.NewMeterProvider(opts...)
 	return meterProvider, nil
 }
 
-func newLoggerProvider() (*log.LoggerProvider, error) {
-	logExporter, err := stdoutlog.New()
+func newLogExporter(ctx context.Context, cfg config, conn *grpc.ClientConn) (log.Exporter, error) {
+	if cfg.LogsExporter == "otlp" {
+		return otlploggrpc.New(ctx,
+			otlploggrpc.WithGRPCConn(conn),
+			otlploggrpc.WithRetry(otlploggrpc.RetryConfig{Enabled: false}),
+			otlploggrpc.WithHeaders(cfg.OTLPHeaders))
+	}
+	exporter, err := stdoutlog.New()
 	if err != nil {
 		return nil, err
 	}
+	return &stdoutLogExporter{Exporter: exporter, failures: newStdoutFailures("logs", cfg.StdoutMaxWriteFailures)}, nil
+}
 
-	loggerProvider := log.NewLoggerProvider(
-		log.WithProcessor(log.NewBatchProcessor(logExporter)),
-	)
+// newLoggerProviderFuncは、setupOTelSDKがロガープロバイダーの作成に使う関数です。
+// テストで作成の失敗を再現するために差し替えます。
+var newLoggerProviderFunc = newLoggerProvider
+
+func newLoggerProvider(ctx context.Context, cfg config, res *resource.Resource, conn *grpc.ClientConn, stats *exportStats) (*log.LoggerProvider, error) {
+	logExporter, err := newLogExporter(ctx, cfg, conn)
+	if err != nil {
+		return nil, err
+	}
+	logExporter = &countingLogExporter{Exporter: logExporter, stats: stats}
+
+	opts := []log.LoggerProviderOption{
+		log.WithResource(res),
+	}
+	if cfg.LogSeverityMap != nil {
+		// 重大度番号の置き換えは、エクスポートするプロセッサーより前に行います。
+		opts = append(opts, log.WithProcessor(severityProcessor{mapping: cfg.LogSeverityMap}))
+	}
+	var processor log.Processor
+	if cfg.LogQueueSize > 0 {
+		// ログが急増した際に、設定した方針で古いものか新しいものを破棄します。
+		bounded := newBoundedLogProcessor(logExporter, cfg.LogQueueSize, cfg.LogQueuePolicy, time.Second)
+		if err := registerDroppedLogsCounter(bounded); err != nil {
+			return nil, errors.Join(err, bounded.Shutdown(context.Background()))
+		}
+		processor = bounded
+	} else {
+		processor = log.NewBatchProcessor(logExporter)
+	}
+	if cfg.LogSampleRatio < 1 {
+		// WARN未満のログは、キューに入れる前に間引きます。
+		processor = newSamplingLogProcessor(processor, cfg.LogSampleRatio)
+	}
+	opts = append(opts, log.WithProcessor(processor))
+
+	loggerProvider := log.NewLoggerProvider(opts...)
 	return loggerProvider, nil
 }
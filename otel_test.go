@@ -0,0 +1,712 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	lognoop "go.opentelemetry.io/otel/log/noop"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// newTestMeterProviderは、設定どおりのメータープロバイダーと、そのメトリクスを収集するリーダーを返します。
+func newTestMeterProvider(t testing.TB, cfg config) (*metric.MeterProvider, *metric.ManualReader) {
+	t.Helper()
+	reader := metric.NewManualReader()
+	mp, err := newMeterProvider(context.Background(), cfg, resource.Empty(), nil, &exportStats{}, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	return mp, reader
+}
+
+// findMetricは、rmからnameという名前のメトリクスを探します。
+func findMetric(t testing.TB, rm metricdata.ResourceMetrics, name string) metricdata.Metrics {
+	t.Helper()
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	t.Fatalf("metric %q not found", name)
+	return metricdata.Metrics{}
+}
+
+// collectは、readerからメトリクスを収集します。
+func collect(t testing.TB, reader metric.Reader) metricdata.ResourceMetrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	return rm
+}
+
+func TestRollDurationExemplarCarriesTraceID(t *testing.T) {
+	cfg := newTestConfig(t)
+	mp, reader := newTestMeterProvider(t, cfg)
+	tp := trace.NewTracerProvider()
+	h := newTestDiceHandler(t, cfg, tp, mp)
+
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+	req.SetPathValue("player", "alice")
+	ctx, span := tp.Tracer("test").Start(req.Context(), "server")
+	h.rolldice(httptest.NewRecorder(), req.WithContext(ctx))
+	span.End()
+
+	m := findMetric(t, collect(t, reader), "dice.roll.duration")
+	dps := m.Data.(metricdata.Histogram[float64]).DataPoints
+	if len(dps) != 1 || len(dps[0].Exemplars) == 0 {
+		t.Fatalf("got %d data points without exemplars, want an exemplar", len(dps))
+	}
+	want := span.SpanContext().TraceID()
+	if got := dps[0].Exemplars[0].TraceID; string(got) != string(want[:]) {
+		t.Errorf("exemplar trace ID = %x, want %s", got, want)
+	}
+}
+
+func TestExemplarReservoirSize(t *testing.T) {
+	t.Setenv("OTEL_METRICS_EXEMPLAR_FILTER", "always_on")
+	t.Setenv("METRIC_EXEMPLAR_RESERVOIR_SIZE", "2")
+	mp, reader := newTestMeterProvider(t, newTestConfig(t))
+	counter, _ := mp.Meter(name).Int64Counter("dice.rolls")
+	for i := range 10 {
+		counter.Add(context.Background(), int64(i+1))
+	}
+
+	dps := findMetric(t, collect(t, reader), "dice.rolls").Data.(metricdata.Sum[int64]).DataPoints
+	if len(dps) != 1 || len(dps[0].Exemplars) != 2 {
+		t.Fatalf("data points = %+v, want one with 2 exemplars", dps)
+	}
+
+	t.Setenv("METRIC_EXEMPLAR_RESERVOIR_SIZE", "0")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "METRIC_EXEMPLAR_RESERVOIR_SIZE") {
+		t.Errorf("loadConfig() with a reservoir size of 0 = %v, want an error naming it", err)
+	}
+}
+
+func TestSetupOTelSDKContinuesWithoutLoggerProvider(t *testing.T) {
+	orig := newLoggerProviderFunc
+	newLoggerProviderFunc = func(context.Context, config, *resource.Resource, *grpc.ClientConn, *exportStats) (*log.LoggerProvider, error) {
+		return nil, errors.New("forced failure")
+	}
+	t.Cleanup(func() { newLoggerProviderFunc = orig })
+
+	shutdown, err := setupOTelSDK(context.Background(), newLiveConfig(newTestConfig(t)))
+	if err != nil {
+		t.Fatalf("setupOTelSDK failed: %v", err)
+	}
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+	if _, ok := global.GetLoggerProvider().(lognoop.LoggerProvider); !ok {
+		t.Errorf("logger provider = %T, want the no-op provider", global.GetLoggerProvider())
+	}
+	if _, ok := otel.GetTracerProvider().(*trace.TracerProvider); !ok {
+		t.Errorf("tracer provider = %T, want the SDK provider", otel.GetTracerProvider())
+	}
+}
+
+func TestResourceSchemaURL(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{name: "default", want: semconv.SchemaURL},
+		{name: "configured", env: "https://opentelemetry.io/schemas/1.26.0", want: "https://opentelemetry.io/schemas/1.26.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("RESOURCE_SCHEMA_URL", tt.env)
+			}
+			res, err := newResource(context.Background(), newTestConfig(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := res.SchemaURL(); got != tt.want {
+				t.Errorf("schema URL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevModeRecordsNoSpans(t *testing.T) {
+	t.Setenv("TELEMETRY_MODE", "dev")
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	shutdown, err := setupOTelSDK(context.Background(), newLiveConfig(newTestConfig(t)))
+	if err != nil {
+		t.Fatalf("setupOTelSDK failed: %v", err)
+	}
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+	tp := otel.GetTracerProvider()
+	if _, ok := tp.(tracenoop.TracerProvider); !ok {
+		t.Fatalf("tracer provider = %T, want the no-op provider", tp)
+	}
+	_, span := tp.Tracer(name).Start(context.Background(), "roll")
+	span.End()
+	if span.IsRecording() || span.SpanContext().IsValid() {
+		t.Error("span was recorded in dev mode")
+	}
+
+	// 計装の呼び出しは、no-opのトレーサーでもそのまま動作します。
+	h := newTestDiceHandler(t, newTestConfig(t), tp, otel.GetMeterProvider())
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+	req.SetPathValue("player", "alice")
+	rec := httptest.NewRecorder()
+	h.rolldice(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestBuildTracerProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	res := resource.NewSchemaless(semconv.ServiceName("other-binary"))
+	tp := buildTracerProvider(exporter, res, trace.AlwaysSample())
+
+	_, span := tp.Tracer(name).Start(context.Background(), "work")
+	span.End()
+	// InMemoryExporterはシャットダウン時に記録を消去するため、フラッシュのみ行います。
+	if err := tp.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "work" {
+		t.Fatalf("exported %v, want the work span", spans)
+	}
+	if got, _ := spans[0].Resource.Set().Value(semconv.ServiceNameKey); got.AsString() != "other-binary" {
+		t.Errorf("service.name = %q, want other-binary", got.AsString())
+	}
+}
+
+// resourceValueは、resの属性keyの値を返します。
+func resourceValue(t testing.TB, res *resource.Resource, key attribute.Key) string {
+	t.Helper()
+	v, ok := res.Set().Value(key)
+	if !ok {
+		t.Fatalf("resource has no %s", key)
+	}
+	return v.AsString()
+}
+
+func TestServiceInstanceID(t *testing.T) {
+	ctx := context.Background()
+	first, err := newResource(ctx, newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newResource(ctx, newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := resourceValue(t, first, semconv.ServiceInstanceIDKey)
+	if _, err := uuid.Parse(id); err != nil {
+		t.Errorf("service.instance.id = %q, want a UUID", id)
+	}
+	if got := resourceValue(t, second, semconv.ServiceInstanceIDKey); got != id {
+		t.Errorf("service.instance.id changed within the process: %q, then %q", id, got)
+	}
+
+	t.Setenv("OTEL_SERVICE_INSTANCE_ID", "dice-7f9c")
+	configured, err := newResource(ctx, newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resourceValue(t, configured, semconv.ServiceInstanceIDKey); got != "dice-7f9c" {
+		t.Errorf("service.instance.id = %q, want the configured dice-7f9c", got)
+	}
+}
+
+func TestRuntimeResourceAttributes(t *testing.T) {
+	keys := []attribute.Key{semconv.ProcessRuntimeVersionKey, semconv.OSTypeKey}
+	t.Setenv("RESOURCE_RUNTIME_ATTRIBUTES", "true")
+	res, err := newResource(context.Background(), newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if v := resourceValue(t, res, key); v == "" {
+			t.Errorf("%s is empty", key)
+		}
+	}
+
+	t.Setenv("RESOURCE_RUNTIME_ATTRIBUTES", "false")
+	res, err = newResource(context.Background(), newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if _, ok := res.Set().Value(key); ok {
+			t.Errorf("%s recorded without RESOURCE_RUNTIME_ATTRIBUTES", key)
+		}
+	}
+}
+
+func TestServiceNameCheck(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	os.Unsetenv("OTEL_SERVICE_NAME")
+
+	t.Run("off uses the default name", func(t *testing.T) {
+		res, err := newResource(ctx, newTestConfig(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resourceValue(t, res, semconv.ServiceNameKey); got != defaultServiceName {
+			t.Errorf("service.name = %q, want %q", got, defaultServiceName)
+		}
+	})
+
+	t.Run("fail without a name", func(t *testing.T) {
+		t.Setenv("SERVICE_NAME_CHECK", "fail")
+		shutdown, err := setupOTelSDK(ctx, newLiveConfig(newTestConfig(t)))
+		if err == nil {
+			_ = shutdown(ctx)
+			t.Fatal("setupOTelSDK() succeeded, want an error for the missing service.name")
+		}
+		if !strings.Contains(err.Error(), "service.name") {
+			t.Errorf("setupOTelSDK() = %v, want an error naming service.name", err)
+		}
+	})
+
+	t.Run("fail with a name from the resource attributes", func(t *testing.T) {
+		t.Setenv("SERVICE_NAME_CHECK", "fail")
+		t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "service.name=dice-attrs")
+		res, err := newResource(ctx, newTestConfig(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasServiceName(res) {
+			t.Errorf("hasServiceName(%v) = false, want true", res)
+		}
+	})
+}
+
+func TestGRPCMaxSendMsgSize(t *testing.T) {
+	// 4MiBを超えるスパンのバッチです。
+	large := attribute.String("payload", strings.Repeat("x", 5<<20))
+
+	tests := []struct {
+		name    string
+		maxSize int
+		wantErr bool
+	}{
+		{name: "default limit accepts large batch", maxSize: 0, wantErr: false},
+		{name: "smaller limit rejects large batch", maxSize: 1 << 20, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recv := &traceReceiver{}
+			cfg := startTraceReceiver(t, recv, grpc.MaxRecvMsgSize(64<<20))
+			if tt.maxSize > 0 {
+				cfg.GRPCMaxSendMsgSize = tt.maxSize
+			}
+			cfg.RetryInitialInterval = time.Millisecond
+			cfg.RetryMaxElapsedTime = 10 * time.Millisecond
+			conn, err := initConn(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			exporter, err := newTraceExporter(context.Background(), cfg, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spans := tracetest.SpanStubs{{Name: "large", Attributes: []attribute.KeyValue{large}}}.Snapshots()
+			err = exporter.ExportSpans(context.Background(), spans)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("ExportSpans() = %v, want error: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(recv.spanNames(), []string{"large"}) {
+				t.Errorf("received spans = %v, want [large]", recv.spanNames())
+			}
+		})
+	}
+}
+
+// encodingRecorderは、サーバーが受信したリクエストの圧縮方式を記録するgRPCのstats.Handlerです。
+// grpc-encodingは予約されたヘッダーで、メタデータからは参照できないため使用します。
+type encodingRecorder struct {
+	mu        sync.Mutex
+	encodings []string
+}
+
+func (r *encodingRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		r.mu.Lock()
+		r.encodings = append(r.encodings, h.Compression)
+		r.mu.Unlock()
+	}
+}
+
+func (r *encodingRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestSecondaryOTLPEndpoint(t *testing.T) {
+	ctx := context.Background()
+	diagLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	primary, secondary := &traceReceiver{}, &traceReceiver{}
+	cfg := startTraceReceiver(t, primary)
+	cfg.OTLPSecondaryEndpoint = startTraceReceiver(t, secondary).OTLPEndpoint
+	cfg.ServiceNameCheck = "drop"
+
+	// exportは、resのトレースプロバイダーでspanNameのスパンを1つエクスポートします。
+	export := func(res *resource.Resource, spanName string) {
+		t.Helper()
+		conn, err := initConn(cfg, diagLogger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		tp, err := newTracerProvider(ctx, cfg, res, conn, trace.AlwaysSample(), diagLogger, &exportStats{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, span := tp.Tracer(name).Start(ctx, spanName)
+		span.End()
+		_ = tp.Shutdown(ctx)
+	}
+	named := resource.NewSchemaless(semconv.ServiceName("dice"))
+
+	export(named, "both")
+	// 1つ目のコレクターが失敗しても、2つ目には送信されます。
+	primary.mu.Lock()
+	primary.fail = true
+	primary.mu.Unlock()
+	export(named, "primary-down")
+	// 2つ目の送信先にも、service.nameのないスパンの破棄などの同じ処理を適用します。
+	export(resource.Empty(), "unnamed")
+
+	if got := primary.spanNames(); !slices.Equal(got, []string{"both"}) {
+		t.Errorf("primary received %v, want [both]", got)
+	}
+	if got := secondary.spanNames(); !slices.Equal(got, []string{"both", "primary-down"}) {
+		t.Errorf("secondary received %v, want [both primary-down]", got)
+	}
+}
+
+func TestOTLPCompression(t *testing.T) {
+	for _, compression := range []string{"none", "gzip"} {
+		t.Run(compression, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", compression)
+			recorder := &encodingRecorder{}
+			cfg := startTraceReceiver(t, &traceReceiver{}, grpc.StatsHandler(recorder))
+			conn, err := initConn(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			exporter, err := newTraceExporter(context.Background(), cfg, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := exporter.ExportSpans(context.Background(), tracetest.SpanStubs{{Name: "roll"}}.Snapshots()); err != nil {
+				t.Fatal(err)
+			}
+
+			want := ""
+			if compression == "gzip" {
+				want = "gzip"
+			}
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			if !slices.Equal(recorder.encodings, []string{want}) {
+				t.Errorf("grpc-encoding = %q, want [%q]", recorder.encodings, want)
+			}
+		})
+	}
+}
+
+// logReceiverは、受信したログの本文を記録するOTLPのモックのレシーバーです。
+type logReceiver struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (r *logReceiver) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rl := range req.ResourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				r.bodies = append(r.bodies, lr.Body.GetStringValue())
+			}
+		}
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestOTLPLogsOverSharedConnection(t *testing.T) {
+	logRecv := &logReceiver{}
+	traceRecv := &traceReceiver{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, traceRecv)
+	collogspb.RegisterLogsServiceServer(srv, logRecv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cfg := newTestConfig(t)
+	cfg.TracesExporter = "otlp"
+	cfg.LogsExporter = "otlp"
+	cfg.OTLPEndpoint = lis.Addr().String()
+	conn, err := initConn(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ctx := context.Background()
+	lp, err := newLoggerProvider(ctx, cfg, resource.Empty(), conn, &exportStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lp.Shutdown(context.Background()) })
+	traceExporter, err := newTraceExporter(ctx, cfg, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slog.New(otelslog.NewHandler(name, otelslog.WithLoggerProvider(lp))).InfoContext(ctx, "rolled")
+	if err := lp.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := traceExporter.ExportSpans(ctx, tracetest.SpanStubs{{Name: "roll"}}.Snapshots()); err != nil {
+		t.Fatal(err)
+	}
+
+	logRecv.mu.Lock()
+	defer logRecv.mu.Unlock()
+	if !slices.Equal(logRecv.bodies, []string{"rolled"}) {
+		t.Errorf("received logs = %q, want [rolled]", logRecv.bodies)
+	}
+	if !slices.Equal(traceRecv.spanNames(), []string{"roll"}) {
+		t.Errorf("received spans = %v, want [roll] over the same connection", traceRecv.spanNames())
+	}
+}
+
+// connCounterは、サーバーが受け付けたコネクションの数を数えるgRPCのstats.Handlerです。
+type connCounter struct {
+	conns atomic.Int32
+}
+
+func (c *connCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (c *connCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleConn(_ context.Context, s stats.ConnStats) {
+	if _, ok := s.(*stats.ConnBegin); ok {
+		c.conns.Add(1)
+	}
+}
+
+func TestSetupOTelSDKSharesOneConnection(t *testing.T) {
+	prevTP, prevMP, prevLP := otel.GetTracerProvider(), otel.GetMeterProvider(), global.GetLoggerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetMeterProvider(prevMP)
+		global.SetLoggerProvider(prevLP)
+	})
+
+	counter := &connCounter{}
+	traceRecv, metricRecv, logRecv := &traceReceiver{}, &metricReceiver{}, &logReceiver{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.StatsHandler(counter))
+	coltracepb.RegisterTraceServiceServer(srv, traceRecv)
+	colmetricpb.RegisterMetricsServiceServer(srv, metricRecv)
+	collogspb.RegisterLogsServiceServer(srv, logRecv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	t.Setenv("OTEL_METRICS_EXPORTER", "otlp")
+	t.Setenv("OTEL_LOGS_EXPORTER", "otlp")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", lis.Addr().String())
+	ctx := context.Background()
+	shutdown, err := setupOTelSDK(ctx, newLiveConfig(newTestConfig(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := otel.Tracer(name).Start(ctx, "roll")
+	span.End()
+	rolls, _ := otel.Meter(name).Int64Counter("dice.rolls")
+	rolls.Add(ctx, 1)
+	slog.New(otelslog.NewHandler(name)).InfoContext(ctx, "rolled")
+	// シャットダウンで、3つのシグナルをすべて送り切ります。
+	if err := shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	metricRecv.mu.Lock()
+	gotMetric := slices.Contains(metricRecv.names, "dice.rolls")
+	metricRecv.mu.Unlock()
+	logRecv.mu.Lock()
+	gotLog := slices.Contains(logRecv.bodies, "rolled")
+	logRecv.mu.Unlock()
+	if !slices.Contains(traceRecv.spanNames(), "roll") || !gotMetric || !gotLog {
+		t.Fatalf("received span: %v, metric: %t, log: %t, want all three signals", traceRecv.spanNames(), gotMetric, gotLog)
+	}
+	if n := counter.conns.Load(); n != 1 {
+		t.Errorf("connections = %d, want 1 shared by all exporters", n)
+	}
+}
+
+func TestShutdownStepDurationsLogged(t *testing.T) {
+	capture := &captureLogExporter{}
+	orig := newLoggerProviderFunc
+	newLoggerProviderFunc = func(context.Context, config, *resource.Resource, *grpc.ClientConn, *exportStats) (*log.LoggerProvider, error) {
+		return log.NewLoggerProvider(log.WithProcessor(log.NewSimpleProcessor(capture))), nil
+	}
+	t.Cleanup(func() { newLoggerProviderFunc = orig })
+	prevTP, prevMP, prevLP := otel.GetTracerProvider(), otel.GetMeterProvider(), global.GetLoggerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetMeterProvider(prevMP)
+		global.SetLoggerProvider(prevLP)
+	})
+
+	shutdown, err := setupOTelSDK(context.Background(), newLiveConfig(newTestConfig(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// ロガープロバイダーより先に停止するプロバイダーの所要時間は、ログとしても送信されます。
+	steps := map[string]bool{}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	for _, r := range capture.records {
+		if r.Body().AsString() != "shutdown step finished" {
+			continue
+		}
+		var step string
+		var hasDuration bool
+		r.WalkAttributes(func(kv otellog.KeyValue) bool {
+			switch kv.Key {
+			case "step":
+				step = kv.Value.AsString()
+			case "duration":
+				hasDuration = true
+			}
+			return true
+		})
+		steps[step] = hasDuration
+	}
+	for _, step := range []string{"tracer_provider", "meter_provider"} {
+		if !steps[step] {
+			t.Errorf("no shutdown duration logged for %s, got %v", step, steps)
+		}
+	}
+}
+
+func TestShutdownFlushesLogsLast(t *testing.T) {
+	capture := &captureLogExporter{}
+	orig := newLoggerProviderFunc
+	newLoggerProviderFunc = func(context.Context, config, *resource.Resource, *grpc.ClientConn, *exportStats) (*log.LoggerProvider, error) {
+		return log.NewLoggerProvider(log.WithProcessor(log.NewSimpleProcessor(capture))), nil
+	}
+	t.Cleanup(func() { newLoggerProviderFunc = orig })
+	prevTP, prevMP, prevLP := otel.GetTracerProvider(), otel.GetMeterProvider(), global.GetLoggerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetMeterProvider(prevMP)
+		global.SetLoggerProvider(prevLP)
+	})
+
+	shutdown, err := setupOTelSDK(context.Background(), newLiveConfig(newTestConfig(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// トレースとメトリクスの停止を記録した後、最後に完了のログを送信してからロガープロバイダーを停止します。
+	var steps []string
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	for _, r := range capture.records {
+		step := r.Body().AsString()
+		r.WalkAttributes(func(kv otellog.KeyValue) bool {
+			if kv.Key == "step" {
+				step = kv.Value.AsString()
+			}
+			return true
+		})
+		steps = append(steps, step)
+	}
+	tracerAt := slices.Index(steps, "tracer_provider")
+	meterAt := slices.Index(steps, "meter_provider")
+	if tracerAt < 0 || meterAt < 0 || tracerAt > meterAt {
+		t.Errorf("shutdown logs = %v, want tracer_provider then meter_provider", steps)
+	}
+	if len(steps) == 0 || steps[len(steps)-1] != "Telemetry shutdown complete, flushing logs" {
+		t.Errorf("shutdown logs = %v, want the completion log last", steps)
+	}
+	if slices.Contains(steps, loggerProviderStep) {
+		t.Errorf("shutdown logs = %v, want nothing logged after the logger provider stops", steps)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// newOTLPFileExporterは、スパンをOTLP/JSON形式でpathのファイルに追記するSpanExporterを返します。
+// OTLPエクスポーターと同じ変換を使うため、コレクターに送信される内容と同じ構造になります。
+// 1回のエクスポートごとに、ExportTraceServiceRequestを1行のJSONとして書き込みます。
+func newOTLPFileExporter(ctx context.Context, path string) (trace.SpanExporter, error) {
+	return otlptrace.New(ctx, &otlpFileClient{path: path})
+}
+
+// otlpFileClientは、OTLPのリクエストを送信する代わりにファイルへ書き込むotlptrace.Clientです。
+type otlpFileClient struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ otlptrace.Client = (*otlpFileClient)(nil)
+
+func (c *otlpFileClient) Start(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open OTLP file: %w", err)
+	}
+	c.file = f
+	return nil
+}
+
+func (c *otlpFileClient) Stop(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func (c *otlpFileClient) UploadTraces(_ context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	b, err := marshalOTLPJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return fmt.Errorf("OTLP file %s is not open", c.path)
+	}
+	_, err = c.file.Write(append(b, '\n'))
+	return err
+}
+
+// otlpIDFieldsは、OTLP/JSONで16進数の文字列として表すIDのフィールドです。
+var otlpIDFields = map[string]bool{
+	"traceId":      true,
+	"spanId":       true,
+	"parentSpanId": true,
+}
+
+// marshalOTLPJSONは、reqをOTLP/JSON形式に変換します。
+// OTLP/JSONでは列挙型を数値で表します。また、protojsonはbytes型のフィールドをBase64で出力しますが、
+// トレースIDとスパンIDは16進数の文字列で表すため、それらのフィールドを変換し直します。
+func marshalOTLPJSON(req *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// 大きな数値の精度が落ちないよう、数値はそのまま保持します。
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err := hexEncodeIDs(v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// hexEncodeIDsは、v以下のすべてのIDのフィールドをBase64から16進数の文字列に変換します。
+func hexEncodeIDs(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok && otlpIDFields[k] {
+				id, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("invalid %s %q: %w", k, s, err)
+				}
+				v[k] = hex.EncodeToString(id)
+				continue
+			}
+			if err := hexEncodeIDs(e); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if err := hexEncodeIDs(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
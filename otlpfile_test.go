@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// otlpFileSpanは、OTLP/JSONのファイルから読み取ったスパンのうち、テストで確認する項目です。
+type otlpFileSpan struct {
+	TraceID    string `json:"traceId"`
+	SpanID     string `json:"spanId"`
+	Name       string `json:"name"`
+	Attributes []struct {
+		Key string `json:"key"`
+	} `json:"attributes"`
+}
+
+// readOTLPFileは、pathの各行をExportTraceServiceRequestのOTLP/JSONとして読み取り、含まれるスパンを返します。
+func readOTLPFile(t testing.TB, path string) []otlpFileSpan {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []otlpFileSpan
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpFileSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			t.Fatalf("line %q is not valid JSON: %v", sc.Text(), err)
+		}
+		if len(req.ResourceSpans) == 0 {
+			t.Fatalf("line %q has no resourceSpans", sc.Text())
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+func TestOTLPFileExporterWritesOTLPJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	exporter, err := newOTLPFileExporter(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+	_, span := tp.Tracer(name).Start(context.Background(), "roll")
+	span.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readOTLPFile(t, path)
+	if len(spans) != 1 || spans[0].Name != "roll" {
+		t.Fatalf("spans = %+v, want the roll span", spans)
+	}
+	// OTLP/JSONでは、IDはbase64ではなく16進数の文字列です。
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(spans[0].TraceID) {
+		t.Errorf("traceId = %q, want 32 hex digits", spans[0].TraceID)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(spans[0].SpanID) {
+		t.Errorf("spanId = %q, want 16 hex digits", spans[0].SpanID)
+	}
+}
+
+func TestOTLPFileAppliesSpanProcessing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	t.Setenv("SPAN_ATTRIBUTE_PROCESSORS", "drop:secret")
+	t.Setenv("SPAN_DROP_ATTRIBUTE", "drop=yes")
+	cfg := newTestConfig(t)
+	cfg.TracesOTLPFile = path
+
+	ctx := context.Background()
+	diagLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := newTracerProvider(ctx, cfg, res, nil, newSampler(cfg), diagLogger, &exportStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := tp.Tracer(name)
+	_, kept := tracer.Start(ctx, "kept", oteltrace.WithAttributes(attribute.String("secret", "hunter2")))
+	kept.End()
+	_, dropped := tracer.Start(ctx, "dropped", oteltrace.WithAttributes(attribute.String("drop", "yes")))
+	dropped.End()
+	if err := tp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readOTLPFile(t, path)
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		t.Fatalf("spans = %+v, want only the kept span", spans)
+	}
+	for _, a := range spans[0].Attributes {
+		if a.Key == "secret" {
+			t.Error("secret attribute was written to the OTLP file")
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// partialSuccessInterceptorは、OTLPのエクスポートのレスポンスに部分的な成功（partial_success）が含まれる場合に、
+// 拒否された件数とメッセージをWARNで記録するgrpc.UnaryClientInterceptorを返します。
+// コレクターが一部のデータのみを受け付けた場合も、エクスポート自体は成功として扱われるため、ログで気付けるようにします。
+func partialSuccessInterceptor(logger *slog.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			return err
+		}
+		var signal, message string
+		var rejected int64
+		switch resp := reply.(type) {
+		case *coltracepb.ExportTraceServiceResponse:
+			signal = "traces"
+			rejected = resp.GetPartialSuccess().GetRejectedSpans()
+			message = resp.GetPartialSuccess().GetErrorMessage()
+		case *colmetricspb.ExportMetricsServiceResponse:
+			signal = "metrics"
+			rejected = resp.GetPartialSuccess().GetRejectedDataPoints()
+			message = resp.GetPartialSuccess().GetErrorMessage()
+		case *collogspb.ExportLogsServiceResponse:
+			signal = "logs"
+			rejected = resp.GetPartialSuccess().GetRejectedLogRecords()
+			message = resp.GetPartialSuccess().GetErrorMessage()
+		default:
+			return nil
+		}
+		if rejected != 0 || message != "" {
+			logger.WarnContext(ctx, "OTLP export partially succeeded",
+				"signal", signal, "rejected", rejected, "message", message)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+)
+
+// partialTraceReceiverは、常に一部のスパンを拒否した部分的な成功を返すOTLPのモックのレシーバーです。
+type partialTraceReceiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+}
+
+func (partialTraceReceiver) Export(context.Context, *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	return &coltracepb.ExportTraceServiceResponse{
+		PartialSuccess: &coltracepb.ExportTracePartialSuccess{
+			RejectedSpans: 2,
+			ErrorMessage:  "span name too long",
+		},
+	}, nil
+}
+
+func TestPartialSuccessLogged(t *testing.T) {
+	cfg := startTraceReceiver(t, partialTraceReceiver{})
+	var buf bytes.Buffer
+	conn, err := initConn(cfg, slog.New(slog.NewTextHandler(&buf, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	if _, err := coltracepb.NewTraceServiceClient(conn).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{}); err != nil {
+		t.Fatalf("Export() = %v, want a partial success without error", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"OTLP export partially succeeded", "signal=traces", "rejected=2", `message="span name too long"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log = %q, want it to contain %s", out, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// probeDialTimeoutは、コレクターへの疎通確認1回あたりの接続の待機時間です。
+const probeDialTimeout = 2 * time.Second
+
+// probeCollectorは、endpointへのTCP接続を試み、コレクターに到達できるかを確認します。
+// 到達できない場合は、initialから倍々に増やした間隔（maxBackoffまで）で最大attempts回まで試みます。
+// コレクターがサービスより後に起動する環境でも、起動直後のエクスポートの失敗を避けられます。
+func probeCollector(ctx context.Context, endpoint string, attempts int, initial, maxBackoff time.Duration) error {
+	var dialer net.Dialer
+	backoff := initial
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		dialCtx, cancel := context.WithTimeout(ctx, probeDialTimeout)
+		var conn net.Conn
+		conn, err = dialer.DialContext(dialCtx, "tcp", endpoint)
+		cancel()
+		if err == nil {
+			return conn.Close()
+		}
+		if attempt == attempts {
+			break
+		}
+		log.Printf("Collector at %s is unreachable (attempt %d/%d), retrying in %v: %v", endpoint, attempt, attempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+	return fmt.Errorf("collector at %s is unreachable after %d attempts: %w", endpoint, attempts, err)
+}
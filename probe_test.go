@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeCollectorWaitsForCollector(t *testing.T) {
+	addr := freeAddr(t)
+	// コレクターは、何度か疎通確認に失敗した後に起動します。
+	started := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+		}
+		started <- ln
+	}()
+	t.Cleanup(func() {
+		if ln := <-started; ln != nil {
+			ln.Close()
+		}
+	})
+
+	if err := probeCollector(context.Background(), addr, 20, 5*time.Millisecond, 20*time.Millisecond); err != nil {
+		t.Errorf("probeCollector() = %v, want nil once the collector is up", err)
+	}
+}
+
+func TestProbeCollectorGivesUp(t *testing.T) {
+	addr := freeAddr(t)
+	if err := probeCollector(context.Background(), addr, 3, time.Millisecond, time.Millisecond); err == nil {
+		t.Error("probeCollector() = nil, want an error for an unreachable collector")
+	}
+}
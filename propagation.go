@@ -0,0 +1,15 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// injectContextは、ctxのトレースコンテキストとバゲージを、グローバルなプロパゲーターでreqのヘッダーに設定します。
+// 下流のサービスへリクエストを送信する際は、送信前に必ず呼び出してください。
+func injectContext(ctx context.Context, req *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestFetchSamplingRatioPropagatesContext(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.Write([]byte(`{"ratio": 0.5}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	member, err := baggage.NewMember("tenant", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	ctx, span := trace.NewTracerProvider().Tracer(name).Start(ctx, "poll")
+	defer span.End()
+
+	if _, err := fetchSamplingRatio(ctx, srv.Client(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := header.Get("traceparent"); !strings.Contains(got, span.SpanContext().TraceID().String()) {
+		t.Errorf("traceparent = %q, want trace ID %s", got, span.SpanContext().TraceID())
+	}
+	if got := header.Get("baggage"); got != "tenant=acme" {
+		t.Errorf("baggage = %q, want tenant=acme", got)
+	}
+}
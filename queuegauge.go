@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanQueueTrackerは、バッチプロセッサーのキューに溜まっているスパンの数を追跡します。
+// SDKのバッチプロセッサーはキューの長さを公開しないため、キューに入ったスパンの数から
+// エクスポーターに渡されたスパンの数を引いて求めます。
+//
+// 数えるのはバッチプロセッサーに直接渡したスパンだけなので、フィルターやbackpressureProcessorで
+// 破棄されたスパンは含まれません。
+// ただし、WithBlockingを指定していないバッチプロセッサーがキューが満杯で破棄したスパンは
+// SDKから知る方法がないため差し引かれず、破棄が発生した後の値は実際より大きくなります。
+type spanQueueTracker struct {
+	pending atomic.Int64
+}
+
+// processorは、nextに渡すスパンを数えるSpanProcessorを返します。
+// nextには、wrapExporterで包んだエクスポーターを使うバッチプロセッサーを渡し、
+// フィルターなどスパンを破棄するプロセッサーよりも内側に置いてください。
+func (t *spanQueueTracker) processor(next trace.SpanProcessor) trace.SpanProcessor {
+	return &spanQueueCounter{tracker: t, next: next}
+}
+
+// wrapExporterは、エクスポーターに渡されたスパンを数えるSpanExporterを返します。
+func (t *spanQueueTracker) wrapExporter(exp trace.SpanExporter) trace.SpanExporter {
+	return &spanQueueExporter{SpanExporter: exp, tracker: t}
+}
+
+// registerGaugeは、キューの長さをotel.bsp.queue_sizeとして報告するゲージを登録します。
+func (t *spanQueueTracker) registerGauge() error {
+	_, err := otel.Meter(name).Int64ObservableGauge("otel.bsp.queue_size",
+		metric.WithDescription("The number of spans waiting in the batch span processor queue"),
+		metric.WithUnit("{span}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(max(t.pending.Load(), 0))
+			return nil
+		}))
+	return err
+}
+
+// spanQueueCounterは、バッチプロセッサーに渡すサンプリングされたスパンを数えるSpanProcessorです。
+type spanQueueCounter struct {
+	tracker *spanQueueTracker
+	next    trace.SpanProcessor
+
+	// stoppedは、Shutdownの後に終了したスパンを数えないようにします。
+	// 停止したバッチプロセッサーは、渡されたスパンをエクスポートせずに破棄します。
+	stopped atomic.Bool
+}
+
+func (p *spanQueueCounter) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *spanQueueCounter) OnEnd(s trace.ReadOnlySpan) {
+	// サンプリングされていないスパンは、バッチプロセッサーのキューに入りません。
+	if s.SpanContext().IsSampled() && !p.stopped.Load() {
+		p.tracker.pending.Add(1)
+	}
+	p.next.OnEnd(s)
+}
+
+func (p *spanQueueCounter) Shutdown(ctx context.Context) error {
+	p.stopped.Store(true)
+	return p.next.Shutdown(ctx)
+}
+
+func (p *spanQueueCounter) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// spanQueueExporterは、エクスポートを試みたスパンをキューの長さから差し引くSpanExporterです。
+type spanQueueExporter struct {
+	trace.SpanExporter
+	tracker *spanQueueTracker
+}
+
+func (e *spanQueueExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	e.tracker.pending.Add(-int64(len(spans)))
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestSpanQueueは、グローバルなメータープロバイダーにゲージを登録したspanQueueTrackerと、
+// otel.bsp.queue_sizeの現在の値を返す関数を返します。
+func newTestSpanQueue(t testing.TB) (*spanQueueTracker, func() int64) {
+	t.Helper()
+	prev := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	otel.SetMeterProvider(mp)
+
+	queue := &spanQueueTracker{}
+	if err := queue.registerGauge(); err != nil {
+		t.Fatal(err)
+	}
+	return queue, func() int64 {
+		t.Helper()
+		g := findMetric(t, collect(t, reader), "otel.bsp.queue_size").Data.(metricdata.Gauge[int64])
+		return g.DataPoints[0].Value
+	}
+}
+
+func TestSpanQueueGauge(t *testing.T) {
+	queue, queueSize := newTestSpanQueue(t)
+	// バッチのタイムアウトを長くし、フラッシュするまでスパンがキューに留まるようにします。
+	bsp := trace.NewBatchSpanProcessor(queue.wrapExporter(tracetest.NewInMemoryExporter()), trace.WithBatchTimeout(time.Hour))
+	tp := trace.NewTracerProvider(trace.WithSpanProcessor(queue.processor(bsp)))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	for range 3 {
+		_, span := tp.Tracer(name).Start(context.Background(), "roll")
+		span.End()
+	}
+	if got := queueSize(); got != 3 {
+		t.Errorf("otel.bsp.queue_size = %d, want 3 queued spans", got)
+	}
+
+	if err := tp.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := queueSize(); got != 0 {
+		t.Errorf("otel.bsp.queue_size after flush = %d, want 0", got)
+	}
+}
+
+func TestSpanQueueGaugeSkipsFilteredSpans(t *testing.T) {
+	queue, queueSize := newTestSpanQueue(t)
+	bsp := trace.NewBatchSpanProcessor(queue.wrapExporter(tracetest.NewInMemoryExporter()), trace.WithBatchTimeout(time.Hour))
+	filter := newSpanFilter("synthetic", "true")
+	tp := trace.NewTracerProvider(trace.WithSpanProcessor(filter.wrapProcessors(queue.processor(bsp))))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	_, span := tp.Tracer(name).Start(context.Background(), "probe")
+	span.SetAttributes(attribute.String("synthetic", "true"))
+	span.End()
+	_, span = tp.Tracer(name).Start(context.Background(), "roll")
+	span.End()
+	if got := queueSize(); got != 1 {
+		t.Errorf("otel.bsp.queue_size = %d, want only the unfiltered span", got)
+	}
+
+	if err := tp.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := queueSize(); got != 0 {
+		t.Errorf("otel.bsp.queue_size after flush = %d, want 0", got)
+	}
+}
+
+func TestSpanQueueGaugeSkipsSpansDroppedByBackpressure(t *testing.T) {
+	queue, queueSize := newTestSpanQueue(t)
+	exporter := &gatedSpanExporter{gate: make(chan struct{})}
+	bsp := trace.NewBatchSpanProcessor(queue.wrapExporter(exporter),
+		trace.WithMaxQueueSize(1), trace.WithMaxExportBatchSize(1), trace.WithBlocking())
+	p := newBackpressureProcessor(queue.processor(bsp), 20*time.Millisecond)
+	tp := trace.NewTracerProvider(trace.WithSpanProcessor(p))
+
+	// エクスポートが止まっている間にキューを溢れさせ、待機の後に破棄されるスパンを発生させます。
+	for range 6 {
+		_, span := tp.Tracer(name).Start(context.Background(), "roll")
+		span.End()
+	}
+	if p.dropped.Load() == 0 {
+		t.Fatal("no spans were dropped, want the backpressure timeout to drop some")
+	}
+
+	close(exporter.gate)
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := queueSize(); got != 0 {
+		t.Errorf("otel.bsp.queue_size after shutdown = %d, want 0", got)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// liveConfigは、再起動せずに変更を反映できる設定を保持します。
+type liveConfig struct {
+	cfg atomic.Pointer[config]
+	// muは、applyとsetSamplerRatioによる設定の更新を直列化します。
+	// 読み取りはロックせずにcfgから行います。
+	mu sync.Mutex
+
+	// samplerとlogLevelは、設定の再読み込み時に更新されます。
+	sampler  *dynamicSampler
+	logLevel *slog.LevelVar
+
+	// resは、setupOTelSDKが作成したリソースです。設定の再読み込みでは更新しません。
+	// SDKをセットアップする前はnilです。
+	res atomic.Pointer[resource.Resource]
+}
+
+// newLiveConfigは、cfgを初期値とするliveConfigを返します。
+func newLiveConfig(cfg config) *liveConfig {
+	l := &liveConfig{
+		sampler:  newDynamicSampler(newSampler(cfg)),
+		logLevel: new(slog.LevelVar),
+	}
+	l.logLevel.Set(cfg.LogLevel)
+	l.cfg.Store(&cfg)
+	return l
+}
+
+// configは、現在有効な設定を返します。
+func (l *liveConfig) config() config {
+	return *l.cfg.Load()
+}
+
+// logSamplerは、現在のサンプリングの割合とサンプラーの構成をログに記録します。
+// 実際に使用するサンプリングの割合を、起動時に確認できるようにするために使います。
+func (l *liveConfig) logSampler() {
+	log.Printf("Sampler: ratio %v, %s", l.config().SamplerRatio, l.sampler.Description())
+}
+
+// applyは、cfgのうち実行中に反映できる設定（サンプリングの割合とログレベル）を反映します。
+// それ以外の変更は再起動が必要なため、無視した旨をログに出力します。
+func (l *liveConfig) apply(cfg config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cur := l.config()
+
+	next := cur
+	// 設定サービスからサンプリングの割合を取得している場合は、そちらの値を維持します。
+	if cur.SamplingConfigURL == "" {
+		next.SamplerRatio = cfg.SamplerRatio
+	}
+	next.LogLevel = cfg.LogLevel
+	l.sampler.set(newSampler(next))
+	l.logLevel.Set(next.LogLevel)
+	l.cfg.Store(&next)
+	log.Printf("Config reloaded: sampler ratio %v, log level %v", next.SamplerRatio, next.LogLevel)
+
+	// 反映した項目を揃えたうえで、残りの差分を無視した項目として報告します。
+	cfg.SamplerRatio = next.SamplerRatio
+	cfg.LogLevel = next.LogLevel
+	cv, nv := reflect.ValueOf(next), reflect.ValueOf(cfg)
+	for i := range cv.NumField() {
+		if !reflect.DeepEqual(cv.Field(i).Interface(), nv.Field(i).Interface()) {
+			log.Printf("Config reload: ignoring change to %s, a restart is required", cv.Type().Field(i).Name)
+		}
+	}
+}
+
+// setSamplerRatioは、サンプリングの割合をratioに変更します。
+// 変更がない場合は何もせず、falseを返します。
+func (l *liveConfig) setSamplerRatio(ratio float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cur := l.config()
+	if cur.SamplerRatio == ratio {
+		return false
+	}
+	next := cur
+	next.SamplerRatio = ratio
+	l.sampler.set(newSampler(next))
+	l.cfg.Store(&next)
+	return true
+}
+
+// watchReloadは、SIGHUPを受け取るたびに設定ファイルと環境変数から設定を再読み込みし、liveに反映します。
+// ctxが終了するまでブロックします。
+func watchReload(ctx context.Context, live *liveConfig) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			cfg, err := loadConfig()
+			if err != nil {
+				log.Printf("Config reload failed: %v", err)
+				continue
+			}
+			live.apply(cfg)
+		}
+	}
+}
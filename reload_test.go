@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchReloadAppliesSamplerRatioOnSIGHUP(t *testing.T) {
+	live := newLiveConfig(newTestConfig(t))
+
+	// watchReloadが登録する前に届いたSIGHUPでテストのプロセスが終了しないようにします。
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	t.Cleanup(func() { signal.Stop(guard) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchReload(ctx, live)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+	t.Setenv("LOG_LEVEL", "debug")
+
+	// watchReloadがシグナルを受け取れるようになるまで、繰り返し送信します。
+	deadline := time.Now().Add(5 * time.Second)
+	for live.config().SamplerRatio != 0.25 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sampler ratio = %v after SIGHUP, want 0.25", live.config().SamplerRatio)
+		}
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := live.logLevel.Level(); got != slog.LevelDebug {
+		t.Errorf("log level = %v, want %v", got, slog.LevelDebug)
+	}
+	if got := live.sampler.Description(); !strings.Contains(got, "TraceIDRatioBased{0.25}") {
+		t.Errorf("sampler = %q, want it rebuilt with the new ratio", got)
+	}
+}
+
+func TestLogSamplerReportsConfiguredRatio(t *testing.T) {
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.3")
+	live := newLiveConfig(newTestConfig(t))
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	live.logSampler()
+
+	out := buf.String()
+	if !strings.Contains(out, "Sampler: ratio 0.3,") || !strings.Contains(out, "TraceIDRatioBased{0.3}") {
+		t.Errorf("log = %q, want ratio 0.3", out)
+	}
+
+	// /debug/configでも同じ割合を確認できます。
+	rec := httptest.NewRecorder()
+	debugConfigHandler(live)(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	var got struct {
+		SamplerRatio float64 `json:"sampler_ratio"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SamplerRatio != 0.3 {
+		t.Errorf("sampler_ratio = %v, want 0.3", got.SamplerRatio)
+	}
+}
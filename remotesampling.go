@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// samplingConfigFetchTimeoutは、設定サービスへの1回のリクエストの待機時間です。
+const samplingConfigFetchTimeout = 5 * time.Second
+
+// remoteSamplingConfigは、設定サービスが返すサンプリングの設定です。
+type remoteSamplingConfig struct {
+	// Ratioは、ルートスパンをサンプリングする割合（0〜1）です。
+	Ratio *float64 `json:"ratio"`
+}
+
+// fetchSamplingRatioは、urlからサンプリングの設定を取得し、割合を返します。
+func fetchSamplingRatio(ctx context.Context, client *http.Client, url string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, samplingConfigFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	injectContext(ctx, req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var c remoteSamplingConfig
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&c); err != nil {
+		return 0, fmt.Errorf("decode sampling config: %w", err)
+	}
+	switch {
+	case c.Ratio == nil:
+		return 0, fmt.Errorf("sampling config has no ratio")
+	case *c.Ratio < 0 || *c.Ratio > 1:
+		return 0, fmt.Errorf("ratio %v out of range [0, 1]", *c.Ratio)
+	}
+	return *c.Ratio, nil
+}
+
+// pollSamplingConfigは、intervalごとにurlからサンプリングの設定を取得し、liveのサンプラーに反映します。
+// 取得に失敗した場合は、最後に取得できた割合を使い続けます。
+// ctxが終了するまでブロックします。
+func pollSamplingConfig(ctx context.Context, client *http.Client, url string, interval time.Duration, live *liveConfig) {
+	poll := func() {
+		ratio, err := fetchSamplingRatio(ctx, client, url)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Sampling config fetch failed, keeping ratio %v: %v", live.config().SamplerRatio, err)
+			}
+			return
+		}
+		if live.setSamplerRatio(ratio) {
+			log.Printf("Sampling config updated: sampler ratio %v", ratio)
+		}
+	}
+
+	poll()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			poll()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPollSamplingConfigUpdatesSampler(t *testing.T) {
+	// 設定サービスは、ratioの値を返します。負の値の間は500を返します。
+	var ratio atomic.Value
+	ratio.Store(0.25)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		v := ratio.Load().(float64)
+		if v < 0 {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"ratio": %v}`, v)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := newTestConfig(t)
+	cfg.SamplingConfigURL = srv.URL
+	live := newLiveConfig(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pollSamplingConfig(ctx, srv.Client(), srv.URL, 5*time.Millisecond, live)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// waitRatioは、サンプリングの割合がwantになるまで待機します。
+	waitRatio := func(want float64) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); live.config().SamplerRatio != want; {
+			if time.Now().After(deadline) {
+				t.Fatalf("sampler ratio = %v, want %v", live.config().SamplerRatio, want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if got, want := live.sampler.Description(), newSampler(live.config()).Description(); got != want {
+			t.Errorf("sampler = %s, want %s", got, want)
+		}
+	}
+	waitRatio(0.25)
+	ratio.Store(0.75)
+	waitRatio(0.75)
+
+	// 取得に失敗している間は、最後に取得できた割合を使い続けます。
+	ratio.Store(-1.0)
+	for n := requests.Load() + 3; requests.Load() < n; {
+		time.Sleep(time.Millisecond)
+	}
+	waitRatio(0.75)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exportStatsは、実行中にエクスポートしたテレメトリーの数と、エクスポートの失敗回数を集計します。
+// シャットダウン時にまとめてログに記録します。
+type exportStats struct {
+	spans      atomic.Int64
+	spanErrors atomic.Int64
+	// spansSpooledは、送信に失敗してディスクに退避したスパンの数です。再送に成功してもspansには加算しません。
+	spansSpooled atomic.Int64
+	metrics      atomic.Int64
+	metricErrs   atomic.Int64
+	logs         atomic.Int64
+	logErrors    atomic.Int64
+}
+
+// logSummaryは、集計した結果を1行のログとしてloggerに記録します。
+func (s *exportStats) logSummary(ctx context.Context, logger *slog.Logger) {
+	logger.InfoContext(ctx, "Telemetry export summary",
+		"spans", s.spans.Load(),
+		"span_export_errors", s.spanErrors.Load(),
+		"spans_spooled", s.spansSpooled.Load(),
+		"metrics", s.metrics.Load(),
+		"metric_export_errors", s.metricErrs.Load(),
+		"logs", s.logs.Load(),
+		"log_export_errors", s.logErrors.Load(),
+	)
+}
+
+// countingSpanExporterは、エクスポートしたスパンの数と失敗回数をexportStatsに記録するSpanExporterです。
+// ディスクに退避したスパンは、エクスポートしたスパンとは別に数えます。
+type countingSpanExporter struct {
+	trace.SpanExporter
+	stats *exportStats
+}
+
+func (e *countingSpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if errors.Is(err, errBatchSpooled) {
+		// 退避したスパンは後で再送されるため、サーキットブレーカーなどの外側のエクスポーターには失敗として伝えません。
+		e.stats.spansSpooled.Add(int64(len(spans)))
+		return nil
+	}
+	if err != nil {
+		e.stats.spanErrors.Add(1)
+		return err
+	}
+	e.stats.spans.Add(int64(len(spans)))
+	return nil
+}
+
+// countingMetricExporterは、エクスポートしたメトリクスの数と失敗回数をexportStatsに記録するmetric.Exporterです。
+// メトリクスの数は、エクスポートのたびに含まれていたメトリクス（計装）の数の合計です。
+type countingMetricExporter struct {
+	metric.Exporter
+	stats *exportStats
+}
+
+func (e *countingMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if err := e.Exporter.Export(ctx, rm); err != nil {
+		e.stats.metricErrs.Add(1)
+		return err
+	}
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		n += len(sm.Metrics)
+	}
+	e.stats.metrics.Add(int64(n))
+	return nil
+}
+
+// countingLogExporterは、エクスポートしたログの数と失敗回数をexportStatsに記録するlog.Exporterです。
+type countingLogExporter struct {
+	log.Exporter
+	stats *exportStats
+}
+
+func (e *countingLogExporter) Export(ctx context.Context, records []log.Record) error {
+	if err := e.Exporter.Export(ctx, records); err != nil {
+		e.stats.logErrors.Add(1)
+		return err
+	}
+	e.stats.logs.Add(int64(len(records)))
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExportSummary(t *testing.T) {
+	ctx := context.Background()
+	stats := &exportStats{}
+
+	// スパン: 2件成功し、別のエクスポーターで1回失敗します。
+	tp := trace.NewTracerProvider(trace.WithSyncer(&countingSpanExporter{SpanExporter: tracetest.NewInMemoryExporter(), stats: stats}))
+	for range 2 {
+		_, span := tp.Tracer(name).Start(ctx, "roll")
+		span.End()
+	}
+	failing := &countingSpanExporter{SpanExporter: failingSpanExporter{}, stats: stats}
+	_ = failing.ExportSpans(ctx, tracetest.SpanStubs{{Name: "lost"}}.Snapshots())
+	// ディスクに退避したスパンは、成功とも失敗とも別に数えます。
+	spooled := &countingSpanExporter{SpanExporter: failingSpanExporter{err: errBatchSpooled}, stats: stats}
+	if err := spooled.ExportSpans(ctx, tracetest.SpanStubs{{Name: "spooled"}}.Snapshots()); err != nil {
+		t.Errorf("ExportSpans() of a spooled batch = %v, want nil", err)
+	}
+
+	// メトリクス: 1つの計装を1回エクスポートします。
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	counter, _ := mp.Meter(name).Int64Counter("dice.rolls")
+	counter.Add(ctx, 1)
+	rm := collect(t, reader)
+	if err := (&countingMetricExporter{Exporter: &captureMetricExporter{}, stats: stats}).Export(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	// ログ: 3件エクスポートします。
+	lp := log.NewLoggerProvider(log.WithProcessor(log.NewSimpleProcessor(&countingLogExporter{Exporter: &captureLogExporter{}, stats: stats})))
+	logger := otelslog.NewLogger(name, otelslog.WithLoggerProvider(lp))
+	for range 3 {
+		logger.Info("rolled")
+	}
+
+	var buf bytes.Buffer
+	stats.logSummary(ctx, slog.New(slog.NewTextHandler(&buf, nil)))
+	out := buf.String()
+	for _, want := range []string{"spans=2", "span_export_errors=1", "spans_spooled=1", "metrics=1", "metric_export_errors=0", "logs=3", "log_export_errors=0"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary = %q, want it to contain %s", out, want)
+		}
+	}
+}
+
+// failingSpanExporterは、常にエクスポートに失敗するSpanExporterです。
+// errを指定した場合は、errをラップしたエラーを返します。
+type failingSpanExporter struct {
+	err error
+}
+
+func (e failingSpanExporter) ExportSpans(context.Context, []trace.ReadOnlySpan) error {
+	if e.err != nil {
+		return fmt.Errorf("traces export: %w", e.err)
+	}
+	return errors.New("collector unavailable")
+}
+
+func (failingSpanExporter) Shutdown(context.Context) error { return nil }
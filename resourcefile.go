@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// resourceFileAttributeは、リソースのファイルに記述する属性です。
+// typeには、valueの型として"string"、"int"または"bool"を指定します。
+type resourceFileAttribute struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// resourceFromFileは、pathのJSONファイルに記述された属性からリソースを作成します。
+// ファイルには、次のように型を指定した属性の配列を記述します。
+//
+//	[
+//	  {"key": "deployment.environment.name", "type": "string", "value": "production"},
+//	  {"key": "k8s.replicas", "type": "int", "value": 3},
+//	  {"key": "feature.canary", "type": "bool", "value": false}
+//	]
+//
+// 値が指定した型でない場合はエラーを返します。
+func resourceFromFile(path string) (*resource.Resource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read resource file: %w", err)
+	}
+	var entries []resourceFileAttribute
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("parse resource file %s: %w", path, err)
+	}
+	attrs := make([]attribute.KeyValue, 0, len(entries))
+	for i, e := range entries {
+		if e.Key == "" {
+			return nil, fmt.Errorf("resource file %s: attribute %d has no key", path, i)
+		}
+		kv, err := e.attribute()
+		if err != nil {
+			return nil, fmt.Errorf("resource file %s: attribute %q: %w", path, e.Key, err)
+		}
+		attrs = append(attrs, kv)
+	}
+	return resource.NewSchemaless(attrs...), nil
+}
+
+// attributeは、eをtypeで指定した型の属性に変換します。
+func (e resourceFileAttribute) attribute() (attribute.KeyValue, error) {
+	switch e.Type {
+	case "string":
+		var v string
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return attribute.KeyValue{}, fmt.Errorf("value %s is not a string", e.Value)
+		}
+		return attribute.String(e.Key, v), nil
+	case "int":
+		var v int64
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return attribute.KeyValue{}, fmt.Errorf("value %s is not an int", e.Value)
+		}
+		return attribute.Int64(e.Key, v), nil
+	case "bool":
+		var v bool
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return attribute.KeyValue{}, fmt.Errorf("value %s is not a bool", e.Value)
+		}
+		return attribute.Bool(e.Key, v), nil
+	default:
+		return attribute.KeyValue{}, fmt.Errorf("unsupported type %q, expected string, int or bool", e.Type)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// writeResourceFileは、contentを書き込んだリソースのファイルのパスを返します。
+func writeResourceFile(t testing.TB, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "resource.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResourceFromFileMixedTypes(t *testing.T) {
+	t.Setenv("RESOURCE_FILE", writeResourceFile(t, `[
+		{"key": "deployment.environment.name", "type": "string", "value": "production"},
+		{"key": "k8s.replicas", "type": "int", "value": 3},
+		{"key": "feature.canary", "type": "bool", "value": false}
+	]`))
+	res, err := newResource(context.Background(), newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[attribute.Key]attribute.Value{
+		"deployment.environment.name": attribute.StringValue("production"),
+		"k8s.replicas":                attribute.Int64Value(3),
+		"feature.canary":              attribute.BoolValue(false),
+	} {
+		if got, ok := res.Set().Value(key); !ok || got != want {
+			t.Errorf("%s = %s (%s), want %s (%s)", key, got.Emit(), got.Type(), want.Emit(), want.Type())
+		}
+	}
+	// 既定のリソースの属性と統合されます。
+	if _, ok := res.Set().Value(semconv.ServiceNameKey); !ok {
+		t.Error("service.name missing after merging the resource file")
+	}
+}
+
+func TestResourceFromFileRejectsInvalidTypes(t *testing.T) {
+	for _, content := range []string{
+		`[{"key": "k8s.replicas", "type": "int", "value": "3"}]`,
+		`[{"key": "feature.canary", "type": "bool", "value": 1}]`,
+		`[{"key": "region", "type": "float", "value": 1.5}]`,
+		`[{"type": "string", "value": "x"}]`,
+	} {
+		if _, err := resourceFromFile(writeResourceFile(t, content)); err == nil {
+			t.Errorf("resourceFromFile(%s) succeeded, want an error", content)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryableCodesは、OTLPの仕様で一時的なエラーとされているgRPCのステータスコードです。
+var retryableCodes = map[codes.Code]bool{
+	codes.Canceled:          true,
+	codes.DeadlineExceeded:  true,
+	codes.ResourceExhausted: true,
+	codes.Aborted:           true,
+	codes.OutOfRange:        true,
+	codes.Unavailable:       true,
+	codes.DataLoss:          true,
+}
+
+// retryInterceptorは、OTLPのエクスポートが一時的なエラーで失敗した場合に、
+// ジッターを加えた指数バックオフで再送するgrpc.UnaryClientInterceptorを返します。
+// 待機時間はinitialから倍々に増え、maxIntervalで頭打ちになります。最初の送信からmaxElapsedを過ぎると諦めます。
+// 各再送の試行回数と待機時間は、ログが溢れないようDEBUGで記録します。
+func retryInterceptor(initial, maxInterval, maxElapsed time.Duration, logger *slog.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		deadline := time.Now().Add(maxElapsed)
+		interval := initial
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || !retryableCodes[status.Code(err)] || ctx.Err() != nil {
+				return err
+			}
+			// 待機時間は、interval の0.5倍から1.5倍の範囲でばらつかせます。
+			backoff := time.Duration(float64(interval) * (0.5 + rand.Float64()))
+			if time.Now().Add(backoff).After(deadline) {
+				return err
+			}
+			logger.Debug("OTLP export failed, retrying",
+				"method", method, "attempt", attempt, "backoff", backoff, "error", err)
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			}
+			interval = min(interval*2, maxInterval)
+		}
+	}
+}
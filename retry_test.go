@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// flakyInvokerは、最初のfailures回をUnavailableで失敗させ、その後は成功するgrpc.UnaryInvokerを返します。
+// callsには、呼び出された回数を記録します。
+func flakyInvoker(failures int, calls *int) grpc.UnaryInvoker {
+	return func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		*calls++
+		if *calls <= failures {
+			return status.Error(codes.Unavailable, "collector unavailable")
+		}
+		return nil
+	}
+}
+
+func TestRetryInterceptorLogsEachAttempt(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	retry := retryInterceptor(time.Millisecond, 10*time.Millisecond, time.Second, logger)
+
+	var calls int
+	if err := retry(context.Background(), "/Export", nil, nil, nil, flakyInvoker(2, &calls)); err != nil {
+		t.Fatalf("retry = %v, want success on the third attempt", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2 retry logs: %q", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, "level=DEBUG") || !strings.Contains(line, fmt.Sprintf("attempt=%d", i+1)) || !strings.Contains(line, "backoff=") {
+			t.Errorf("log line %d = %q, want a DEBUG retry log with attempt %d and the backoff", i, line, i+1)
+		}
+	}
+}
+
+func TestRetryInterceptorQuietAtInfo(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	retry := retryInterceptor(time.Millisecond, 10*time.Millisecond, time.Second, logger)
+
+	var calls int
+	if err := retry(context.Background(), "/Export", nil, nil, nil, flakyInvoker(2, &calls)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("log = %q, want no retry logs above DEBUG", buf.String())
+	}
+}
+
+func TestRetryInterceptorStopsOnPermanentError(t *testing.T) {
+	retry := retryInterceptor(time.Millisecond, 10*time.Millisecond, time.Second, slog.New(slog.DiscardHandler))
+	calls := 0
+	invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.InvalidArgument, "rejected")
+	}
+	if err := retry(context.Background(), "/Export", nil, nil, nil, invoker); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("retry = %v, want the InvalidArgument error", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 without retries", calls)
+	}
+}
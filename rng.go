@@ -0,0 +1,26 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"math/big"
+	"math/rand"
+)
+
+// newIntnは、sourceの乱数源で[0, n)の整数を返す関数を返します。
+// "crypto"の場合はcrypto/rand、それ以外の場合はmath/randを使用します。
+func newIntn(source string) func(n int) int {
+	if source == "crypto" {
+		return cryptoIntn
+	}
+	return rand.Intn
+}
+
+// cryptoIntnは、crypto/randで一様に選んだ[0, n)の整数を返します。
+func cryptoIntn(n int) int {
+	v, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		// crypto/rand.Readerからの読み取りは失敗しないため、到達しません。
+		panic(err)
+	}
+	return int(v.Int64())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"dice/spantest"
+)
+
+func TestCryptoIntnInRange(t *testing.T) {
+	seen := map[int]bool{}
+	for range 1000 {
+		v := cryptoIntn(6)
+		if v < 0 || v >= 6 {
+			t.Fatalf("cryptoIntn(6) = %d, want [0, 6)", v)
+		}
+		seen[v] = true
+	}
+	if len(seen) != 6 {
+		t.Errorf("cryptoIntn(6) produced %v over 1000 draws, want every value", seen)
+	}
+}
+
+func TestRolldiceRecordsRNG(t *testing.T) {
+	for _, source := range []string{"crypto", "math"} {
+		t.Run(source, func(t *testing.T) {
+			t.Setenv("DICE_RNG", source)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+			req.SetPathValue("player", "alice")
+			rec := httptest.NewRecorder()
+			h.rolldice(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+			spantest.AssertAttribute(t, roll, "dice.rng", attribute.StringValue(source))
+		})
+	}
+}
@@ -1,58 +1,392 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
-	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/language"
 )
 
 const name = "go.opentelemetry.io/otel/example/dice"
 
-var (
-	tracer = otel.Tracer(name)
-	meter  = otel.Meter(name)
-	logger = otelslog.NewLogger(name)
-	rollCnt metric.Int64Counter
-)
+var errInvalidPlayer = errors.New("player name contains control characters")
+
+// maxDiceSidesは、サイコロの面の数の上限です。
+// 出目をメトリクスの属性として記録するため、属性の値の種類が増えすぎないよう制限しています。
+const maxDiceSides = 100
+
+// diceHandlerは、サイコロを振るHTTPハンドラーです。
+// グローバルなプロバイダーに依存せず、トレーサーやメーターを外部から注入できます。
+type diceHandler struct {
+	tracer       trace.Tracer
+	logger       *slog.Logger
+	rollCnt      metric.Int64Counter
+	valueSum     metric.Int64Counter
+	rollDuration metric.Float64Histogram
+	concurrency  metric.Int64UpDownCounter
+	errCnt       metric.Int64Counter
+	bytesPerRoll metric.Float64Histogram
+	waitDuration metric.Int64Histogram
+
+	// limiterは、同時に処理するロールの数を制限します。nilの場合は無制限です。
+	limiter *concurrencyLimiter
+	// playerMaxLengthは、属性として記録するプレイヤー名の最大文字数です。
+	playerMaxLength int
+	// maxDiceは、1回のリクエストで振れるサイコロの最大数です。
+	maxDice int
+	// anonymousPlayerは、プレイヤー名のないリクエストで使うプレイヤー名です。
+	anonymousPlayer string
+	// redirectAnonymousがtrueの場合、プレイヤー名のないリクエストをanonymousPlayerのルートにリダイレクトします。
+	redirectAnonymous bool
+	// rngは、出目を決める乱数源の名前です（"crypto"または"math"）。
+	rng string
+	// intnは、rngの乱数源で[0, n)の整数を返します。
+	intn func(n int) int
+	// idempotencyは、Idempotency-Keyごとの結果を保持します。nilの場合は無効です。
+	idempotency *idempotencyCache
+	// flakyは、/rolldice/flakyで失敗させるかを決める乱数源です。nilの場合は無効です。
+	flaky *flakySource
+	// vendorTraceStateは、上流から伝搬されなかった場合にtracestateに設定するベンダーのエントリーの値です。
+	vendorTraceState string
+	// drainは、ドレインの状態です。ドレイン中は新しいロールを503で拒否します。nilの場合は無効です。
+	drain *drainState
+}
 
-func init() {
-	var err error
-	rollCnt, err = meter.Int64Counter("dice.rolls",
+// newDiceHandlerは、指定したトレーサー・メーター・ロガーを使用するdiceHandlerを返します。
+func newDiceHandler(cfg config, tracer trace.Tracer, meter metric.Meter, logger *slog.Logger) (*diceHandler, error) {
+	rollCnt, err := meter.Int64Counter("dice.rolls",
 		metric.WithDescription("The number of rolls by roll value"),
 		metric.WithUnit("{roll}"))
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	// dice.rollsのすべての属性の合計で割ると、出目の平均を求められます。
+	valueSum, err := meter.Int64Counter("dice.roll.value_sum",
+		metric.WithDescription("The sum of all rolled values"),
+		metric.WithUnit("{pip}"))
+	if err != nil {
+		return nil, err
+	}
+	rollDuration, err := meter.Float64Histogram("dice.roll.duration",
+		metric.WithDescription("The duration of dice rolls"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	concurrency, err := meter.Int64UpDownCounter("dice.concurrency",
+		metric.WithDescription("The number of rolls currently in progress"),
+		metric.WithUnit("{roll}"))
+	if err != nil {
+		return nil, err
+	}
+
+	errCnt, err := meter.Int64Counter("dice.errors",
+		metric.WithDescription("The number of failed rolls by error type"),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		return nil, err
+	}
+
+	bytesPerRoll, err := meter.Float64Histogram("dice.request.bytes_per_roll",
+		metric.WithDescription("The request body size per die rolled, for detecting abusive requests"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
 	}
+
+	// 上限に達していない場合は0を記録するため、待機が発生したリクエストの割合も読み取れます。
+	waitDuration, err := meter.Int64Histogram("dice.wait.duration",
+		metric.WithDescription("The time spent waiting for a concurrency slot"),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return nil, err
+	}
+
+	h := &diceHandler{
+		tracer:       tracer,
+		logger:       logger,
+		rollCnt:      rollCnt,
+		valueSum:     valueSum,
+		rollDuration: rollDuration,
+		concurrency:  concurrency,
+		errCnt:       errCnt,
+		bytesPerRoll: bytesPerRoll,
+		waitDuration: waitDuration,
+
+		playerMaxLength: cfg.PlayerMaxLength,
+		maxDice:         cfg.MaxDice,
+		rng:             cfg.RNG,
+		intn:            newIntn(cfg.RNG),
+
+		anonymousPlayer:   cfg.AnonymousPlayer,
+		redirectAnonymous: cfg.AnonymousPlayerRedirect,
+		vendorTraceState:  cfg.VendorTraceState,
+	}
+	if cfg.IdempotencyTTL > 0 {
+		h.idempotency = newIdempotencyCache(cfg.IdempotencyTTL)
+	}
+	if cfg.FlakyEndpoint {
+		h.flaky = newFlakySource(cfg.FlakySeed)
+	}
+	if cfg.ConcurrencyLimit > 0 {
+		h.limiter = newConcurrencyLimiter(cfg.ConcurrencyLimit, cfg.ConcurrencyWait, cfg.ConcurrencyWaitTimeout)
+	}
+	return h, nil
+}
+
+// newDefaultDiceHandlerは、グローバルなプロバイダーを使用するdiceHandlerを返します。
+func newDefaultDiceHandler(cfg config, logger *slog.Logger) (*diceHandler, error) {
+	return newDiceHandler(cfg, otel.Tracer(name), otel.Meter(name), logger)
 }
 
-func rolldice(w http.ResponseWriter, r *http.Request) {
-	ctx, span := tracer.Start(r.Context(), "roll")
+// rolldiceAnonymousは、プレイヤー名のない/rolldice/へのリクエストを処理します。
+// リダイレクトが有効な場合は、クエリを保ったまま既定のプレイヤー名のルートにリダイレクトします。
+func (h *diceHandler) rolldiceAnonymous(w http.ResponseWriter, r *http.Request) {
+	if !h.redirectAnonymous {
+		h.rolldice(w, r)
+		return
+	}
+	target := "/rolldice/" + url.PathEscape(h.anonymousPlayer)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+}
+
+func (h *diceHandler) rolldice(w http.ResponseWriter, r *http.Request) {
+	// ミドルウェアでの処理時間も含めるため、リクエストの開始時刻から計測します。
+	start := requestStart(r.Context())
+	// 上流からベンダーのエントリーが伝搬されなかった場合は、ロールのスパンを開始する前に設定し、
+	// ロールのスパンと下流へのリクエストに引き継がれるようにします。
+	parent := r.Context()
+	if _, ok := vendorTraceState(parent); !ok && h.vendorTraceState != "" {
+		// 値は設定の読み込み時に検証済みです。
+		if c, err := setVendorTraceState(parent, h.vendorTraceState); err == nil {
+			parent = c
+		}
+	}
+	ctx, span := h.tracer.Start(parent, "roll")
 	defer span.End()
+	rollStart := time.Now()
+	// スパンが有効なコンテキストで記録することで、エグザンプラーにトレースIDが付与されます。
+	defer func() {
+		h.rollDuration.Record(ctx, time.Since(start).Seconds())
+	}()
 
-	roll := 1 + rand.Intn(6)
+	// レスポンスの言語を決定します。
+	locale := detectLocale(r)
+	span.SetAttributes(attribute.String("http.locale", locale.String()))
+
+	// ドレイン中は新しいロールを受け付けず、処理中のロールのみを完了させます。
+	leave, ok := h.enterDrain(ctx, w, locale)
+	if !ok {
+		return
+	}
+	defer leave()
+
+	// バックエンドを壊さないよう、プレイヤー名を属性として使う前に検証します。
+	player, err := sanitizePlayer(r.PathValue("player"), h.playerMaxLength)
+	if err != nil {
+		h.fail(ctx, w, locale, http.StatusBadRequest, "invalid_player")
+		return
+	}
+	if player == "" {
+		player = h.anonymousPlayer
+	}
+	if player != "" {
+		span.SetAttributes(attribute.String("player.name", player))
+		// サーバースパンからもプレイヤーごとにリクエストを検索できるようにします。
+		AddSpanAttr(ctx, attribute.String("player.name", player))
+		// 以降のログにもプレイヤー名を付加します。
+		ctx = WithLogField(ctx, "player.name", player)
+	}
+
+	// ?dice=NdMが指定された場合は、M面のサイコロをN個振ります。
+	count, sides := 1, 6
+	notation := r.URL.Query().Get("dice")
+	if notation != "" {
+		count, sides, err = parseDice(notation)
+		if err != nil {
+			h.fail(ctx, w, locale, http.StatusBadRequest, "invalid_dice")
+			return
+		}
+		if count > h.maxDice {
+			h.fail(ctx, w, locale, http.StatusBadRequest, "too_many_dice")
+			return
+		}
+		span.SetAttributes(
+			attribute.Int("dice.count", count),
+			attribute.Int("dice.sides", sides),
+		)
+	}
+
+	// 同じIdempotency-Keyで再送されたリクエストには、前回と同じ結果を返します。
+	// 別のプレイヤーやサイコロの指定に結果を返さないよう、キーはそれらと組み合わせて扱います。
+	var idempotencyKey string
+	if k := r.Header.Get("Idempotency-Key"); k != "" && h.idempotency != nil {
+		idempotencyKey = strings.Join([]string{player, notation, k}, "\x00")
+		resp, hit, err := h.idempotency.reserve(ctx, idempotencyKey)
+		if err != nil {
+			// 同じキーのリクエストを待っている間に、クライアントが切断しました。
+			return
+		}
+		span.SetAttributes(attribute.Bool("idempotent.hit", hit))
+		if hit {
+			if _, err := io.WriteString(w, resp); err != nil {
+				log.Printf("Write failed: %v\n", err)
+			}
+			return
+		}
+		// 結果を保存せずに終了した場合は、待機しているリクエストが処理を引き継ぎます。
+		defer h.idempotency.release(idempotencyKey)
+	}
+
+	// 同時実行数の制限。
+	if h.limiter != nil {
+		waitStart := time.Now()
+		acquired, limited := h.limiter.acquire(ctx)
+		waited := time.Since(waitStart)
+		h.waitDuration.Record(ctx, waited.Milliseconds(),
+			metric.WithAttributes(attribute.Bool("concurrency.acquired", acquired)))
+		AddServerTiming(ctx, "wait", waited)
+		if limited {
+			span.AddEvent("concurrency_limited", trace.WithAttributes(
+				attribute.Bool("concurrency.acquired", acquired)))
+		}
+		if !acquired {
+			h.fail(ctx, w, locale, http.StatusServiceUnavailable, "concurrency_limited")
+			return
+		}
+		defer h.limiter.release()
+	}
+	h.concurrency.Add(ctx, 1)
+	defer h.concurrency.Add(ctx, -1)
+
+	// 公平性を監査できるよう、使用した乱数源を記録します。
+	span.SetAttributes(attribute.String("dice.rng", h.rng))
+	rolls, sum := h.roll(ctx, span, count, sides)
 
 	var msg string
-	if player := r.PathValue("player"); player != "" {
+	if player != "" {
 		msg = fmt.Sprintf("%s is rolling the dice", player)
 	} else {
 		msg = "Anonymous player is rolling the dice"
 	}
-	logger.InfoContext(ctx, msg, "result", roll)
+	h.logger.InfoContext(ctx, msg, "result", sum)
 
-	rollValueAttr := attribute.Int("roll.value", roll)
-	span.SetAttributes(rollValueAttr)
-	rollCnt.Add(ctx, 1, metric.WithAttributes(rollValueAttr))
+	// tracestateのベンダーのエントリーを記録します。
+	if v, ok := vendorTraceState(ctx); ok {
+		span.SetAttributes(attribute.String("tracestate.vendor", v))
+	}
 
-	resp := strconv.Itoa(roll) + "\n"
+	var resp string
+	if notation == "" {
+		span.SetAttributes(attribute.Int("roll.value", sum))
+		resp = strconv.Itoa(sum) + "\n"
+	} else {
+		// 複数のサイコロの場合は、それぞれの出目と合計を返します（例: "3 5 2 = 10"）。
+		span.SetAttributes(
+			attribute.IntSlice("dice.rolls", rolls),
+			attribute.Int("dice.sum", sum),
+		)
+		strs := make([]string, len(rolls))
+		for i, roll := range rolls {
+			strs[i] = strconv.Itoa(roll)
+		}
+		resp = strings.Join(strs, " ") + " = " + strconv.Itoa(sum) + "\n"
+	}
+	if idempotencyKey != "" {
+		h.idempotency.complete(idempotencyKey, resp)
+	}
+	// ロールのスパンのうち、レスポンスを書き込むまでの処理時間をServer-Timingに含めます。
+	AddServerTiming(ctx, "roll", time.Since(rollStart))
 	if _, err := io.WriteString(w, resp); err != nil {
 		log.Printf("Write failed: %v\n", err)
 	}
 }
+
+// rollは、sides面のサイコロをcount個振り、出目と合計を返します。
+// 出目をspanのイベントとして記録し、出目ごとのロール数と出目の合計をメトリクスに加算します。
+func (h *diceHandler) roll(ctx context.Context, span trace.Span, count, sides int) (rolls []int, sum int) {
+	rolls = make([]int, count)
+	for i := range rolls {
+		rolls[i] = 1 + h.intn(sides)
+		sum += rolls[i]
+		// 複数のサイコロを振った場合も、各出目を振った順に追えるよう記録します。
+		span.AddEvent("roll", trace.WithAttributes(
+			attribute.Int("roll.index", i),
+			attribute.Int("roll.value", rolls[i])))
+	}
+	for _, roll := range rolls {
+		h.rollCnt.Add(ctx, 1, metric.WithAttributes(attribute.Int("roll.value", roll)))
+	}
+	h.valueSum.Add(ctx, int64(sum))
+	return rolls, sum
+}
+
+// enterDrainは、ドレイン中でなければリクエストを処理中として登録し、ok=trueと登録を解除するleaveを返します。
+// ドレイン中の場合は503を返し、ok=falseを返します。
+func (h *diceHandler) enterDrain(ctx context.Context, w http.ResponseWriter, locale language.Tag) (leave func(), ok bool) {
+	if h.drain == nil {
+		return func() {}, true
+	}
+	if !h.drain.enter() {
+		w.Header().Set("Connection", "close")
+		h.fail(ctx, w, locale, http.StatusServiceUnavailable, "draining")
+		return nil, false
+	}
+	return h.drain.leave, true
+}
+
+// failは、リクエストをerrorTypeのエラーとして処理します。
+// スパンをエラーにし、エラーの種類ごとのエラー数を記録したうえで、ローカライズしたメッセージを返します。
+func (h *diceHandler) fail(ctx context.Context, w http.ResponseWriter, locale language.Tag, status int, errorType string) {
+	errorTypeAttr := attribute.String("error.type", errorType)
+	span := trace.SpanFromContext(ctx)
+	span.SetStatus(codes.Error, errorType)
+	span.SetAttributes(errorTypeAttr)
+	h.errCnt.Add(ctx, 1, metric.WithAttributes(errorTypeAttr))
+	http.Error(w, localize(locale, errorType), status)
+}
+
+// sanitizePlayerは、プレイヤー名の前後の空白を取り除き、maxLen文字に切り詰めます。
+// 制御文字を含む場合はerrInvalidPlayerを返します。
+func sanitizePlayer(player string, maxLen int) (string, error) {
+	player = strings.TrimSpace(player)
+	if strings.ContainsFunc(player, unicode.IsControl) {
+		return "", errInvalidPlayer
+	}
+	return truncate(player, maxLen), nil
+}
+
+// parseDiceは、"3d6"のようなNdM形式の表記を解析し、サイコロの数と面の数を返します。
+func parseDice(notation string) (count, sides int, err error) {
+	c, m, ok := strings.Cut(strings.ToLower(notation), "d")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid dice notation %q", notation)
+	}
+	count, err = strconv.Atoi(c)
+	if err != nil || count < 1 {
+		return 0, 0, fmt.Errorf("invalid dice count in %q", notation)
+	}
+	sides, err = strconv.Atoi(m)
+	if err != nil || sides < 2 || sides > maxDiceSides {
+		return 0, 0, fmt.Errorf("invalid dice sides in %q", notation)
+	}
+	return count, sides, nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"dice/spantest"
+)
+
+// newTestConfigは、現在の環境変数から読み込んだ設定を返します。
+// 設定を変えたいテストでは、呼び出す前にt.Setenvで環境変数を設定します。
+func newTestConfig(t testing.TB) config {
+	t.Helper()
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// newTestDiceHandlerは、tpのトレーサーを使用するdiceHandlerを返します。
+// mpがnilの場合は、no-opのメーターを使用します。
+func newTestDiceHandler(t testing.TB, cfg config, tp trace.TracerProvider, mp metric.MeterProvider) *diceHandler {
+	t.Helper()
+	if mp == nil {
+		mp = noop.NewMeterProvider()
+	}
+	h, err := newDiceHandler(cfg, tp.Tracer(name), mp.Meter(name), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestRolldiceWithNoopProviders(t *testing.T) {
+	h := newTestDiceHandler(t, newTestConfig(t), tracenoop.NewTracerProvider(), noop.NewMeterProvider())
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+	req.SetPathValue("player", "alice")
+	rec := httptest.NewRecorder()
+	h.rolldice(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	roll, err := strconv.Atoi(strings.TrimSpace(rec.Body.String()))
+	if err != nil || roll < 1 || roll > 6 {
+		t.Errorf("body = %q, want a roll between 1 and 6", rec.Body.String())
+	}
+}
+
+func BenchmarkRolldice(b *testing.B) {
+	h := newTestDiceHandler(b, newTestConfig(b), tracenoop.NewTracerProvider(), noop.NewMeterProvider())
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+	req.SetPathValue("player", "alice")
+	b.ReportAllocs()
+	for b.Loop() {
+		h.rolldice(httptest.NewRecorder(), req)
+	}
+}
+
+func TestRolldicePlayerSanitized(t *testing.T) {
+	tests := []struct {
+		name       string
+		player     string
+		wantStatus int
+		wantPlayer string
+	}{
+		{name: "normal", player: " alice ", wantStatus: http.StatusOK, wantPlayer: "alice"},
+		{name: "too long", player: strings.Repeat("b", 12), wantStatus: http.StatusOK, wantPlayer: strings.Repeat("b", 8)},
+		{name: "control character", player: "eve\x00", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PLAYER_MAX_LENGTH", "8")
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/rolldice/player", nil)
+			req.SetPathValue("player", tt.player)
+			rec := httptest.NewRecorder()
+			h.rolldice(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+			if tt.wantPlayer == "" {
+				if hasAttribute(roll, "player.name") {
+					t.Error("rejected player was recorded as player.name")
+				}
+				return
+			}
+			spantest.AssertAttribute(t, roll, "player.name", attribute.StringValue(tt.wantPlayer))
+		})
+	}
+}
+
+func TestDiceErrorsCountedByType(t *testing.T) {
+	cfg := newTestConfig(t)
+	mp, reader := newTestMeterProvider(t, cfg)
+	h := newTestDiceHandler(t, cfg, tracenoop.NewTracerProvider(), mp)
+
+	requests := []struct {
+		player string
+		query  string
+	}{
+		{player: "alice", query: "dice=bogus"},
+		{player: "alice", query: "dice=0d6"},
+		{player: "alice", query: "dice=1000d6"},
+		{player: "eve\x00"},
+		{player: "alice"},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(http.MethodGet, "/rolldice/p?"+r.query, nil)
+		req.SetPathValue("player", r.player)
+		h.rolldice(httptest.NewRecorder(), req)
+	}
+
+	got := map[string]int64{}
+	m := findMetric(t, collect(t, reader), "dice.errors")
+	for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+		errorType, _ := dp.Attributes.Value("error.type")
+		got[errorType.AsString()] = dp.Value
+	}
+	want := map[string]int64{"invalid_dice": 2, "too_many_dice": 1, "invalid_player": 1}
+	if !maps.Equal(got, want) {
+		t.Errorf("dice.errors = %v, want %v", got, want)
+	}
+}
+
+func TestRolldiceMultipleDice(t *testing.T) {
+	tests := []struct {
+		name       string
+		dice       string
+		wantStatus int
+	}{
+		{name: "2d20", dice: "2d20", wantStatus: http.StatusOK},
+		{name: "invalid notation", dice: "2x20", wantStatus: http.StatusBadRequest},
+		{name: "count over limit", dice: "6d6", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_DICE", "5")
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/rolldice/alice?dice="+tt.dice, nil)
+			req.SetPathValue("player", "alice")
+			rec := httptest.NewRecorder()
+			h.rolldice(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			// レスポンスは"出目 出目 = 合計"の形式です。
+			values, total, ok := strings.Cut(strings.TrimSpace(rec.Body.String()), " = ")
+			if !ok {
+				t.Fatalf("body = %q, want rolls and sum", rec.Body.String())
+			}
+			sum := 0
+			rolls := strings.Fields(values)
+			for _, v := range rolls {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > 20 {
+					t.Errorf("roll %q out of range [1, 20]", v)
+				}
+				sum += n
+			}
+			if len(rolls) != 2 || total != strconv.Itoa(sum) {
+				t.Errorf("body = %q, want 2 rolls summing to the total", rec.Body.String())
+			}
+
+			roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+			spantest.AssertAttribute(t, roll, "dice.count", attribute.IntValue(2))
+			spantest.AssertAttribute(t, roll, "dice.sides", attribute.IntValue(20))
+			spantest.AssertAttribute(t, roll, "dice.sum", attribute.IntValue(sum))
+		})
+	}
+}
+
+func TestRolldiceRollsAttributeRoundTrips(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	var stdout bytes.Buffer
+	stdoutExporter, err := stdouttrace.New(stdouttrace.WithWriter(&stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSyncer(stdoutExporter))
+	h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice?dice=3d6", nil)
+	req.SetPathValue("player", "alice")
+	rec := httptest.NewRecorder()
+	h.rolldice(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%q)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	values, _, _ := strings.Cut(strings.TrimSpace(rec.Body.String()), " = ")
+	var want []int64
+	for _, v := range strings.Fields(values) {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, n)
+	}
+
+	// 出目はすべて1つの整数の配列の属性として記録されます。
+	roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+	spantest.AssertAttribute(t, roll, "dice.rolls", attribute.Int64SliceValue(want))
+
+	// stdoutのエクスポーターでも、配列の型のまま出力されます。
+	if !strings.Contains(stdout.String(), `"Type":"INT64SLICE"`) {
+		t.Errorf("stdout output has no INT64SLICE attribute: %s", stdout.String())
+	}
+}
+
+func TestRollValueSum(t *testing.T) {
+	cfg := newTestConfig(t)
+	mp, reader := newTestMeterProvider(t, cfg)
+	h := newTestDiceHandler(t, cfg, tracenoop.NewTracerProvider(), mp)
+	// 出目が3, 5, 1, 6の順になるよう、乱数源を固定します。
+	seq := []int{2, 4, 0, 5}
+	h.intn = func(int) int {
+		v := seq[0]
+		seq = seq[1:]
+		return v
+	}
+
+	for _, query := range []string{"", "dice=3d6"} {
+		req := httptest.NewRequest(http.MethodGet, "/rolldice/alice?"+query, nil)
+		req.SetPathValue("player", "alice")
+		h.rolldice(httptest.NewRecorder(), req)
+	}
+
+	rm := collect(t, reader)
+	var rolls int64
+	for _, dp := range findMetric(t, rm, "dice.rolls").Data.(metricdata.Sum[int64]).DataPoints {
+		rolls += dp.Value
+	}
+	sum := findMetric(t, rm, "dice.roll.value_sum").Data.(metricdata.Sum[int64]).DataPoints[0].Value
+	if rolls != 4 || sum != 15 {
+		t.Errorf("dice.rolls = %d, dice.roll.value_sum = %d, want 4 rolls summing to 15", rolls, sum)
+	}
+}
+
+func TestRolldiceAnonymousPlayer(t *testing.T) {
+	t.Setenv("ANONYMOUS_PLAYER", "guest")
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+	// プレイヤー名のないルートでは、既定のプレイヤー名を使います。
+	rec := httptest.NewRecorder()
+	h.rolldiceAnonymous(rec, httptest.NewRequest(http.MethodGet, "/rolldice/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+	spantest.AssertAttribute(t, roll, "player.name", attribute.StringValue("guest"))
+
+	// 名前付きのルートでは、パスのプレイヤー名を使います。
+	exporter.Reset()
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+	req.SetPathValue("player", "alice")
+	rec = httptest.NewRecorder()
+	h.rolldice(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	roll = spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+	spantest.AssertAttribute(t, roll, "player.name", attribute.StringValue("alice"))
+}
+
+func TestRolldiceAnonymousRedirect(t *testing.T) {
+	t.Setenv("ANONYMOUS_PLAYER", "guest")
+	t.Setenv("ANONYMOUS_PLAYER_REDIRECT", "true")
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+	rec := httptest.NewRecorder()
+	h.rolldiceAnonymous(rec, httptest.NewRequest(http.MethodGet, "/rolldice/?dice=2", nil))
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTemporaryRedirect)
+	}
+	if got, want := rec.Header().Get("Location"), "/rolldice/guest?dice=2"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("redirect recorded %d spans, want none", len(spans))
+	}
+}
+
+func TestRollEventsOrdered(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	h := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+	// 出目が3, 5, 1, 6の順になるよう、乱数源を固定します。
+	seq := []int{2, 4, 0, 5}
+	h.intn = func(int) int {
+		v := seq[0]
+		seq = seq[1:]
+		return v
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice?dice=4d6", nil)
+	req.SetPathValue("player", "alice")
+	h.rolldice(httptest.NewRecorder(), req)
+
+	roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+	var got [][]attribute.KeyValue
+	for _, e := range roll.Events {
+		if e.Name == "roll" {
+			got = append(got, e.Attributes)
+		}
+	}
+	want := [][]attribute.KeyValue{}
+	for i, v := range []int{3, 5, 1, 6} {
+		want = append(want, []attribute.KeyValue{attribute.Int("roll.index", i), attribute.Int("roll.value", v)})
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("roll events = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// dynamicSamplerは、実行中に差し替え可能なサンプラーです。
+type dynamicSampler struct {
+	sampler atomic.Pointer[trace.Sampler]
+}
+
+var _ trace.Sampler = (*dynamicSampler)(nil)
+
+// newDynamicSamplerは、最初にsを使用するdynamicSamplerを返します。
+func newDynamicSampler(s trace.Sampler) *dynamicSampler {
+	d := &dynamicSampler{}
+	d.set(s)
+	return d
+}
+
+// setは、以降のサンプリングの判断に使用するサンプラーをsに差し替えます。
+func (d *dynamicSampler) set(s trace.Sampler) {
+	d.sampler.Store(&s)
+}
+
+func (d *dynamicSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	return (*d.sampler.Load()).ShouldSample(p)
+}
+
+func (d *dynamicSampler) Description() string {
+	return (*d.sampler.Load()).Description()
+}
+
+// samplingAttrProcessorは、ローカルのルートスパンにサンプラーの判断結果と説明を属性として記録するSpanProcessorです。
+// 親がリモートのスパンも、このサービスにおけるルートとして扱います。
+// Dropと判断されたスパンはプロセッサーに渡されないため、記録されるのはRecordOnlyかRecordAndSampleのみです。
+// 親のないスパンがrulesのいずれかに一致した場合は、一致したルールのパターンもsampling.ruleとして記録します。
+// ruleSamplerはParentBasedのルートのサンプラーとして使うため、親がリモートのスパンの判断にはルールを使いません。
+type samplingAttrProcessor struct {
+	sampler trace.Sampler
+	rules   []samplingRule
+}
+
+var _ trace.SpanProcessor = samplingAttrProcessor{}
+
+func (p samplingAttrProcessor) OnStart(_ context.Context, s trace.ReadWriteSpan) {
+	if parent := s.Parent(); parent.IsValid() && !parent.IsRemote() {
+		return
+	}
+	decision := "RecordOnly"
+	if s.SpanContext().IsSampled() {
+		decision = "RecordAndSample"
+	}
+	s.SetAttributes(
+		attribute.String("sampling.decision", decision),
+		attribute.String("sampling.sampler", p.sampler.Description()),
+	)
+	if s.Parent().IsValid() {
+		return
+	}
+	// ruleSamplerと同じ開始時の属性で評価するため、サンプラーが使用したルールと一致します。
+	if i, ok := matchSamplingRule(p.rules, s.Attributes()); ok {
+		s.SetAttributes(attribute.String("sampling.rule", p.rules[i].pattern))
+	}
+}
+
+func (p samplingAttrProcessor) OnEnd(trace.ReadOnlySpan) {}
+
+func (p samplingAttrProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (p samplingAttrProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+// samplingRuleは、プレイヤー名がpatternに一致するルートスパンをratioの割合でサンプリングするルールです。
+type samplingRule struct {
+	// patternは、path.Matchの形式のプレイヤー名のパターンです。
+	pattern string
+	ratio   float64
+}
+
+// parseSamplingRulesは、"pattern=ratio"形式の指定をsamplingRuleのリストに変換します。
+// ルールは指定した順に評価されます。
+func parseSamplingRules(specs []string) ([]samplingRule, error) {
+	var rules []samplingRule
+	for _, spec := range specs {
+		pattern, v, ok := strings.Cut(spec, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid sampling rule %q, expected pattern=ratio", spec)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in %q: %w", spec, err)
+		}
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid ratio in %q, expected a number in [0, 1]", spec)
+		}
+		rules = append(rules, samplingRule{pattern: pattern, ratio: ratio})
+	}
+	return rules, nil
+}
+
+// ruleSamplerは、サーバースパンのurl.pathからプレイヤー名を取り出し、
+// 最初に一致したルールの割合でサンプリングするサンプラーです。
+// 一致するルールがない場合や、プレイヤー名がない場合はfallbackに従います。
+// 子スパンはプレイヤー名を持たないため、ParentBasedのルートのサンプラーとして使用します。
+type ruleSampler struct {
+	rules    []samplingRule
+	samplers []trace.Sampler
+	fallback trace.Sampler
+}
+
+var _ trace.Sampler = (*ruleSampler)(nil)
+
+// newRuleSamplerは、rulesを順に評価し、一致しない場合はfallbackを使用するruleSamplerを返します。
+func newRuleSampler(rules []samplingRule, fallback trace.Sampler) *ruleSampler {
+	samplers := make([]trace.Sampler, len(rules))
+	for i, r := range rules {
+		samplers[i] = trace.TraceIDRatioBased(r.ratio)
+	}
+	return &ruleSampler{rules: rules, samplers: samplers, fallback: fallback}
+}
+
+func (s *ruleSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	if i, ok := matchSamplingRule(s.rules, p.Attributes); ok {
+		return s.samplers[i].ShouldSample(p)
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *ruleSampler) Description() string {
+	rules := make([]string, len(s.rules))
+	for i, r := range s.rules {
+		rules[i] = fmt.Sprintf("%s=%g", r.pattern, r.ratio)
+	}
+	return fmt.Sprintf("RuleBased{rules:[%s],fallback:%s}", strings.Join(rules, ","), s.fallback.Description())
+}
+
+// matchSamplingRuleは、attrsのurl.pathから取り出したプレイヤー名に最初に一致するルールの添え字を返します。
+func matchSamplingRule(rules []samplingRule, attrs []attribute.KeyValue) (int, bool) {
+	if len(rules) == 0 {
+		return 0, false
+	}
+	player, ok := playerFromAttributes(attrs)
+	if !ok {
+		return 0, false
+	}
+	for i, r := range rules {
+		// パターンはparseSamplingRulesで検証済みのため、エラーにはなりません。
+		if matched, _ := path.Match(r.pattern, player); matched {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// playerFromAttributesは、/rolldice/{player}へのリクエストのurl.path属性からプレイヤー名を取り出します。
+func playerFromAttributes(attrs []attribute.KeyValue) (string, bool) {
+	for _, kv := range attrs {
+		if kv.Key != semconv.URLPathKey {
+			continue
+		}
+		player, ok := strings.CutPrefix(kv.Value.AsString(), "/rolldice/")
+		if !ok || player == "" {
+			return "", false
+		}
+		return player, true
+	}
+	return "", false
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"dice/spantest"
+)
+
+func TestSamplerHonorsUpstreamDecision(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		ratio       float64
+		want        bool
+	}{
+		{name: "upstream sampled", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ratio: 0, want: true},
+		{name: "upstream not sampled", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", ratio: 1, want: false},
+		{name: "root sampled by ratio", ratio: 1, want: true},
+		{name: "root dropped by ratio", ratio: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.SamplerRatio = tt.ratio
+			tp := trace.NewTracerProvider(trace.WithSampler(newSampler(cfg)))
+
+			header := http.Header{}
+			if tt.traceparent != "" {
+				header.Set("traceparent", tt.traceparent)
+			}
+			ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header))
+			_, span := tp.Tracer(name).Start(ctx, "server")
+			span.End()
+
+			if got := span.SpanContext().IsSampled(); got != tt.want {
+				t.Errorf("sampled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamplingAttributesOnRootSpans(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.SamplerRatio = 1
+	sampler := newSampler(cfg)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(sampler),
+		trace.WithSpanProcessor(samplingAttrProcessor{sampler: sampler}),
+		trace.WithSyncer(exporter),
+	)
+
+	ctx, root := tp.Tracer(name).Start(context.Background(), "root")
+	_, child := tp.Tracer(name).Start(ctx, "child")
+	child.End()
+	root.End()
+
+	spans := exporter.GetSpans()
+	rootSpan := spantest.AssertSpanExists(t, spans, "root")
+	spantest.AssertAttribute(t, rootSpan, "sampling.decision", attribute.StringValue("RecordAndSample"))
+	spantest.AssertAttribute(t, rootSpan, "sampling.sampler", attribute.StringValue(sampler.Description()))
+	if childSpan := spantest.AssertSpanExists(t, spans, "child"); hasAttribute(childSpan, "sampling.decision") {
+		t.Error("child span has sampling.decision, want it only on root spans")
+	}
+}
+
+func TestRuleSamplerByPlayer(t *testing.T) {
+	t.Setenv("SAMPLING_RULES", "qa-*=1")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0")
+	cfg := newTestConfig(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := trace.NewTracerProvider(trace.WithSampler(newSampler(cfg)), trace.WithSyncer(exporter))
+	h := otelhttp.NewHandler(okHandler, "server", otelhttp.WithTracerProvider(tp))
+
+	const n = 20
+	for _, player := range []string{"qa-bob", "alice"} {
+		for range n {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/rolldice/"+player, nil))
+		}
+	}
+
+	// 割合が0のため、ルールに一致しないプレイヤーのスパンは記録されません。
+	if got := len(exporter.GetSpans()); got != n {
+		t.Errorf("sampled %d spans, want all %d qa-bob requests and no others", got, n)
+	}
+}
+
+func TestSamplingRuleAttribute(t *testing.T) {
+	t.Setenv("SAMPLING_RULES", "qa-*=1,al*=1")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "1")
+	cfg := newTestConfig(t)
+	sampler := newSampler(cfg)
+
+	tests := []struct {
+		name     string
+		path     string
+		parent   string
+		wantRule string
+	}{
+		{name: "first rule", path: "/rolldice/qa-bob", wantRule: "qa-*"},
+		{name: "second rule", path: "/rolldice/alice", wantRule: "al*"},
+		{name: "no rule", path: "/rolldice/carol"},
+		// 親がリモートのスパンは親の判断に従うため、ルールを記録しません。
+		{name: "remote parent", path: "/rolldice/qa-bob", parent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := trace.NewTracerProvider(
+				trace.WithSampler(sampler),
+				trace.WithSpanProcessor(samplingAttrProcessor{sampler: sampler, rules: cfg.SamplingRules}),
+				trace.WithSyncer(exporter),
+			)
+			h := otelhttp.NewHandler(okHandler, "server",
+				otelhttp.WithTracerProvider(tp), otelhttp.WithPropagators(propagation.TraceContext{}))
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.parent != "" {
+				req.Header.Set("traceparent", tt.parent)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			server := spantest.AssertSpanExists(t, exporter.GetSpans(), "server")
+			if tt.wantRule == "" {
+				if hasAttribute(server, "sampling.rule") {
+					t.Error("sampling.rule recorded, want none")
+				}
+				return
+			}
+			spantest.AssertAttribute(t, server, "sampling.rule", attribute.StringValue(tt.wantRule))
+		})
+	}
+}
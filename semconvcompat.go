@@ -0,0 +1,46 @@
+package main
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// legacyHTTPAttributeKeysは、安定版のHTTPのセマンティック規約の属性のキーと、
+// 移行前（v1.20.0以前）の同じ意味の属性のキーの対応です。
+var legacyHTTPAttributeKeys = map[attribute.Key]attribute.Key{
+	semconv.HTTPRequestMethodKey:      "http.method",
+	semconv.HTTPResponseStatusCodeKey: "http.status_code",
+	semconv.URLSchemeKey:              "http.scheme",
+	semconv.URLPathKey:                "http.target",
+	semconv.NetworkProtocolVersionKey: "http.flavor",
+	semconv.UserAgentOriginalKey:      "http.user_agent",
+	semconv.ClientAddressKey:          "http.client_ip",
+	semconv.ServerAddressKey:          "net.host.name",
+	semconv.ServerPortKey:             "net.host.port",
+	semconv.NetworkPeerAddressKey:     "net.sock.peer.addr",
+	semconv.NetworkPeerPortKey:        "net.sock.peer.port",
+	semconv.HTTPRequestBodySizeKey:    "http.request_content_length",
+	semconv.HTTPResponseBodySizeKey:   "http.response_content_length",
+}
+
+// legacySemconvAttributesは、安定版のHTTPの属性と同じ値を、移行前の属性のキーでも記録します。
+// 古い属性名を参照するダッシュボードやアラートを移行し終えるまでの間、両方の名前で検索できるようにします。
+// 移行前の属性が既にある場合は、その値をそのまま残します。
+type legacySemconvAttributes struct{}
+
+func (legacySemconvAttributes) Process(attrs []attribute.KeyValue) []attribute.KeyValue {
+	present := make(map[attribute.Key]bool, len(attrs))
+	for _, kv := range attrs {
+		present[kv.Key] = true
+	}
+	var legacy []attribute.KeyValue
+	for _, kv := range attrs {
+		if old, ok := legacyHTTPAttributeKeys[kv.Key]; ok && !present[old] {
+			legacy = append(legacy, attribute.KeyValue{Key: old, Value: kv.Value})
+		}
+	}
+	if len(legacy) == 0 {
+		return attrs
+	}
+	return append(append(make([]attribute.KeyValue, 0, len(attrs)+len(legacy)), attrs...), legacy...)
+}
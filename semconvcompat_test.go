@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"dice/spantest"
+)
+
+func TestSemconvCompatServerSpanAttributes(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantLegacy bool
+	}{
+		{mode: "stable", wantLegacy: false},
+		{mode: "dup", wantLegacy: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Setenv("SEMCONV_COMPAT", tt.mode)
+			cfg := newTestConfig(t)
+			inner := tracetest.NewInMemoryExporter()
+			exporter := &attributeProcessingExporter{SpanExporter: inner, processors: newSpanAttributeProcessors(cfg)}
+			tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+
+			h := otelhttp.NewHandler(okHandler, "server", otelhttp.WithTracerProvider(tp))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil))
+
+			server := spantest.AssertSpanExists(t, inner.GetSpans(), "server")
+			spantest.AssertAttribute(t, server, "http.request.method", attribute.StringValue("GET"))
+			spantest.AssertAttribute(t, server, "http.response.status_code", attribute.IntValue(http.StatusOK))
+			if got := hasAttribute(server, "http.method"); got != tt.wantLegacy {
+				t.Errorf("http.method recorded = %t, want %t", got, tt.wantLegacy)
+			}
+			if tt.wantLegacy {
+				spantest.AssertAttribute(t, server, "http.method", attribute.StringValue("GET"))
+				spantest.AssertAttribute(t, server, "http.status_code", attribute.IntValue(http.StatusOK))
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+)
+
+// slogSeverityOffsetは、otelslogブリッジがslogのレベルをOTelの重大度番号に変換する際のオフセットです。
+const slogSeverityOffset = 9
+
+// standardLevelsは、重大度のマッピングで必ず指定しなければならないslogのレベルです。
+var standardLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// parseSeverityMapは、"LEVEL=NUMBER"の組からslogのレベルとOTelの重大度番号の対応を作成します。
+// すべての標準のレベルが指定されていることと、重大度番号が1〜24の範囲であることを検証します。
+func parseSeverityMap(pairs map[string]string) (map[slog.Level]otellog.Severity, error) {
+	m := make(map[slog.Level]otellog.Severity, len(pairs))
+	for k, v := range pairs {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(k)); err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < int(otellog.SeverityTrace1) || n > int(otellog.SeverityFatal4) {
+			return nil, fmt.Errorf("invalid severity number %q for %s", v, k)
+		}
+		m[l] = otellog.Severity(n)
+	}
+	for _, l := range standardLevels {
+		if _, ok := m[l]; !ok {
+			return nil, fmt.Errorf("missing severity for level %s", l)
+		}
+	}
+	return m, nil
+}
+
+// checkSamplingSeveritiesは、mappingがWARN以上のレベルをSeverityWarn以上に、WARN未満のレベルをSeverityWarn未満に対応させているかを検証します。
+// ログの間引きは置き換え後の重大度番号でWARN以上かを判定するため、この関係が崩れると間引く対象が変わってしまいます。
+func checkSamplingSeverities(mapping map[slog.Level]otellog.Severity) error {
+	for l, sev := range mapping {
+		if (l >= slog.LevelWarn) != (sev >= otellog.SeverityWarn) {
+			return fmt.Errorf("severity number %d for %s is on the other side of WARN (%d), which breaks LOG_SAMPLE_RATIO", sev, l, otellog.SeverityWarn)
+		}
+	}
+	return nil
+}
+
+// severityProcessorは、ログレコードの重大度番号をコレクターが期待する値に置き換えるlog.Processorです。
+// 後続のプロセッサーが変更後のレコードを受け取れるよう、それらより前に登録してください。
+type severityProcessor struct {
+	mapping map[slog.Level]otellog.Severity
+}
+
+var _ log.Processor = severityProcessor{}
+
+func (p severityProcessor) OnEmit(_ context.Context, r *log.Record) error {
+	level := slog.Level(r.Severity() - slogSeverityOffset)
+	if sev, ok := p.mapping[level]; ok {
+		r.SetSeverity(sev)
+	}
+	return nil
+}
+
+func (p severityProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (p severityProcessor) ForceFlush(context.Context) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+)
+
+// captureLogExporterは、エクスポートされたログレコードを記録するlog.Exporterです。
+// errを設定すると、記録したうえでそのエラーを返します。
+type captureLogExporter struct {
+	err error
+
+	mu      sync.Mutex
+	records []log.Record
+}
+
+func (e *captureLogExporter) Export(_ context.Context, records []log.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		e.records = append(e.records, r.Clone())
+	}
+	return e.err
+}
+
+// bodiesは、これまでにエクスポートされたレコードの本文を返します。
+func (e *captureLogExporter) bodies() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var bodies []string
+	for _, r := range e.records {
+		bodies = append(bodies, r.Body().AsString())
+	}
+	return bodies
+}
+
+func (e *captureLogExporter) Shutdown(context.Context) error   { return nil }
+func (e *captureLogExporter) ForceFlush(context.Context) error { return nil }
+
+func TestSeverityMapAppliedToExportedRecord(t *testing.T) {
+	mapping, err := parseSeverityMap(map[string]string{"DEBUG": "5", "INFO": "9", "WARN": "14", "ERROR": "18"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := &captureLogExporter{}
+	lp := log.NewLoggerProvider(
+		log.WithProcessor(severityProcessor{mapping: mapping}),
+		log.WithProcessor(log.NewSimpleProcessor(exporter)),
+	)
+	t.Cleanup(func() { _ = lp.Shutdown(context.Background()) })
+
+	otelslog.NewLogger(name, otelslog.WithLoggerProvider(lp)).Warn("low on dice")
+
+	if len(exporter.records) != 1 {
+		t.Fatalf("exported %d records, want 1", len(exporter.records))
+	}
+	if got := exporter.records[0].Severity(); got != otellog.SeverityWarn2 {
+		t.Errorf("severity = %v, want %v", got, otellog.SeverityWarn2)
+	}
+}
+
+func TestParseSeverityMapRequiresStandardLevels(t *testing.T) {
+	if _, err := parseSeverityMap(map[string]string{"INFO": "9", "WARN": "13", "ERROR": "17"}); err == nil {
+		t.Error("mapping without DEBUG was accepted")
+	}
+	if _, err := parseSeverityMap(map[string]string{"DEBUG": "5", "INFO": "9", "WARN": "13", "ERROR": "25"}); err == nil {
+		t.Error("out-of-range severity number was accepted")
+	}
+}
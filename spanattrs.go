@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanAttrsKeyは、サーバースパンに付加する属性を蓄積するspanAttrsを保持するコンテキストのキーです。
+type spanAttrsKey struct{}
+
+// spanAttrsは、リクエストの処理中に蓄積された属性です。
+// ハンドラーから複数のゴルーチンで追加される場合があるため、ロックで保護します。
+type spanAttrs struct {
+	mu    sync.Mutex
+	attrs []attribute.KeyValue
+}
+
+// spanAttrsMiddlewareは、AddSpanAttrで蓄積された属性を、ハンドラーの終了時にサーバースパンへまとめて付加します。
+// サーバースパンが終了する前に付加する必要があるため、HTTP計装の内側に置いてください。
+func spanAttrsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acc := &spanAttrs{}
+		defer func() {
+			acc.mu.Lock()
+			defer acc.mu.Unlock()
+			trace.SpanFromContext(r.Context()).SetAttributes(acc.attrs...)
+		}()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), spanAttrsKey{}, acc)))
+	})
+}
+
+// AddSpanAttrは、ctxのリクエストのサーバースパンに、リクエストの終了時に付加する属性を追加します。
+// 子スパンを開始したコンテキストからでも、サーバースパンの属性として記録できます。
+// spanAttrsMiddlewareを通らないコンテキストでは何もしません。
+func AddSpanAttr(ctx context.Context, kv ...attribute.KeyValue) {
+	acc, ok := ctx.Value(spanAttrsKey{}).(*spanAttrs)
+	if !ok {
+		return
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	acc.attrs = append(acc.attrs, kv...)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"dice/spantest"
+)
+
+func TestAddSpanAttrAppliedToServerSpan(t *testing.T) {
+	h := spanAttrsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddSpanAttr(r.Context(), attribute.String("player.name", "alice"))
+		// 子スパンのコンテキストから追加した属性も、サーバースパンに付加されます。
+		ctx, child := trace.SpanFromContext(r.Context()).TracerProvider().Tracer(name).Start(r.Context(), "roll")
+		AddSpanAttr(ctx, attribute.Int("dice.count", 2))
+		child.End()
+		w.Write([]byte("ok"))
+	}))
+
+	spans, _ := serveTraced(t, h, httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil))
+	server := spantest.AssertSpanExists(t, spans, "server")
+	spantest.AssertAttribute(t, server, "player.name", attribute.StringValue("alice"))
+	spantest.AssertAttribute(t, server, "dice.count", attribute.IntValue(2))
+	if roll := spantest.AssertSpanExists(t, spans, "roll"); hasAttribute(roll, "dice.count") {
+		t.Error("dice.count was recorded on the child span, want only the server span")
+	}
+
+	// ミドルウェアを通らないコンテキストでは何もしません。
+	AddSpanAttr(context.Background(), attribute.String("player.name", "bob"))
+}
@@ -0,0 +1,66 @@
+// Package spantestは、計装されたハンドラーのテストで使用するスパンのアサーションを提供します。
+// tracetest.InMemoryExporterなどで取得したtracetest.SpanStubを対象とします。
+package spantest
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AssertSpanExistsは、spansにnameという名前のスパンが存在することを検証し、最初に見つかったスパンを返します。
+func AssertSpanExists(t testing.TB, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("span %q not found in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+// AssertAttributeは、spanが属性keyを持ち、その値がvalueと等しいことを検証します。
+func AssertAttribute(t testing.TB, span tracetest.SpanStub, key attribute.Key, value attribute.Value) {
+	t.Helper()
+	for _, kv := range span.Attributes {
+		if kv.Key != key {
+			continue
+		}
+		if kv.Value != value {
+			t.Errorf("span %q: attribute %q = %s, want %s", span.Name, key, kv.Value.Emit(), value.Emit())
+		}
+		return
+	}
+	t.Errorf("span %q: attribute %q not found", span.Name, key)
+}
+
+// Nodeは、SpanTreeが再構築したスパンの親子関係におけるひとつのスパンです。
+type Node struct {
+	Span     tracetest.SpanStub
+	Children []*Node
+}
+
+// SpanTreeは、spansの親子関係を再構築し、ルートとなるスパンのノードを返します。
+// 親スパンがspansに含まれないスパン（リモートの親を持つスパンなど）もルートとして扱います。
+// 子スパンの順序はspans内の順序に従います。
+func SpanTree(spans tracetest.SpanStubs) []*Node {
+	nodes := make(map[trace.SpanID]*Node, len(spans))
+	for _, s := range spans {
+		nodes[s.SpanContext.SpanID()] = &Node{Span: s}
+	}
+
+	var roots []*Node
+	for _, s := range spans {
+		n := nodes[s.SpanContext.SpanID()]
+		parent, ok := nodes[s.Parent.SpanID()]
+		if !s.Parent.IsValid() || !ok || parent == n {
+			roots = append(roots, n)
+			continue
+		}
+		parent.Children = append(parent.Children, n)
+	}
+	return roots
+}
@@ -0,0 +1,148 @@
+package spantest
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeTは、アサーションの失敗を記録するtesting.TBです。
+type fakeT struct {
+	testing.TB
+	failed bool
+	msg    string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.failed = true
+	t.msg = fmt.Sprintf(format, args...)
+}
+
+func (t *fakeT) Fatalf(format string, args ...any) {
+	t.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// runFakeは、fakeTでfを実行し、その結果を返します。Fatalfで中断されても戻ります。
+func runFake(f func(t testing.TB)) *fakeT {
+	ft := &fakeT{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(ft)
+	}()
+	<-done
+	return ft
+}
+
+// recordSpansは、root、その子のchild、childの子のgrandchildと、別のトレースのotherを記録します。
+func recordSpans() tracetest.SpanStubs {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer("spantest")
+
+	ctx, root := tracer.Start(context.Background(), "root", trace.WithAttributes(attribute.String("player.name", "alice")))
+	ctx, child := tracer.Start(ctx, "child")
+	_, grandchild := tracer.Start(ctx, "grandchild")
+	grandchild.End()
+	child.End()
+	root.End()
+	_, other := tracer.Start(context.Background(), "other")
+	other.End()
+	return exporter.GetSpans()
+}
+
+func TestAssertSpanExists(t *testing.T) {
+	spans := recordSpans()
+
+	ft := runFake(func(t testing.TB) {
+		if got := AssertSpanExists(t, spans, "child"); got.Name != "child" {
+			t.Errorf("got span %q", got.Name)
+		}
+	})
+	if ft.failed {
+		t.Errorf("existing span reported as failure: %s", ft.msg)
+	}
+
+	ft = runFake(func(t testing.TB) { AssertSpanExists(t, spans, "missing") })
+	if !ft.failed {
+		t.Error("missing span was not reported")
+	}
+}
+
+func TestAssertAttribute(t *testing.T) {
+	root := AssertSpanExists(t, recordSpans(), "root")
+
+	tests := []struct {
+		name       string
+		key        attribute.Key
+		value      attribute.Value
+		wantFailed bool
+	}{
+		{name: "match", key: "player.name", value: attribute.StringValue("alice")},
+		{name: "different value", key: "player.name", value: attribute.StringValue("bob"), wantFailed: true},
+		{name: "missing key", key: "dice.sides", value: attribute.IntValue(6), wantFailed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := runFake(func(t testing.TB) { AssertAttribute(t, root, tt.key, tt.value) })
+			if ft.failed != tt.wantFailed {
+				t.Errorf("failed = %v, want %v (%s)", ft.failed, tt.wantFailed, ft.msg)
+			}
+		})
+	}
+}
+
+func TestSpanTree(t *testing.T) {
+	roots := SpanTree(recordSpans())
+
+	var names []string
+	for _, r := range roots {
+		names = append(names, r.Span.Name)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("roots = %v, want [root other]", names)
+	}
+	var root *Node
+	for _, r := range roots {
+		if r.Span.Name == "root" {
+			root = r
+		}
+	}
+	if root == nil {
+		t.Fatalf("roots = %v, want root among them", names)
+	}
+	if len(root.Children) != 1 || root.Children[0].Span.Name != "child" {
+		t.Fatalf("root children = %v, want [child]", root.Children)
+	}
+	child := root.Children[0]
+	if len(child.Children) != 1 || child.Children[0].Span.Name != "grandchild" {
+		t.Errorf("child children = %v, want [grandchild]", child.Children)
+	}
+}
+
+func TestSpanTreeRemoteParentIsRoot(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, span := tp.Tracer("spantest").Start(trace.ContextWithRemoteSpanContext(context.Background(), remote), "server")
+	span.End()
+
+	roots := SpanTree(exporter.GetSpans())
+	if len(roots) != 1 || roots[0].Span.Name != "server" {
+		t.Errorf("roots = %v, want [server]", roots)
+	}
+}
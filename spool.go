@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// spoolRetryIntervalは、ディスクに退避したバッチの再送を試みる間隔です。
+const spoolRetryInterval = 5 * time.Second
+
+// errBatchSpooledは、送信に失敗したバッチをディスクに退避したことを表します。
+// 退避したバッチは後で再送されるため、呼び出し側はエクスポートの成功とも失敗とも区別して扱えます。
+var errBatchSpooled = errors.New("span batch spooled for retry")
+
+// spoolClientは、送信に失敗したバッチをディスクに退避し、コレクターが復旧した後に再送するotlptrace.Clientです。
+// 退避するバッチは最大maxBatches個で、超えた場合は古いものから破棄します。
+// バッチはOTLPのリクエストとしてそのまま保存するため、プロセスを再起動しても再送されます。
+// 退避した場合、UploadTracesは送信時のエラーとともにerrBatchSpooledを返します。
+type spoolClient struct {
+	otlptrace.Client
+	dir        string
+	maxBatches int
+
+	// muは、ファイルの追加と上限を超えた古いファイルの削除、再送するファイルの一覧の取得を直列化します。
+	// 再送のアップロード中は保持しないため、コレクターの応答が遅い間もsaveは待たされません。
+	mu  sync.Mutex
+	seq atomic.Uint64
+	// retryは、送信が成功した際に再送を促します。
+	retry    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+var _ otlptrace.Client = (*spoolClient)(nil)
+
+// newSpoolClientは、clientの送信に失敗したバッチをdirに退避するspoolClientを返します。
+func newSpoolClient(client otlptrace.Client, dir string, maxBatches int) *spoolClient {
+	return &spoolClient{
+		Client:     client,
+		dir:        dir,
+		maxBatches: maxBatches,
+		retry:      make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (c *spoolClient) Start(ctx context.Context) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	if err := c.Client.Start(ctx); err != nil {
+		return err
+	}
+	go c.replayLoop()
+	return nil
+}
+
+func (c *spoolClient) Stop(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+	}
+	return c.Client.Stop(ctx)
+}
+
+func (c *spoolClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	err := c.Client.UploadTraces(ctx, protoSpans)
+	if err == nil {
+		// コレクターが復旧している可能性があるため、退避したバッチの再送を促します。
+		select {
+		case c.retry <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	if spoolErr := c.save(protoSpans); spoolErr != nil {
+		return errors.Join(err, spoolErr)
+	}
+	log.Printf("Span export failed, spooled the batch to %s for retry: %v", c.dir, err)
+	return fmt.Errorf("%w: %w", errBatchSpooled, err)
+}
+
+// saveは、バッチをファイルに保存し、上限を超えた古いバッチを削除します。
+func (c *spoolClient) save(protoSpans []*tracepb.ResourceSpans) error {
+	b, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// ファイル名の順が退避した順になるよう、時刻と連番を固定長で並べます。
+	name := fmt.Sprintf("%020d-%010d.pb", time.Now().UnixNano(), c.seq.Add(1))
+	if err := os.WriteFile(filepath.Join(c.dir, name), b, 0o644); err != nil {
+		return fmt.Errorf("failed to spool batch: %w", err)
+	}
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	for len(files) > c.maxBatches {
+		if err := removeSpooled(files[0]); err != nil {
+			return err
+		}
+		log.Printf("Span spool is full, dropped the oldest batch %s", filepath.Base(files[0]))
+		files = files[1:]
+	}
+	return nil
+}
+
+// filesは、退避したバッチのファイルを古い順に返します。
+func (c *spoolClient) files() ([]string, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".pb") {
+			files = append(files, filepath.Join(c.dir, e.Name()))
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// replayLoopは、一定間隔または送信の成功時に、退避したバッチを再送します。
+func (c *spoolClient) replayLoop() {
+	defer close(c.done)
+	ticker := time.NewTicker(spoolRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.retry:
+		}
+		if err := c.replay(); err != nil {
+			log.Printf("Span spool replay failed, will retry: %v", err)
+		}
+	}
+}
+
+// replayは、退避したバッチを古い順に再送し、成功したものを削除します。
+// 再送に失敗した場合は、残りを次の機会に回します。
+// 再送はreplayLoopのゴルーチンからのみ行うため、同じファイルを並行して再送することはありません。
+func (c *spoolClient) replay() error {
+	c.mu.Lock()
+	files, err := c.files()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if errors.Is(err, fs.ErrNotExist) {
+			// 一覧を取得した後に、上限を超えたためsaveが削除しました。
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(b, &req); err != nil {
+			// 壊れたファイルは再送できないため、削除して次に進みます。
+			log.Printf("Dropping unreadable spooled batch %s: %v", filepath.Base(f), err)
+			if err := removeSpooled(f); err != nil {
+				return err
+			}
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), spoolRetryInterval)
+		err = c.Client.UploadTraces(ctx, req.ResourceSpans)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if err := removeSpooled(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSpooledは、退避したバッチのファイルを削除します。
+// アップロードの間にsaveが上限を超えたとして削除した場合は、成功として扱います。
+func removeSpooled(f string) error {
+	if err := os.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// blockingTraceClientは、UploadTracesが呼び出されたことをcalledで通知し、
+// gateが閉じられるまで応答しないotlptrace.Clientです。
+type blockingTraceClient struct {
+	called chan struct{}
+	gate   chan struct{}
+}
+
+func (c *blockingTraceClient) Start(context.Context) error { return nil }
+func (c *blockingTraceClient) Stop(context.Context) error  { return nil }
+
+func (c *blockingTraceClient) UploadTraces(ctx context.Context, _ []*tracepb.ResourceSpans) error {
+	c.called <- struct{}{}
+	select {
+	case <-c.gate:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestSpoolSavesDuringReplay(t *testing.T) {
+	client := &blockingTraceClient{called: make(chan struct{}, 1), gate: make(chan struct{})}
+	c := newSpoolClient(client, t.TempDir(), 10)
+	if err := c.save(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := make(chan error, 1)
+	go func() { replayed <- c.replay() }()
+	<-client.called
+
+	// 再送のアップロードが止まっている間も、新しいバッチを退避できます。
+	saved := make(chan error, 1)
+	go func() { saved <- c.save(nil) }()
+	select {
+	case err := <-saved:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("save blocked while a replay upload was in flight")
+	}
+
+	close(client.gate)
+	if err := <-replayed; err != nil {
+		t.Fatal(err)
+	}
+	// 再送を始めた後に退避したバッチは、次の再送まで残ります。
+	if files, _ := filepath.Glob(filepath.Join(c.dir, "*.pb")); len(files) != 1 {
+		t.Errorf("spooled batches after replay = %v, want only the batch saved during the replay", files)
+	}
+}
+
+func TestSpoolClientStopTwice(t *testing.T) {
+	client := &blockingTraceClient{called: make(chan struct{}, 1), gate: make(chan struct{})}
+	c := newSpoolClient(client, t.TempDir(), 10)
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(ctx); err != nil {
+		t.Errorf("second Stop() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// stdoutFailuresは、標準出力のエクスポーターで連続した書き込みの失敗を数え、
+// maxFailures回に達した以降のエクスポートを破棄するよう判断します。
+// 標準出力のパイプが閉じられた後も、バッチプロセッサーがエクスポートのたびにエラーを繰り返さないようにします。
+type stdoutFailures struct {
+	// signalは、ログに記録するシグナルの名前です（"traces"、"metrics"または"logs"）。
+	signal      string
+	maxFailures int
+
+	mu       sync.Mutex
+	failures int
+	disabled bool
+}
+
+// newStdoutFailuresは、signalNameのエクスポーターの失敗を数えるstdoutFailuresを返します。
+// パイプが閉じられた際の書き込みをエラーとして扱うには、run()のようにSIGPIPEを無視してください。
+func newStdoutFailures(signalName string, maxFailures int) *stdoutFailures {
+	return &stdoutFailures{signal: signalName, maxFailures: maxFailures}
+}
+
+// exportは、破棄するよう判断していなければexportFnを呼び出し、その結果を記録して返します。
+// 失敗がmaxFailures回連続した時点で、以降は何も出力せずにnilを返すようになります。
+func (f *stdoutFailures) export(exportFn func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.disabled {
+		return nil
+	}
+	err := exportFn()
+	if err == nil {
+		f.failures = 0
+		return nil
+	}
+	f.failures++
+	if f.failures >= f.maxFailures {
+		f.disabled = true
+		slog.Warn("Stdout exporter failed repeatedly, discarding further output",
+			"signal", f.signal, "failures", f.failures, "error", err)
+	}
+	return err
+}
+
+// stdoutSpanExporterは、書き込みが失敗し続けた場合にスパンを破棄する標準出力のSpanExporterです。
+type stdoutSpanExporter struct {
+	trace.SpanExporter
+	failures *stdoutFailures
+}
+
+func (e *stdoutSpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	return e.failures.export(func() error { return e.SpanExporter.ExportSpans(ctx, spans) })
+}
+
+// stdoutMetricExporterは、書き込みが失敗し続けた場合にメトリクスを破棄する標準出力のExporterです。
+type stdoutMetricExporter struct {
+	metric.Exporter
+	failures *stdoutFailures
+}
+
+func (e *stdoutMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.failures.export(func() error { return e.Exporter.Export(ctx, rm) })
+}
+
+// stdoutLogExporterは、書き込みが失敗し続けた場合にログを破棄する標準出力のExporterです。
+type stdoutLogExporter struct {
+	log.Exporter
+	failures *stdoutFailures
+}
+
+func (e *stdoutLogExporter) Export(ctx context.Context, records []log.Record) error {
+	return e.failures.export(func() error { return e.Exporter.Export(ctx, records) })
+}
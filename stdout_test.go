@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// brokenPipeWriterは、閉じられたパイプのように常に書き込みに失敗するio.Writerです。
+type brokenPipeWriter struct {
+	writes atomic.Int32
+}
+
+func (w *brokenPipeWriter) Write([]byte) (int, error) {
+	w.writes.Add(1)
+	return 0, syscall.EPIPE
+}
+
+func TestStdoutExporterStopsAfterFailures(t *testing.T) {
+	const maxFailures = 3
+	w := &brokenPipeWriter{}
+	inner, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := &stdoutSpanExporter{SpanExporter: inner, failures: newStdoutFailures("traces", maxFailures)}
+
+	spans := tracetest.SpanStubs{{Name: "roll"}}.Snapshots()
+	for i := range maxFailures {
+		if err := exporter.ExportSpans(context.Background(), spans); !errors.Is(err, syscall.EPIPE) {
+			t.Fatalf("export %d = %v, want %v", i+1, err, syscall.EPIPE)
+		}
+	}
+	// しきい値に達した後は、書き込まずにエラーも返しません。
+	writes := w.writes.Load()
+	for range 2 {
+		if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+			t.Errorf("export after %d failures = %v, want nil", maxFailures, err)
+		}
+	}
+	if got := w.writes.Load(); got != writes {
+		t.Errorf("writes = %d after disabling, want %d", got, writes)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// deltaExporterは、名前がpatternsのいずれかに一致する計装の累積の合計をデルタに変換してからエクスポートするExporterです。
+// SDKではテンポラリティをビューや計装の名前で指定できないため、リーダーはすべて累積で集計し、エクスポートの直前に変換します。
+// これにより、同じリーダーでカウンターの一部をデルタ、ヒストグラムなどを累積のまま送信できます。
+type deltaExporter struct {
+	metric.Exporter
+	// patternsは、path.Matchの形式の計装の名前のパターンです。
+	patterns []string
+
+	mu sync.Mutex
+	// lastInt64とlastFloat64は、系列ごとに前回エクスポートした累積値です。
+	lastInt64   map[deltaKey]deltaPoint[int64]
+	lastFloat64 map[deltaKey]deltaPoint[float64]
+}
+
+// deltaKeyは、計装の名前と属性の組み合わせで系列を識別します。
+type deltaKey struct {
+	name  string
+	attrs attribute.Distinct
+}
+
+// deltaPointは、前回エクスポートした累積値とその集計期間です。
+type deltaPoint[N int64 | float64] struct {
+	start time.Time
+	time  time.Time
+	value N
+}
+
+func newDeltaExporter(exp metric.Exporter, patterns []string) *deltaExporter {
+	return &deltaExporter{
+		Exporter:    exp,
+		patterns:    patterns,
+		lastInt64:   make(map[deltaKey]deltaPoint[int64]),
+		lastFloat64: make(map[deltaKey]deltaPoint[float64]),
+	}
+}
+
+func (e *deltaExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.mu.Lock()
+	for i := range rm.ScopeMetrics {
+		for j := range rm.ScopeMetrics[i].Metrics {
+			m := &rm.ScopeMetrics[i].Metrics[j]
+			if !e.matches(m.Name) {
+				continue
+			}
+			switch d := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				m.Data = toDelta(e.lastInt64, m.Name, d)
+			case metricdata.Sum[float64]:
+				m.Data = toDelta(e.lastFloat64, m.Name, d)
+			}
+		}
+	}
+	e.mu.Unlock()
+	return e.Exporter.Export(ctx, rm)
+}
+
+// matchesは、nameがいずれかのパターンに一致するかどうかを返します。
+func (e *deltaExporter) matches(name string) bool {
+	for _, p := range e.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toDeltaは、累積の合計sumを前回の値lastとの差分のデルタに変換し、lastを今回の値で更新します。
+// 開始時刻が変わった系列は、リセットされたものとして今回の値をそのまま差分とします。
+func toDelta[N int64 | float64](last map[deltaKey]deltaPoint[N], name string, sum metricdata.Sum[N]) metricdata.Sum[N] {
+	if sum.Temporality != metricdata.CumulativeTemporality {
+		return sum
+	}
+	dps := make([]metricdata.DataPoint[N], len(sum.DataPoints))
+	for i, dp := range sum.DataPoints {
+		key := deltaKey{name: name, attrs: dp.Attributes.Equivalent()}
+		prev, ok := last[key]
+		last[key] = deltaPoint[N]{start: dp.StartTime, time: dp.Time, value: dp.Value}
+		if ok && prev.start.Equal(dp.StartTime) {
+			dp.StartTime = prev.time
+			dp.Value -= prev.value
+		}
+		dps[i] = dp
+	}
+	sum.DataPoints = dps
+	sum.Temporality = metricdata.DeltaTemporality
+	return sum
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// captureMetricExporterは、エクスポートされたメトリクスを記録するExporterです。
+type captureMetricExporter struct {
+	metric.Exporter
+	exported []metricdata.ResourceMetrics
+}
+
+func (e *captureMetricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	e.exported = append(e.exported, *rm)
+	return nil
+}
+
+func TestDeltaExporterConvertsNamedInstrumentsOnly(t *testing.T) {
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	meter := mp.Meter(name)
+
+	rolls, _ := meter.Int64Counter("dice.rolls")
+	other, _ := meter.Int64Counter("other.count")
+	duration, _ := meter.Float64Histogram("dice.roll.duration")
+
+	capture := &captureMetricExporter{}
+	exporter := newDeltaExporter(capture, []string{"dice.rolls", "run"})
+	export := func() metricdata.ResourceMetrics {
+		t.Helper()
+		rm := collect(t, reader)
+		if err := exporter.Export(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		return capture.exported[len(capture.exported)-1]
+	}
+
+	ctx := context.Background()
+	rolls.Add(ctx, 3)
+	other.Add(ctx, 2)
+	duration.Record(ctx, 0.1)
+	export()
+
+	rolls.Add(ctx, 4)
+	other.Add(ctx, 5)
+	duration.Record(ctx, 0.2)
+	rm := export()
+
+	rollsSum := findMetric(t, rm, "dice.rolls").Data.(metricdata.Sum[int64])
+	if rollsSum.Temporality != metricdata.DeltaTemporality {
+		t.Errorf("dice.rolls temporality = %v, want delta", rollsSum.Temporality)
+	}
+	if got := rollsSum.DataPoints[0].Value; got != 4 {
+		t.Errorf("dice.rolls value = %d, want 4", got)
+	}
+
+	otherSum := findMetric(t, rm, "other.count").Data.(metricdata.Sum[int64])
+	if otherSum.Temporality != metricdata.CumulativeTemporality {
+		t.Errorf("other.count temporality = %v, want cumulative", otherSum.Temporality)
+	}
+	if got := otherSum.DataPoints[0].Value; got != 7 {
+		t.Errorf("other.count value = %d, want 7", got)
+	}
+
+	hist := findMetric(t, rm, "dice.roll.duration").Data.(metricdata.Histogram[float64])
+	if hist.Temporality != metricdata.CumulativeTemporality {
+		t.Errorf("dice.roll.duration temporality = %v, want cumulative", hist.Temporality)
+	}
+	if got := hist.DataPoints[0].Count; got != 2 {
+		t.Errorf("dice.roll.duration count = %d, want 2", got)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// vendorTraceStateKeyは、W3C tracestateヘッダーにおける自社ベンダーのエントリーのキーです。
+const vendorTraceStateKey = "vendor"
+
+// vendorTraceStateは、ctxのスパンコンテキストが持つtracestateから、ベンダーのエントリーの値を読み取ります。
+func vendorTraceState(ctx context.Context) (string, bool) {
+	v := trace.SpanContextFromContext(ctx).TraceState().Get(vendorTraceStateKey)
+	return v, v != ""
+}
+
+// setVendorTraceStateは、tracestateにベンダーのエントリーを設定したスパンコンテキストを持つctxを返します。
+// 返されたctxでは現在のスパンが記録されないスパンに置き換わるため、子スパンを開始する前の親として使用してください。
+// 開始した子スパンと、そこから伝搬されるリクエストにエントリーが引き継がれます。
+func setVendorTraceState(ctx context.Context, value string) (context.Context, error) {
+	sc := trace.SpanContextFromContext(ctx)
+	ts, err := sc.TraceState().Insert(vendorTraceStateKey, value)
+	if err != nil {
+		return ctx, err
+	}
+	return trace.ContextWithSpanContext(ctx, sc.WithTraceState(ts)), nil
+}
+
+// defaultTraceStateSamplerは、サンプリングの結果のtracestateにkeyのエントリーがない場合に、
+// keyとvalueのエントリーを追加するサンプラーです。
+// ルートスパンを含むすべてのスパンに設定されるため、下流へ伝搬するリクエストにもエントリーが引き継がれます。
+type defaultTraceStateSampler struct {
+	sdktrace.Sampler
+	key   string
+	value string
+}
+
+func (s *defaultTraceStateSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.Sampler.ShouldSample(p)
+	if res.Tracestate.Get(s.key) != "" {
+		return res
+	}
+	// keyとvalueは設定の読み込み時に検証済みのため、エラーになるのはエントリー数が上限に達した場合のみです。
+	if ts, err := res.Tracestate.Insert(s.key, s.value); err == nil {
+		res.Tracestate = ts
+	}
+	return res
+}
+
+func (s *defaultTraceStateSampler) Description() string {
+	return fmt.Sprintf("DefaultTraceState{%s=%s,%s}", s.key, s.value, s.Sampler.Description())
+}
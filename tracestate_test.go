@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"dice/spantest"
+)
+
+func TestVendorTraceStatePropagated(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+	dice := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+	// ハンドラーから下流へ送るリクエストを模擬し、伝搬されるヘッダーを記録します。
+	var outbound http.Header
+	handler := otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("player", "alice")
+		dice.rolldice(w, r)
+		out := httptest.NewRequest(http.MethodGet, "http://downstream/", nil)
+		injectContext(r.Context(), out)
+		outbound = out.Header
+	}), "/", otelhttp.WithTracerProvider(tp))
+
+	req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=abc123,other=xyz")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := outbound.Get("tracestate"); !strings.Contains(got, "vendor=abc123") {
+		t.Errorf("outbound tracestate = %q, want it to contain vendor=abc123", got)
+	}
+	roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+	spantest.AssertAttribute(t, roll, "tracestate.vendor", attribute.StringValue("abc123"))
+}
+
+func TestSetVendorTraceStateRoundTrip(t *testing.T) {
+	prop := propagation.TraceContext{}
+	in := propagation.HeaderCarrier{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Set("tracestate", "vendor=old,other=xyz")
+	ctx := prop.Extract(context.Background(), in)
+
+	ctx, err := setVendorTraceState(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := propagation.HeaderCarrier{}
+	prop.Inject(ctx, out)
+	if got, want := out.Get("tracestate"), "vendor=abc123,other=xyz"; got != want {
+		t.Errorf("injected tracestate = %q, want %q", got, want)
+	}
+	if got, want := out.Get("traceparent"), in.Get("traceparent"); got != want {
+		t.Errorf("injected traceparent = %q, want %q", got, want)
+	}
+
+	got, ok := vendorTraceState(prop.Extract(context.Background(), out))
+	if !ok || got != "abc123" {
+		t.Errorf("vendorTraceState after round trip = %q, %t, want abc123", got, ok)
+	}
+
+	if _, err := setVendorTraceState(ctx, "bad,value"); err == nil {
+		t.Error("setVendorTraceState accepted a value containing a comma")
+	}
+}
+
+func TestVendorTraceStateSetByHandler(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+	t.Setenv("VENDOR_TRACESTATE", "dice")
+
+	tests := []struct {
+		name       string
+		tracestate string
+		want       string
+	}{
+		{name: "without upstream entry", tracestate: "other=xyz", want: "dice"},
+		{name: "upstream entry kept", tracestate: "vendor=abc123", want: "abc123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := trace.NewTracerProvider(trace.WithSyncer(exporter))
+			dice := newTestDiceHandler(t, newTestConfig(t), tp, nil)
+
+			var outbound http.Header
+			handler := otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("player", "alice")
+				dice.rolldice(w, r)
+				// 下流へのリクエストはロールのスパンの子として送られるため、ロールのスパンのコンテキストで伝搬します。
+				out := httptest.NewRequest(http.MethodGet, "http://downstream/", nil)
+				injectContext(oteltrace.ContextWithSpanContext(r.Context(), exporter.GetSpans()[0].SpanContext), out)
+				outbound = out.Header
+			}), "/", otelhttp.WithTracerProvider(tp))
+
+			req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+			req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			req.Header.Set("tracestate", tt.tracestate)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			ts, err := oteltrace.ParseTraceState(outbound.Get("tracestate"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ts.Get(vendorTraceStateKey); got != tt.want {
+				t.Errorf("outbound tracestate = %q, want vendor=%s", ts, tt.want)
+			}
+			roll := spantest.AssertSpanExists(t, exporter.GetSpans(), "roll")
+			spantest.AssertAttribute(t, roll, "tracestate.vendor", attribute.StringValue(tt.want))
+			// ロールのスパンは、設定の前と同じサーバースパンの子として記録されます。
+			server := spantest.AssertSpanExists(t, exporter.GetSpans(), "/")
+			if roll.Parent.SpanID() != server.SpanContext.SpanID() {
+				t.Errorf("roll parent = %s, want the server span %s", roll.Parent.SpanID(), server.SpanContext.SpanID())
+			}
+		})
+	}
+}
+
+func TestDefaultTraceStateInjected(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+	t.Setenv("DEFAULT_TRACESTATE", "org=acme")
+	cfg := newTestConfig(t)
+	tp := trace.NewTracerProvider(trace.WithSampler(newSampler(cfg)))
+
+	tests := []struct {
+		name       string
+		tracestate string
+		want       string
+	}{
+		{name: "root span", want: "org=acme"},
+		{name: "upstream without entry", tracestate: "other=xyz", want: "org=acme,other=xyz"},
+		{name: "upstream entry kept", tracestate: "org=globex", want: "org=globex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var outbound http.Header
+			handler := otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				out := httptest.NewRequest(http.MethodGet, "http://downstream/", nil)
+				injectContext(r.Context(), out)
+				outbound = out.Header
+			}), "/", otelhttp.WithTracerProvider(tp))
+
+			req := httptest.NewRequest(http.MethodGet, "/rolldice/alice", nil)
+			if tt.tracestate != "" {
+				req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+				req.Header.Set("tracestate", tt.tracestate)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := outbound.Get("tracestate"); got != tt.want {
+				t.Errorf("outbound tracestate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// watchdogProcessorは、一定時間を超えて終了しないスパンを強制的に終了させるSpanProcessorです。
+// 終了処理の漏れによって何時間も開いたままのスパンが、ダッシュボードを歪めるのを防ぎます。
+type watchdogProcessor struct {
+	maxDuration time.Duration
+
+	mu     sync.Mutex
+	timers map[oteltrace.SpanID]*time.Timer
+}
+
+var _ trace.SpanProcessor = (*watchdogProcessor)(nil)
+
+// newWatchdogProcessorは、maxDurationを超えたスパンを終了させるwatchdogProcessorを返します。
+func newWatchdogProcessor(maxDuration time.Duration) *watchdogProcessor {
+	return &watchdogProcessor{
+		maxDuration: maxDuration,
+		timers:      make(map[oteltrace.SpanID]*time.Timer),
+	}
+}
+
+func (p *watchdogProcessor) OnStart(_ context.Context, s trace.ReadWriteSpan) {
+	id := s.SpanContext().SpanID()
+	// time.AfterFuncは発火するまでゴルーチンを作成しないため、正常に終了したスパンのコストはタイマーのみです。
+	t := time.AfterFunc(p.maxDuration, func() {
+		s.AddEvent("span.timeout", oteltrace.WithAttributes(
+			attribute.String("span.max_duration", p.maxDuration.String())))
+		s.SetStatus(codes.Error, "span exceeded max duration")
+		s.End()
+	})
+
+	p.mu.Lock()
+	p.timers[id] = t
+	p.mu.Unlock()
+}
+
+func (p *watchdogProcessor) OnEnd(s trace.ReadOnlySpan) {
+	id := s.SpanContext().SpanID()
+
+	p.mu.Lock()
+	t, ok := p.timers[id]
+	delete(p.timers, id)
+	p.mu.Unlock()
+
+	if ok {
+		t.Stop()
+	}
+}
+
+func (p *watchdogProcessor) Shutdown(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, t := range p.timers {
+		t.Stop()
+		delete(p.timers, id)
+	}
+	return nil
+}
+
+func (p *watchdogProcessor) ForceFlush(context.Context) error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWatchdogEndsLongSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	watchdog := newWatchdogProcessor(20 * time.Millisecond)
+	tp := trace.NewTracerProvider(trace.WithSyncer(exporter), trace.WithSpanProcessor(watchdog))
+	tracer := tp.Tracer(name)
+
+	// 正常に終了したスパンのタイマーは残りません。
+	_, short := tracer.Start(context.Background(), "short")
+	short.End()
+	// 終了し忘れたスパンを模擬します。
+	_, _ = tracer.Start(context.Background(), "leaked")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(exporter.GetSpans()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked span was not force-ended, exported %d spans", len(exporter.GetSpans()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var leaked tracetest.SpanStub
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "leaked" {
+			leaked = s
+		}
+	}
+	if leaked.Status.Code != codes.Error {
+		t.Errorf("status = %v, want %v", leaked.Status.Code, codes.Error)
+	}
+	if len(leaked.Events) != 1 || leaked.Events[0].Name != "span.timeout" {
+		t.Errorf("events = %v, want a span.timeout event", leaked.Events)
+	}
+
+	watchdog.mu.Lock()
+	defer watchdog.mu.Unlock()
+	if n := len(watchdog.timers); n != 0 {
+		t.Errorf("%d timers remain after all spans ended", n)
+	}
+}